@@ -0,0 +1,147 @@
+// Package admin has the HTTP endpoints to operate the server, like running the ETL.
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/etl"
+	"vue_go_cockroachdb/src/scheduler"
+)
+
+const (
+	defaultFailedItemsLimit = 50
+	maxFailedItemsLimit     = 500
+)
+
+// Handler serves the /admin endpoints. ETL is nil when the server has no ETL
+// configured, and its endpoints answer 503.
+type Handler struct {
+	ETL         *scheduler.Runner
+	ETLProgress *etl.Progress
+
+	// DB, Conflict and Hooks are used to rescore and to retry the failed items.
+	DB       *sql.DB
+	Conflict etl.ConflictPolicy
+	Hooks    []etl.Hook
+}
+
+// ETLStatus is the response of the ETL endpoints.
+type ETLStatus struct {
+	scheduler.Status
+	Stats etl.Stats `json:"stats"` // of the current run, or of the last one run by this replica
+}
+
+// RunETL starts an ETL run in the background and answers 202 with its status,
+// or 409 if it's already running here or in another replica.
+func (h *Handler) RunETL(w http.ResponseWriter, r *http.Request) {
+	if h.ETL == nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "ETL is not configured in this server")
+		return
+	}
+
+	if err := h.ETL.Trigger(); err != nil {
+		if errors.Is(err, scheduler.ErrAlreadyRunning) || errors.Is(err, scheduler.ErrLeaseHeld) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeConflict, err.Error())
+			return
+		}
+		problem.Internal(w, r, "Failed to start the ETL", err)
+		return
+	}
+
+	h.writeStatus(w, r, http.StatusAccepted)
+}
+
+// GetETLStatus answers with the state of the ETL: whether it's running, the last
+// and next runs, and the stats of the current or last run.
+func (h *Handler) GetETLStatus(w http.ResponseWriter, r *http.Request) {
+	if h.ETL == nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "ETL is not configured in this server")
+		return
+	}
+
+	h.writeStatus(w, r, http.StatusOK)
+}
+
+func (h *Handler) writeStatus(w http.ResponseWriter, r *http.Request, code int) {
+	resp := ETLStatus{Status: h.ETL.Status(r.Context())}
+	if h.ETLProgress != nil {
+		resp.Stats = h.ETLProgress.Snapshot()
+	}
+
+	writeJSON(w, code, resp)
+}
+
+// Rescore recalculates the score of every stored event and answers with how many
+// were updated.
+func (h *Handler) Rescore(w http.ResponseWriter, r *http.Request) {
+	updated, err := etl.Rescore(r.Context(), h.DB)
+	if err != nil {
+		problem.Internal(w, r, "Failed to rescore the events", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"rescored": updated})
+}
+
+// ListFailedItems answers with the items the ETL couldn't transform or load, newest
+// first. It accepts ?limit=.
+func (h *Handler) ListFailedItems(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	limit := p.Int("limit", defaultFailedItemsLimit, 1, maxFailedItemsLimit)
+	if !p.Check(w, r) {
+		return
+	}
+
+	items, err := etl.ListFailedItems(r.Context(), h.DB, limit)
+	if err != nil {
+		problem.Internal(w, r, "Failed to list failed items", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// RetryFailedItems transforms and loads again the failed items in {"ids": ["..."]}, or
+// every failed item without a body, and answers with the stats of the retry.
+func (h *Handler) RetryFailedItems(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.InvalidJSON(w, r, err)
+			return
+		}
+	}
+	ids := make([]int64, 0, len(req.IDs))
+	var errs []problem.FieldError
+	for i, raw := range req.IDs {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("ids[%d]", i), Code: problem.FieldInvalid, Message: "must be a failed item id"})
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, errs...)
+		return
+	}
+
+	stats, err := etl.RetryFailedItems(r.Context(), h.DB, etl.Config{Conflict: h.Conflict, Hooks: h.Hooks}, ids)
+	if err != nil {
+		problem.Internal(w, r, "Failed to retry the failed items", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
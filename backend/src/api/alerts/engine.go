@@ -0,0 +1,108 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// Notifier sends the alerts fired by an evaluation somewhere, e.g. a chat or an email.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, alerts []Alert) error
+
+func (f NotifierFunc) Notify(ctx context.Context, alerts []Alert) error {
+	return f(ctx, alerts)
+}
+
+// LogNotifier writes one log line per alert. It's the default notifier.
+var LogNotifier = NotifierFunc(func(ctx context.Context, alerts []Alert) error {
+	for _, a := range alerts {
+		slog.InfoContext(ctx, "Alert", "rule", a.RuleName, "ticker", a.Event.Ticker, "action", a.Event.Action,
+			"rating_from", a.Event.RatingFrom, "rating_to", a.Event.RatingTo, "brokerage", a.Event.Brokerage,
+			"score", a.Event.RecommendationScore)
+	}
+	return nil
+})
+
+// Engine evaluates the enabled rules against events, stores the matches as alerts
+// and sends the new ones to Notifier.
+type Engine struct {
+	Store    *Store
+	Notifier Notifier // nil for LogNotifier
+}
+
+// Evaluate matches events against every enabled rule and returns the alerts fired.
+// An event that already fired a rule doesn't fire it again.
+func (e *Engine) Evaluate(ctx context.Context, events []models.StockWithScore) ([]Alert, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	rules, exprs, invalid, err := e.Store.enabledRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load alert rules: %w", err)
+	}
+	for _, err := range invalid {
+		slog.WarnContext(ctx, "Skipping invalid alert rule", "error", err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var ids []string
+	for _, expr := range exprs {
+		ids = append(ids, expr.WatchlistIDs()...)
+	}
+	watchlists, err := e.Store.loadWatchlists(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("load watchlists of the alert rules: %w", err)
+	}
+
+	matches := Match(rules, exprs, events, watchlists)
+	fired, err := e.Store.insertAlerts(ctx, matches)
+	if err != nil {
+		return fired, fmt.Errorf("store alerts: %w", err)
+	}
+	if len(fired) == 0 {
+		return nil, nil
+	}
+
+	notifier := e.Notifier
+	if notifier == nil {
+		notifier = LogNotifier
+	}
+	if err := notifier.Notify(ctx, fired); err != nil {
+		return fired, fmt.Errorf("notify alerts: %w", err)
+	}
+	return fired, nil
+}
+
+// AfterETL evaluates the events inserted by an ETL run. It has the signature of an etl.Hook,
+// so events updated by the run aren't evaluated again.
+func (e *Engine) AfterETL(ctx context.Context, inserted []models.StockWithScore) error {
+	fired, err := e.Evaluate(ctx, inserted)
+	if len(fired) > 0 {
+		slog.InfoContext(ctx, "Alerts fired", "alerts", len(fired))
+	}
+	return err
+}
+
+// Match returns an unsaved alert for every pair of rule and event that matches.
+// exprs are the parsed expressions of rules, in the same order.
+func Match(rules []Rule, exprs []*Expr, events []models.StockWithScore, watchlists Watchlists) []Alert {
+	var alerts []Alert
+	for _, event := range events {
+		for i, expr := range exprs {
+			if expr.Match(event, watchlists) {
+				alerts = append(alerts, Alert{RuleID: rules[i].ID, RuleName: rules[i].Name, Event: event})
+			}
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,492 @@
+// Package alerts evaluates user-defined rules against the events loaded by the ETL,
+// storing the matches in the "alerts" table and sending them to a Notifier.
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// MaxExpressionLength is the maximum length of a rule expression, in bytes.
+const MaxExpressionLength = 1000
+
+// Expr is a parsed rule expression. The syntax is a list of comparisons joined with
+// "and", "or" and "not", with parentheses for grouping:
+//
+//	action = "downgraded" and watchlist = "5f0c…"
+//	score > 10
+//	target_change_pct >= 20 and rating_to in ("Buy", "Strong-Buy")
+//
+// Text fields (ticker, company, brokerage, action, rating_from, rating_to, currency)
+// support =, != and in, compared ignoring case. Number fields (score, target_from,
+// target_to, target_change_pct) also support <, <=, > and >=; comparisons on a missing
+// target are false. "watchlist" supports = and in, and is true when the ticker belongs
+// to the given watchlist.
+type Expr struct {
+	source     string
+	root       node
+	watchlists []string
+}
+
+// Watchlists holds the tickers of the watchlists used by the expressions,
+// as watchlist id -> ticker -> true.
+type Watchlists map[string]map[string]bool
+
+// Parse parses and validates a rule expression.
+func Parse(source string) (*Expr, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	if len(source) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", MaxExpressionLength)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, watchlists: map[string]bool{}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+
+	e := &Expr{source: source, root: root}
+	for id := range p.watchlists {
+		e.watchlists = append(e.watchlists, id)
+	}
+	sort.Strings(e.watchlists)
+	return e, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// WatchlistIDs returns the ids of the watchlists used by the expression, sorted.
+func (e *Expr) WatchlistIDs() []string {
+	return e.watchlists
+}
+
+// Match reports whether the event s matches the expression. watchlists must hold the
+// tickers of every watchlist in WatchlistIDs.
+func (e *Expr) Match(s models.StockWithScore, watchlists Watchlists) bool {
+	return e.root.eval(&s, watchlists)
+}
+
+type node interface {
+	eval(s *models.StockWithScore, w Watchlists) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+
+func (n andNode) eval(s *models.StockWithScore, w Watchlists) bool {
+	return n.left.eval(s, w) && n.right.eval(s, w)
+}
+
+func (n orNode) eval(s *models.StockWithScore, w Watchlists) bool {
+	return n.left.eval(s, w) || n.right.eval(s, w)
+}
+
+func (n notNode) eval(s *models.StockWithScore, w Watchlists) bool {
+	return !n.inner.eval(s, w)
+}
+
+type fieldKind int
+
+const (
+	kindText fieldKind = iota
+	kindNumber
+	kindWatchlist
+)
+
+// field is a value of an event that expressions can compare.
+type field struct {
+	kind   fieldKind
+	text   func(s *models.StockWithScore) string
+	number func(s *models.StockWithScore) (float64, bool) // false when missing
+}
+
+var fields = map[string]field{
+	"ticker":      {kind: kindText, text: func(s *models.StockWithScore) string { return s.Ticker }},
+	"company":     {kind: kindText, text: func(s *models.StockWithScore) string { return s.Company }},
+	"brokerage":   {kind: kindText, text: func(s *models.StockWithScore) string { return s.Brokerage }},
+	"action":      {kind: kindText, text: func(s *models.StockWithScore) string { return s.Action }},
+	"rating_from": {kind: kindText, text: func(s *models.StockWithScore) string { return s.RatingFrom }},
+	"rating_to":   {kind: kindText, text: func(s *models.StockWithScore) string { return s.RatingTo }},
+	"currency":    {kind: kindText, text: func(s *models.StockWithScore) string { return s.TargetCurrency }},
+	"score": {kind: kindNumber, number: func(s *models.StockWithScore) (float64, bool) {
+		return s.RecommendationScore, true
+	}},
+	"target_from": {kind: kindNumber, number: func(s *models.StockWithScore) (float64, bool) {
+		return s.TargetFrom.Decimal.InexactFloat64(), s.TargetFrom.Valid
+	}},
+	"target_to": {kind: kindNumber, number: func(s *models.StockWithScore) (float64, bool) {
+		return s.TargetTo.Decimal.InexactFloat64(), s.TargetTo.Valid
+	}},
+	"target_change_pct": {kind: kindNumber, number: targetChangePct},
+	"watchlist":         {kind: kindWatchlist},
+}
+
+// targetChangePct is the change from target_from to target_to, in percent.
+func targetChangePct(s *models.StockWithScore) (float64, bool) {
+	if !s.TargetFrom.Valid || !s.TargetTo.Valid || s.TargetFrom.Decimal.IsZero() {
+		return 0, false
+	}
+	change := s.TargetTo.Decimal.Sub(s.TargetFrom.Decimal).Div(s.TargetFrom.Decimal).Mul(decimal.NewFromInt(100))
+	return change.InexactFloat64(), true
+}
+
+// compareNode compares a field with one value, or with a list of values for "in".
+type compareNode struct {
+	name   string
+	field  field
+	op     string
+	texts  []string
+	number float64
+}
+
+func (n compareNode) eval(s *models.StockWithScore, w Watchlists) bool {
+	switch n.field.kind {
+	case kindWatchlist:
+		for _, id := range n.texts {
+			if w[id][s.Ticker] {
+				return true
+			}
+		}
+		return false
+	case kindText:
+		value := n.field.text(s)
+		in := false
+		for _, t := range n.texts {
+			if strings.EqualFold(value, t) {
+				in = true
+				break
+			}
+		}
+		if n.op == "!=" {
+			return !in
+		}
+		return in
+	default:
+		value, ok := n.field.number(s)
+		if !ok {
+			return false
+		}
+		switch n.op {
+		case "=":
+			return value == n.number
+		case "!=":
+			return value != n.number
+		case "<":
+			return value < n.number
+		case "<=":
+			return value <= n.number
+		case ">":
+			return value > n.number
+		default: // ">="
+			return value >= n.number
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp     // = != < <= > >=
+	tokenLParen // (
+	tokenRParen // )
+	tokenComma  // ,
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // identifiers are lowercased, strings unquoted
+	pos   int    // byte offset in the source, for errors
+	quote string // original text of strings
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return t.quote
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			start := i
+			op := string(c)
+			i++
+			if i < len(source) && source[i] == '=' {
+				op += "="
+				i++
+			}
+			switch op {
+			case "!":
+				return nil, fmt.Errorf("position %d: unexpected \"!\", did you mean \"!=\"?", start+1)
+			case "==":
+				op = "="
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: start})
+		case c == '"':
+			end := i + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("position %d: unterminated string", i+1)
+			}
+			quoted := source[i : end+1]
+			text, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("position %d: invalid string %s", i+1, quoted)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i, quote: quoted})
+			i = end + 1
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(source) && (source[end] == '.' || (source[end] >= '0' && source[end] <= '9')) {
+				end++
+			}
+			if _, err := strconv.ParseFloat(source[i:end], 64); err != nil {
+				return nil, fmt.Errorf("position %d: invalid number %q", i+1, source[i:end])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[i:end], pos: i})
+			i = end
+		case isIdentByte(c) && (c < '0' || c > '9'):
+			end := i + 1
+			for end < len(source) && isIdentByte(source[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: strings.ToLower(source[i:end]), pos: i})
+			i = end
+		default:
+			return nil, fmt.Errorf("position %d: unexpected character %q", i+1, c)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type parser struct {
+	tokens     []token
+	next       int
+	watchlists map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == word
+}
+
+// parseOr parses: and ("or" and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: not ("and" not)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.take()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// parseNot parses: "not" not | "(" or ")" | comparison
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("not") {
+		p.take()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.take()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.take(); t.kind != tokenRParen {
+			return nil, p.errorf(t, "expected \")\", got %s", t)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses: field op value | field "in" "(" value ("," value)* ")"
+func (p *parser) parseComparison() (node, error) {
+	t := p.take()
+	if t.kind != tokenIdent {
+		return nil, p.errorf(t, "expected a field, got %s", t)
+	}
+	f, ok := fields[t.text]
+	if !ok {
+		return nil, p.errorf(t, "unknown field %q (valid: %s)", t.text, strings.Join(fieldNames(), ", "))
+	}
+	n := compareNode{name: t.text, field: f}
+
+	opToken := p.take()
+	switch {
+	case opToken.kind == tokenIdent && opToken.text == "in":
+		n.op = "in"
+	case opToken.kind == tokenOp:
+		n.op = opToken.text
+	default:
+		return nil, p.errorf(opToken, "expected an operator after %q, got %s", n.name, opToken)
+	}
+
+	switch f.kind {
+	case kindNumber:
+		if n.op == "in" {
+			return nil, p.errorf(opToken, "%q is a number field and doesn't support \"in\"", n.name)
+		}
+		v := p.take()
+		if v.kind != tokenNumber {
+			return nil, p.errorf(v, "%q is a number field, expected a number, got %s", n.name, v)
+		}
+		n.number, _ = strconv.ParseFloat(v.text, 64)
+		return n, nil
+	case kindWatchlist:
+		if n.op != "=" && n.op != "in" {
+			return nil, p.errorf(opToken, "\"watchlist\" only supports = and in")
+		}
+	default:
+		if n.op != "=" && n.op != "!=" && n.op != "in" {
+			return nil, p.errorf(opToken, "%q is a text field and only supports =, != and in", n.name)
+		}
+	}
+
+	if n.op == "in" {
+		values, err := p.parseList(n.name)
+		if err != nil {
+			return nil, err
+		}
+		n.texts = values
+	} else {
+		v := p.take()
+		if v.kind != tokenString {
+			return nil, p.errorf(v, "%q is a text field, expected a quoted string, got %s", n.name, v)
+		}
+		n.texts = []string{v.text}
+	}
+	if f.kind == kindWatchlist {
+		for i, id := range n.texts {
+			n.texts[i] = strings.ToLower(id) // as returned by the database
+			p.watchlists[n.texts[i]] = true
+		}
+	}
+	return n, nil
+}
+
+// parseList parses: "(" string ("," string)* ")"
+func (p *parser) parseList(name string) ([]string, error) {
+	if t := p.take(); t.kind != tokenLParen {
+		return nil, p.errorf(t, "expected \"(\" after in, got %s", t)
+	}
+	var values []string
+	for {
+		v := p.take()
+		if v.kind != tokenString {
+			return nil, p.errorf(v, "%q is a text field, expected a quoted string, got %s", name, v)
+		}
+		values = append(values, v.text)
+		switch t := p.take(); t.kind {
+		case tokenComma:
+		case tokenRParen:
+			return values, nil
+		default:
+			return nil, p.errorf(t, "expected \",\" or \")\", got %s", t)
+		}
+	}
+}
+
+func fieldNames() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
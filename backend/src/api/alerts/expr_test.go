@@ -0,0 +1,103 @@
+package alerts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+const watchlistID = "5f0c3a1e-8d2b-4c7a-9e61-2b7d4f0a9c33"
+
+func TestExprMatch(t *testing.T) {
+	event := models.StockWithScore{
+		Stock: models.Stock{
+			Ticker:     "AKBA",
+			Brokerage:  "HC Wainwright",
+			Action:     models.ActionDowngraded,
+			RatingFrom: "Buy",
+			RatingTo:   "Neutral",
+			TargetFrom: models.NewPrice(decimal.RequireFromString("5")),
+			TargetTo:   models.NewPrice(decimal.RequireFromString("6.5")),
+		},
+		RecommendationScore: 12.5,
+	}
+	noTargets := event
+	noTargets.TargetFrom, noTargets.TargetTo = models.Price{}, models.Price{}
+	watchlists := Watchlists{watchlistID: {"AKBA": true}, "00000000-0000-0000-0000-000000000000": {"MSFT": true}}
+
+	tests := []struct {
+		expr     string
+		event    models.StockWithScore
+		expected bool
+	}{
+		{`action = "downgraded"`, event, true},
+		{`ACTION == "Downgraded"`, event, true},
+		{`action != "downgraded"`, event, false},
+		{`score > 10`, event, true},
+		{`score >= 12.5 and score < 13`, event, true},
+		{`score <= 10`, event, false},
+		{`target_change_pct > 20`, event, true},
+		{`target_change_pct > 30`, event, false},
+		{`target_change_pct > 20`, noTargets, false},
+		{`not target_change_pct > 20`, noTargets, true},
+		{`rating_to in ("Buy", "neutral")`, event, true},
+		{`watchlist = "` + watchlistID + `" and action = "downgraded"`, event, true},
+		{`watchlist = "` + strings.ToUpper(watchlistID) + `"`, event, true},
+		{`watchlist = "00000000-0000-0000-0000-000000000000"`, event, false},
+		{`ticker = "MSFT" or (brokerage = "HC Wainwright" and not rating_from = "Sell")`, event, true},
+		{`ticker = "MSFT" or brokerage = "HC Wainwright" and rating_from = "Sell"`, event, false},
+	}
+
+	for _, tt := range tests {
+		expr, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) returned unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Match(tt.event, watchlists); got != tt.expected {
+			t.Errorf("Parse(%q).Match() = %v; want %v", tt.expr, got, tt.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{``, "expression is empty"},
+		{`price > 10`, `position 1: unknown field "price"`},
+		{`score > "high"`, `position 9: "score" is a number field, expected a number`},
+		{`action > "upgraded"`, `position 8: "action" is a text field and only supports =, != and in`},
+		{`action = downgraded`, `position 10: "action" is a text field, expected a quoted string`},
+		{`score in (1, 2)`, `doesn't support "in"`},
+		{`watchlist != "x"`, `"watchlist" only supports = and in`},
+		{`(score > 1`, `expected ")", got end of expression`},
+		{`score > 1 score < 2`, `position 11: unexpected "score"`},
+		{`action = "up`, "position 10: unterminated string"},
+		{`score ! 1`, `did you mean "!="?`},
+		{`score > 1 and`, "expected a field, got end of expression"},
+		{strings.Repeat("x", MaxExpressionLength+1), "longer than"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) error = %v; want it to contain %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestWatchlistIDs(t *testing.T) {
+	expr, err := Parse(`watchlist in ("B", "a") or watchlist = "b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := expr.WatchlistIDs(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchlistIDs() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/models"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+
+	defaultTestEvents = 200
+	maxTestEvents     = 1000
+)
+
+// Handler serves the /alerts endpoints.
+type Handler struct {
+	Store *Store
+}
+
+type ruleRequest struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	Enabled    *bool  `json:"enabled"` // true if missing
+	Limit      int    `json:"limit"`   // events to test the expression on
+}
+
+// TestResult is the response of TestRule.
+type TestResult struct {
+	Evaluated int                     `json:"evaluated"`
+	Matches   []models.StockWithScore `json:"matches"`
+}
+
+// ListRules answers with every alert rule.
+func (h *Handler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.Store.ListRules(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "Failed to list alert rules", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// CreateRule creates a rule from {"name": "...", "expression": "...", "enabled": true}.
+func (h *Handler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	rule, err := h.Store.CreateRule(r.Context(), strings.TrimSpace(req.Name), req.Expression, enabled)
+	if err != nil {
+		writeError(w, r, err, "Failed to create alert rule")
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// GetRule answers with a rule.
+func (h *Handler) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := h.Store.GetRule(r.Context(), r.PathValue("id"))
+	writeRule(w, r, rule, err)
+}
+
+// UpdateRule enables or disables a rule with {"enabled": false}.
+func (h *Handler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	if req.Enabled == nil {
+		problem.Invalid(w, r, problem.FieldError{Field: "enabled", Code: problem.FieldRequired, Message: "is required"})
+		return
+	}
+
+	rule, err := h.Store.SetRuleEnabled(r.Context(), r.PathValue("id"), *req.Enabled)
+	writeRule(w, r, rule, err)
+}
+
+// DeleteRule deletes a rule and its alerts.
+func (h *Handler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.DeleteRule(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err, "Failed to delete alert rule")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestRule evaluates {"expression": "...", "limit": 200} against the last limit stored
+// events, without storing or notifying anything, and answers with the matching events.
+func (h *Handler) TestRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultTestEvents
+	}
+	if limit < 0 || limit > maxTestEvents {
+		problem.Invalid(w, r, problem.FieldError{Field: "limit", Code: problem.FieldOutOfRange,
+			Message: fmt.Sprintf("must be between 1 and %d", maxTestEvents)})
+		return
+	}
+
+	ctx := r.Context()
+	expr, err := h.Store.Validate(ctx, req.Expression)
+	if err != nil {
+		writeError(w, r, err, "Failed to test alert rule")
+		return
+	}
+
+	events, err := h.Store.RecentEvents(ctx, limit)
+	if err != nil {
+		problem.Internal(w, r, "Failed to test alert rule", err)
+		return
+	}
+	watchlists, err := h.Store.loadWatchlists(ctx, expr.WatchlistIDs())
+	if err != nil {
+		problem.Internal(w, r, "Failed to test alert rule", err)
+		return
+	}
+
+	result := TestResult{Evaluated: len(events), Matches: []models.StockWithScore{}}
+	for _, e := range events {
+		if expr.Match(e, watchlists) {
+			result.Matches = append(result.Matches, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ListAlerts answers with the last fired alerts, newest first. It accepts
+// ?rule=<id> (also as the {id} of /alerts/rules/{id}/alerts) and ?limit=.
+func (h *Handler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.PathValue("id")
+	if ruleID == "" {
+		ruleID = r.URL.Query().Get("rule")
+	}
+	p := problem.Query(r)
+	limit := p.Int("limit", defaultListLimit, 1, maxListLimit)
+	if !p.Check(w, r) {
+		return
+	}
+
+	alerts, err := h.Store.ListAlerts(r.Context(), ruleID, limit)
+	if err != nil {
+		writeError(w, r, err, "Failed to list alerts")
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func writeRule(w http.ResponseWriter, r *http.Request, rule *Rule, err error) {
+	if err != nil {
+		writeError(w, r, err, "Failed to get alert rule")
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// writeError answers with the problem of err: 400 for a ValidationError, 404 for a
+// rule that doesn't exist, and 500 with failed as detail for the rest.
+func writeError(w http.ResponseWriter, r *http.Request, err error, failed string) {
+	var invalid ValidationError
+	if errors.As(err, &invalid) {
+		problem.Invalid(w, r, problem.FieldError{Field: invalid.field, Code: problem.FieldInvalid, Message: invalid.msg})
+		return
+	}
+	problem.FromError(w, r, err, "Alert rule not found", failed)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
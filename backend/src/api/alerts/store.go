@@ -0,0 +1,308 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// Rule is an alert rule (alert_rules table).
+type Rule struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Expression string    `json:"expression"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Alert is a match of a rule on an event loaded by the ETL (alerts table).
+type Alert struct {
+	ID       string                `json:"id"`
+	RuleID   string                `json:"rule_id"`
+	RuleName string                `json:"rule_name"`
+	Event    models.StockWithScore `json:"event"`
+	FiredAt  time.Time             `json:"fired_at"`
+}
+
+// ValidationError reports an invalid rule; the message is meant for the API client.
+type ValidationError struct {
+	field string // "name" or "expression"
+	msg   string
+}
+
+func (e ValidationError) Error() string { return e.msg }
+
+// uuidPattern matches the ids of rules and watchlists. Other ids can't exist, and are
+// reported as not found instead of as a failed cast in the database.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Store reads and writes the rules and alerts. Methods on a rule that doesn't exist
+// return an error wrapping sql.ErrNoRows.
+type Store struct {
+	DB *sql.DB
+}
+
+func ruleNotFound(id string) error {
+	return fmt.Errorf("alert rule %q: %w", id, sql.ErrNoRows)
+}
+
+// ListRules returns every rule, oldest first.
+func (s *Store) ListRules(ctx context.Context) ([]Rule, error) {
+	return s.queryRules(ctx, `SELECT id, name, expression, enabled, created_at FROM alert_rules ORDER BY created_at, id`)
+}
+
+// GetRule returns the rule id.
+func (s *Store) GetRule(ctx context.Context, id string) (*Rule, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, ruleNotFound(id)
+	}
+	rules, err := s.queryRules(ctx, `SELECT id, name, expression, enabled, created_at FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ruleNotFound(id)
+	}
+	return &rules[0], nil
+}
+
+// CreateRule validates and stores a rule. Invalid rules return a ValidationError.
+func (s *Store) CreateRule(ctx context.Context, name, expression string, enabled bool) (*Rule, error) {
+	if name == "" {
+		return nil, ValidationError{"name", "name must not be empty"}
+	}
+	if _, err := s.Validate(ctx, expression); err != nil {
+		return nil, err
+	}
+
+	r := Rule{Name: name, Expression: expression, Enabled: enabled}
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO alert_rules (name, expression, enabled) VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, name, expression, enabled).Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Validate parses expression and checks that the watchlists it uses exist.
+// Invalid expressions return a ValidationError.
+func (s *Store) Validate(ctx context.Context, expression string) (*Expr, error) {
+	expr, err := Parse(expression)
+	if err != nil {
+		return nil, ValidationError{"expression", "invalid expression: " + err.Error()}
+	}
+	for _, id := range expr.WatchlistIDs() {
+		exists := false
+		if uuidPattern.MatchString(id) {
+			err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM watchlists WHERE id = $1)`, id).Scan(&exists)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !exists {
+			return nil, ValidationError{"expression", fmt.Sprintf("invalid expression: watchlist %q doesn't exist", id)}
+		}
+	}
+	return expr, nil
+}
+
+// SetRuleEnabled enables or disables the rule id.
+func (s *Store) SetRuleEnabled(ctx context.Context, id string, enabled bool) (*Rule, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, ruleNotFound(id)
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE alert_rules SET enabled = $2 WHERE id = $1`, id, enabled)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ruleNotFound(id)
+	}
+	return s.GetRule(ctx, id)
+}
+
+// DeleteRule deletes the rule id and its alerts.
+func (s *Store) DeleteRule(ctx context.Context, id string) error {
+	if !uuidPattern.MatchString(id) {
+		return ruleNotFound(id)
+	}
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ruleNotFound(id)
+	}
+	return nil
+}
+
+// ListAlerts returns the last limit alerts, newest first, of the rule ruleID or of
+// every rule if ruleID is empty.
+func (s *Store) ListAlerts(ctx context.Context, ruleID string, limit int) ([]Alert, error) {
+	query := `
+		SELECT a.id, a.rule_id, r.name, a.event, a.fired_at
+		FROM alerts a JOIN alert_rules r ON r.id = a.rule_id
+	`
+	args := []any{limit}
+	if ruleID != "" {
+		if !uuidPattern.MatchString(ruleID) {
+			return nil, ruleNotFound(ruleID)
+		}
+		query += ` WHERE a.rule_id = $2`
+		args = append(args, ruleID)
+	}
+	query += ` ORDER BY a.fired_at DESC, a.id LIMIT $1`
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var event []byte
+		if err := rows.Scan(&a.ID, &a.RuleID, &a.RuleName, &event, &a.FiredAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(event, &a.Event); err != nil {
+			return nil, fmt.Errorf("alert %s: invalid event: %w", a.ID, err)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// RecentEvents returns the last limit stored events, newest first, to test rules on.
+func (s *Store) RecentEvents(ctx context.Context, limit int) ([]models.StockWithScore, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT ticker, COALESCE(company, ''), COALESCE(brokerage, ''), COALESCE(action, ''),
+		       COALESCE(rating_from, ''), COALESCE(rating_to, ''), target_from, target_to,
+		       COALESCE(target_currency, ''), time, COALESCE(recommendation_score, 0)
+		FROM stocks ORDER BY time DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.StockWithScore
+	for rows.Next() {
+		var e models.StockWithScore
+		err := rows.Scan(&e.Ticker, &e.Company, &e.Brokerage, &e.Action, &e.RatingFrom, &e.RatingTo,
+			&e.TargetFrom, &e.TargetTo, &e.TargetCurrency, &e.Time, &e.RecommendationScore)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// enabledRules returns the enabled rules with their parsed expressions. Rules whose
+// expression no longer parses are returned in invalid and skipped.
+func (s *Store) enabledRules(ctx context.Context) (rules []Rule, exprs []*Expr, invalid []error, err error) {
+	all, err := s.queryRules(ctx, `SELECT id, name, expression, enabled, created_at FROM alert_rules WHERE enabled ORDER BY created_at, id`)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, r := range all {
+		expr, err := Parse(r.Expression)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("rule %s (%s): %w", r.ID, r.Name, err))
+			continue
+		}
+		rules = append(rules, r)
+		exprs = append(exprs, expr)
+	}
+	return rules, exprs, invalid, nil
+}
+
+// loadWatchlists returns the tickers of the watchlists ids.
+func (s *Store) loadWatchlists(ctx context.Context, ids []string) (Watchlists, error) {
+	w := Watchlists{}
+	var valid []string
+	for _, id := range ids {
+		w[id] = map[string]bool{}
+		if uuidPattern.MatchString(id) {
+			valid = append(valid, id)
+		}
+	}
+	if len(valid) == 0 {
+		return w, nil
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT watchlist_id::TEXT, ticker FROM watchlist_tickers WHERE watchlist_id = ANY($1::UUID[])
+	`, pq.Array(valid))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, ticker string
+		if err := rows.Scan(&id, &ticker); err != nil {
+			return nil, err
+		}
+		w[id][ticker] = true
+	}
+	return w, rows.Err()
+}
+
+// insertAlerts stores alerts, skipping the ones already fired for the same rule and
+// event, and returns the ones inserted with their ids.
+func (s *Store) insertAlerts(ctx context.Context, alerts []Alert) ([]Alert, error) {
+	var inserted []Alert
+	for _, a := range alerts {
+		event, err := json.Marshal(a.Event)
+		if err != nil {
+			return inserted, err
+		}
+		err = s.DB.QueryRowContext(ctx, `
+			INSERT INTO alerts (rule_id, ticker, time, event) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (rule_id, ticker, time) DO NOTHING
+			RETURNING id, fired_at
+		`, a.RuleID, a.Event.Ticker, a.Event.Time, string(event)).Scan(&a.ID, &a.FiredAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // already fired
+		}
+		if err != nil {
+			return inserted, err
+		}
+		inserted = append(inserted, a)
+	}
+	return inserted, nil
+}
+
+func (s *Store) queryRules(ctx context.Context, query string, args ...any) ([]Rule, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		var r Rule
+		if err := rows.Scan(&r.ID, &r.Name, &r.Expression, &r.Enabled, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+const (
+	// maxNameLength is the maximum length of the name of a key.
+	maxNameLength = 100
+
+	defaultUsageDays = 30
+	maxUsageDays     = 366
+)
+
+// Handler serves the /admin/keys endpoints.
+type Handler struct {
+	Store *Store
+	Auth  *Authenticator // nil when authentication is disabled
+}
+
+// CreatedKey is the response of CreateKey, the only one with the key itself.
+type CreatedKey struct {
+	Key
+	Secret string `json:"key"`
+}
+
+type keyRequest struct {
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	DailyQuota *int64   `json:"daily_quota"` // 0 for unlimited, missing for the default
+}
+
+// ListKeys answers with every key, including the revoked ones, and their usage.
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.Store.ListKeys(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "Failed to list API keys", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// CreateKey creates a key from {"name": "...", "scopes": ["read"], "daily_quota": 10000}.
+// The response is the only one that includes the key.
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req keyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	var errs []problem.FieldError
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		errs = append(errs, problem.FieldError{Field: "name", Code: problem.FieldRequired, Message: "is required"})
+	} else if len(name) > maxNameLength {
+		errs = append(errs, problem.FieldError{Field: "name", Code: problem.FieldOutOfRange, Message: fmt.Sprintf("must be at most %d characters", maxNameLength)})
+	}
+	scopes, err := ParseScopes(strings.Join(req.Scopes, ","))
+	if err != nil {
+		errs = append(errs, problem.FieldError{Field: "scopes", Code: problem.FieldInvalid, Message: err.Error()})
+	}
+	if req.DailyQuota != nil && *req.DailyQuota < 0 {
+		errs = append(errs, problem.FieldError{Field: "daily_quota", Code: problem.FieldOutOfRange, Message: "must be 0 (unlimited) or positive"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, errs...)
+		return
+	}
+
+	key, secret, err := h.Store.CreateKey(r.Context(), name, scopes, req.DailyQuota)
+	if err != nil {
+		problem.Internal(w, r, "Failed to create API key", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, CreatedKey{Key: *key, Secret: secret})
+}
+
+// GetKey answers with a key and its usage, without the key itself.
+func (h *Handler) GetKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.Store.GetKey(r.Context(), r.PathValue("id"))
+	if err != nil {
+		problem.FromError(w, r, err, "API key not found", "Failed to get API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// RevokeKey revokes a key. It's kept, with its usage, in the list of keys.
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.Store.RevokeKey(r.Context(), r.PathValue("id"))
+	if err != nil {
+		problem.FromError(w, r, err, "API key not found", "Failed to revoke API key")
+		return
+	}
+	if h.Auth != nil {
+		h.Auth.Forget(key.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetKeyUsage answers with the requests of a key per UTC day, newest first, for the
+// last ?days= days (30 by default).
+func (h *Handler) GetKeyUsage(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	days := p.Int("days", defaultUsageDays, 1, maxUsageDays)
+	if !p.Check(w, r) {
+		return
+	}
+
+	usage, err := h.Store.Usage(r.Context(), r.PathValue("id"), days)
+	if err != nil {
+		problem.FromError(w, r, err, "API key not found", "Failed to get API key usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
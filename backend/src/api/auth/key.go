@@ -0,0 +1,91 @@
+// Package auth authenticates the HTTP API with API keys sent as "Authorization: Bearer
+// <key>". Keys are stored hashed in the "api_keys" table and grant scopes, checked per
+// route by the middleware of an Authenticator.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes of a key.
+const (
+	ScopeRead       = "read"       // the GET endpoints of the data: stocks, recommendations, watchlists...
+	ScopeWatchlists = "watchlists" // creating, editing and deleting the watchlists, e.g. from the frontend
+	ScopeETL        = "etl"        // the status of the ETL and its failed items, to monitor it
+	ScopeAdmin      = "admin"      // everything, including the other changes and the /admin endpoints
+)
+
+// Scopes lists the valid scopes.
+var Scopes = []string{ScopeRead, ScopeWatchlists, ScopeETL, ScopeAdmin}
+
+// keyPrefix starts every key, so leaked keys are easy to spot.
+const keyPrefix = "sr_"
+
+// Key is an API key (api_keys table). The key itself is only known when it's created.
+type Key struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Prefix       string   `json:"prefix"` // first characters of the key
+	Scopes       []string `json:"scopes"`
+	DailyQuota   *int64   `json:"daily_quota,omitempty"` // nil for the default of the server
+	RequestCount int64    `json:"request_count"`
+	// RequestsToday is the usage in the current UTC day when the key was read; the
+	// requests of the last seconds may not be written yet.
+	RequestsToday int64      `json:"requests_today"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether k grants scope. The admin scope grants every scope.
+func (k *Key) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// ParseScopes parses a comma separated list of scopes, e.g. "read,etl". The result
+// is sorted and without duplicates.
+func ParseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" {
+			continue
+		}
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, expected %s", scope, strings.Join(Scopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required: %s", strings.Join(Scopes, ", "))
+	}
+	slices.Sort(scopes)
+	return scopes, nil
+}
+
+// newKey generates a key: keyPrefix followed by 32 random bytes in base64url.
+func newKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashKey is the hash stored for key. Keys are random, so a plain SHA-256 is enough.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// displayPrefix is the part of key stored to tell the keys apart.
+func displayPrefix(key string) string {
+	return key[:min(len(key), len(keyPrefix)+6)]
+}
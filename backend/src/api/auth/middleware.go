@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+const (
+	// keyCacheTTL is how long a valid key is trusted without reading it again, so a key
+	// revoked in another replica keeps working here for up to this long.
+	keyCacheTTL = 30 * time.Second
+	// DefaultUsageFlushInterval is how often the usage counters are written by default.
+	DefaultUsageFlushInterval = 10 * time.Second
+)
+
+type contextKey struct{}
+
+// FromContext returns the key that authenticated the request, nil if there's none.
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(contextKey{}).(*Key)
+	return k
+}
+
+// Authenticator checks the API keys of the requests, counts their usage and enforces
+// their daily quotas.
+type Authenticator struct {
+	// DailyQuota is the number of requests per UTC day of the keys without a quota of
+	// their own; 0 means unlimited.
+	DailyQuota int64
+
+	lookup    func(ctx context.Context, secret string) (*Key, error)
+	saveUsage func(ctx context.Context, id string, requests int64, lastUsed time.Time) error
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedKey // by hash of the key
+	usage map[usageKey]*usage  // not written yet
+	today map[string]*dayUsage // by key id, to check the quotas
+}
+
+type cachedKey struct {
+	key     *Key
+	expires time.Time
+}
+
+type usageKey struct {
+	id  string
+	day string // YYYY-MM-DD, UTC
+}
+
+type usage struct {
+	requests int64
+	lastUsed time.Time
+}
+
+// dayUsage is the usage of a key in a day, as read with the key plus the requests
+// counted since. Requests to other replicas since the key was read are missing, so
+// a quota can be exceeded by up to their share for keyCacheTTL.
+type dayUsage struct {
+	day      string
+	requests int64
+}
+
+// NewAuthenticator returns an Authenticator of the keys of store.
+func NewAuthenticator(store *Store) *Authenticator {
+	return &Authenticator{lookup: store.Authenticate, saveUsage: store.addUsage, now: time.Now}
+}
+
+// Authenticate is a middleware that rejects the requests without a valid key with 401,
+// and adds the key to the context of the others. The key is read from the header
+// "Authorization: Bearer <key>"; see QueryToken for the routes that accept it in the
+// URL.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := bearerToken(r)
+		if !ok {
+			unauthorized(w, r, `Bearer realm="api"`, "Missing API key")
+			return
+		}
+		key, err := a.key(r.Context(), secret)
+		if errors.Is(err, ErrInvalidKey) {
+			unauthorized(w, r, `Bearer realm="api", error="invalid_token"`, "Invalid API key")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, "Failed to check the API key", err)
+			return
+		}
+		if retryAfter, ok := a.count(key); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeQuotaExceeded, "Daily quota of the API key exceeded")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, key)))
+	})
+}
+
+// Require returns a middleware that rejects with 403 the requests whose key doesn't
+// grant scope. It must run after Authenticate.
+func (a *Authenticator) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := FromContext(r.Context())
+			if key == nil {
+				unauthorized(w, r, `Bearer realm="api"`, "Missing API key")
+				return
+			}
+			if !key.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="api", error="insufficient_scope", scope=%q`, scope))
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf("The API key lacks the %s scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Forget drops the key id from the cache, so its revocation applies right away here.
+func (a *Authenticator) Forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, c := range a.cache {
+		if c.key.ID == id {
+			delete(a.cache, hash)
+		}
+	}
+}
+
+// Run writes the usage counters every interval until ctx is done, and once more then.
+func (a *Authenticator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, give the last write its own time
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			a.flush(flushCtx)
+			return
+		case <-ticker.C:
+			a.flush(ctx)
+		}
+	}
+}
+
+// key returns the key whose value is secret, from the cache if possible.
+func (a *Authenticator) key(ctx context.Context, secret string) (*Key, error) {
+	hash := hashKey(secret)
+	now := a.now()
+	a.mu.Lock()
+	c, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.key, nil
+	}
+
+	key, err := a.lookup(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cache == nil {
+		a.cache = map[string]cachedKey{}
+		a.today = map[string]*dayUsage{}
+	}
+	a.cache[hash] = cachedKey{key: key, expires: now.Add(keyCacheTTL)}
+	// the stored usage, plus the requests counted here and not written yet
+	day := now.UTC().Format(time.DateOnly)
+	requests := key.RequestsToday
+	if u, ok := a.usage[usageKey{key.ID, day}]; ok {
+		requests += u.requests
+	}
+	a.today[key.ID] = &dayUsage{day: day, requests: requests}
+	return key, nil
+}
+
+// count adds a request to the usage of key, unless it exceeds its daily quota. Then it
+// returns how long until the quota is reset.
+func (a *Authenticator) count(key *Key) (time.Duration, bool) {
+	now := a.now().UTC()
+	day := now.Format(time.DateOnly)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.today == nil {
+		a.today = map[string]*dayUsage{}
+	}
+	today, ok := a.today[key.ID]
+	if !ok || today.day != day {
+		today = &dayUsage{day: day}
+		a.today[key.ID] = today
+	}
+	quota := a.DailyQuota
+	if key.DailyQuota != nil {
+		quota = *key.DailyQuota
+	}
+	if quota > 0 && today.requests >= quota {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return midnight.Sub(now), false
+	}
+	today.requests++
+
+	if a.usage == nil {
+		a.usage = map[usageKey]*usage{}
+	}
+	u, ok := a.usage[usageKey{key.ID, day}]
+	if !ok {
+		u = &usage{}
+		a.usage[usageKey{key.ID, day}] = u
+	}
+	u.requests++
+	u.lastUsed = now
+	return 0, true
+}
+
+// flush writes the usage counted since the last flush. Counters that fail to be
+// written are kept for the next one.
+func (a *Authenticator) flush(ctx context.Context) {
+	a.mu.Lock()
+	pending := a.usage
+	a.usage = nil
+	a.mu.Unlock()
+
+	for k, u := range pending {
+		if err := a.saveUsage(ctx, k.id, u.requests, u.lastUsed); err != nil {
+			slog.ErrorContext(ctx, "Failed to save API key usage", "key", k.id, "error", err)
+			a.mu.Lock()
+			if a.usage == nil {
+				a.usage = map[usageKey]*usage{}
+			}
+			if current, ok := a.usage[k]; ok {
+				current.requests += u.requests
+				if u.lastUsed.After(current.lastUsed) {
+					current.lastUsed = u.lastUsed
+				}
+			} else {
+				a.usage[k] = u
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// bearerToken returns the key sent by the client.
+func bearerToken(r *http.Request) (string, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		token = strings.TrimSpace(token)
+		return token, token != ""
+	}
+	return "", false
+}
+
+// QueryToken is a middleware for the GET routes used by clients that can't set
+// headers, like EventSource: it takes the key of the requests without an
+// Authorization header from the access_token query parameter. It must run before
+// Authenticate. Keys in URLs end up in access logs and browser history, so the rest
+// of the routes only read the header.
+func QueryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Authorization") == "" {
+			if token := r.URL.Query().Get("access_token"); token != "" {
+				r = r.Clone(r.Context())
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge, msg string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, msg)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuthenticatorScopes(t *testing.T) {
+	keys := map[string]*Key{
+		"sr_reader": {ID: "1", Scopes: []string{ScopeRead}},
+		"sr_admin":  {ID: "2", Scopes: []string{ScopeAdmin}},
+	}
+	lookups := 0
+	a := &Authenticator{now: time.Now, lookup: func(ctx context.Context, secret string) (*Key, error) {
+		lookups++
+		if k, ok := keys[secret]; ok {
+			return k, nil
+		}
+		return nil, ErrInvalidKey
+	}}
+	handler := a.Authenticate(a.Require(ScopeETL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) == nil {
+			t.Error("FromContext() = nil in an authenticated request")
+		}
+	})))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		header string
+		code   int
+	}{
+		{"no key", http.MethodGet, "/", "", http.StatusUnauthorized},
+		{"other scheme", http.MethodGet, "/", "Basic c3JfYWRtaW4=", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/", "Bearer sr_nope", http.StatusUnauthorized},
+		{"missing scope", http.MethodGet, "/", "Bearer sr_reader", http.StatusForbidden},
+		{"admin grants every scope", http.MethodGet, "/", "Bearer sr_admin", http.StatusOK},
+		{"scheme ignores case", http.MethodGet, "/", "bearer sr_admin", http.StatusOK},
+		{"query parameter", http.MethodGet, "/?access_token=sr_admin", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d; want %d", tt.name, rec.Code, tt.code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.name)
+		}
+	}
+
+	// the admin key was looked up once and then cached
+	if lookups != 3 {
+		t.Errorf("lookups = %d; want 3", lookups)
+	}
+	a.Forget("2")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer sr_admin")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if lookups != 4 {
+		t.Errorf("lookups after Forget = %d; want 4", lookups)
+	}
+}
+
+func TestQueryToken(t *testing.T) {
+	a := &Authenticator{now: time.Now, lookup: func(ctx context.Context, secret string) (*Key, error) {
+		if secret == "sr_admin" {
+			return &Key{ID: "1", Scopes: []string{ScopeAdmin}}, nil
+		}
+		return nil, ErrInvalidKey
+	}}
+	handler := QueryToken(a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		header string
+		code   int
+	}{
+		{"query parameter", http.MethodGet, "/?access_token=sr_admin", "", http.StatusOK},
+		{"header first", http.MethodGet, "/?access_token=sr_admin", "Bearer sr_nope", http.StatusUnauthorized},
+		{"only for GET", http.MethodPost, "/?access_token=sr_admin", "", http.StatusUnauthorized},
+		{"no key", http.MethodGet, "/", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestAuthenticatorUsage(t *testing.T) {
+	saved := map[string]int64{}
+	fail := true
+	a := &Authenticator{now: time.Now, saveUsage: func(ctx context.Context, id string, requests int64, lastUsed time.Time) error {
+		if fail {
+			return context.DeadlineExceeded
+		}
+		saved[id] += requests
+		return nil
+	}}
+	one, two := &Key{ID: "1"}, &Key{ID: "2"}
+	a.count(one)
+	a.count(one)
+	a.count(two)
+
+	a.flush(context.Background()) // kept for the next flush
+	a.count(one)
+	fail = false
+	a.flush(context.Background())
+
+	if want := map[string]int64{"1": 3, "2": 1}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved usage = %v; want %v", saved, want)
+	}
+}
+
+func TestAuthenticatorDailyQuota(t *testing.T) {
+	now := time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC)
+	a := &Authenticator{DailyQuota: 3, now: func() time.Time { return now }}
+	five, unlimited := int64(5), int64(0)
+	tests := []struct {
+		key     *Key
+		allowed int
+	}{
+		{&Key{ID: "default"}, 3},
+		{&Key{ID: "own quota", DailyQuota: &five}, 5},
+		{&Key{ID: "unlimited", DailyQuota: &unlimited}, 10},
+	}
+	for _, tt := range tests {
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			retryAfter, ok := a.count(tt.key)
+			if ok {
+				allowed++
+			} else if retryAfter != time.Hour {
+				t.Errorf("%s: retry after %v; want 1h, until midnight UTC", tt.key.ID, retryAfter)
+			}
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d requests allowed; want %d", tt.key.ID, allowed, tt.allowed)
+		}
+	}
+
+	now = now.Add(time.Hour) // a new day
+	if _, ok := a.count(tests[0].key); !ok {
+		t.Error("request denied after the quota was reset")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      bool
+	}{
+		{"read", []string{"read"}, false},
+		{" ADMIN, read,read ", []string{"admin", "read"}, false},
+		{"watchlists,read", []string{"read", "watchlists"}, false},
+		{"", nil, true},
+		{"read,write", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseScopes(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseScopes(%q) error = %v; want error: %v", tt.input, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseScopes(%q) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
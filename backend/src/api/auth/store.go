@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// uuidPattern matches the ids of keys. Other ids can't exist, and are reported as not
+// found instead of as a failed cast in the database.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ErrInvalidKey is returned by Authenticate for unknown and revoked keys.
+var ErrInvalidKey = errors.New("invalid or revoked API key")
+
+// Store reads and writes the API keys. Methods on a key that doesn't exist return an
+// error wrapping sql.ErrNoRows.
+type Store struct {
+	DB *sql.DB
+}
+
+func keyNotFound(id string) error {
+	return fmt.Errorf("API key %q: %w", id, sql.ErrNoRows)
+}
+
+const (
+	keyColumns = `id, name, prefix, scopes, request_count, last_used_at, created_at, revoked_at, daily_quota`
+	// requestsToday is the usage of the key in the current UTC day.
+	requestsToday = `COALESCE((SELECT requests FROM api_key_usage u WHERE u.key_id = api_keys.id AND u.day = current_date()), 0)`
+)
+
+// DailyUsage is the number of requests of a key in a UTC day.
+type DailyUsage struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Requests int64  `json:"requests"`
+}
+
+// CreateKey creates a key with the given scopes and daily quota (nil for the default
+// of the server) and returns it, with the key itself, which isn't stored and can't be
+// recovered later.
+func (s *Store) CreateKey(ctx context.Context, name string, scopes []string, dailyQuota *int64) (*Key, string, error) {
+	secret := newKey()
+	keys, err := s.queryKeys(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, daily_quota)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+keyColumns+`, 0`, name, displayPrefix(secret), hashKey(secret), pq.Array(scopes), dailyQuota)
+	if err != nil {
+		return nil, "", err
+	}
+	return &keys[0], secret, nil
+}
+
+// ListKeys returns every key, including the revoked ones, oldest first.
+func (s *Store) ListKeys(ctx context.Context) ([]Key, error) {
+	return s.queryKeys(ctx, `SELECT `+keyColumns+`, `+requestsToday+` FROM api_keys ORDER BY created_at, id`)
+}
+
+// GetKey returns the key id.
+func (s *Store) GetKey(ctx context.Context, id string) (*Key, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, keyNotFound(id)
+	}
+	keys, err := s.queryKeys(ctx, `SELECT `+keyColumns+`, `+requestsToday+` FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, keyNotFound(id)
+	}
+	return &keys[0], nil
+}
+
+// RevokeKey revokes the key id. Revoking a revoked key keeps its first revocation time.
+func (s *Store) RevokeKey(ctx context.Context, id string) (*Key, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, keyNotFound(id)
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, keyNotFound(id)
+	}
+	return s.GetKey(ctx, id)
+}
+
+// Usage returns the requests of the key id in each of the last days UTC days that
+// had any, newest first.
+func (s *Store) Usage(ctx context.Context, id string, days int) ([]DailyUsage, error) {
+	if _, err := s.GetKey(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT day::STRING, requests FROM api_key_usage
+		WHERE key_id = $1 AND day > current_date() - $2::INT8
+		ORDER BY day DESC`, id, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []DailyUsage{}
+	for rows.Next() {
+		var u DailyUsage
+		if err := rows.Scan(&u.Day, &u.Requests); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// Authenticate returns the key whose value is secret, or ErrInvalidKey if it doesn't
+// exist or is revoked.
+func (s *Store) Authenticate(ctx context.Context, secret string) (*Key, error) {
+	keys, err := s.queryKeys(ctx, `SELECT `+keyColumns+`, `+requestsToday+` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hashKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrInvalidKey
+	}
+	return &keys[0], nil
+}
+
+// addUsage adds requests made in the UTC day of lastUsed to the counters of the key id.
+func (s *Store) addUsage(ctx context.Context, id string, requests int64, lastUsed time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO api_key_usage (key_id, day, requests) VALUES ($1, $2::DATE, $3)
+		ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + excluded.requests`,
+		id, lastUsed.UTC().Format(time.DateOnly), requests)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE api_keys
+		SET request_count = request_count + $2, last_used_at = GREATEST(COALESCE(last_used_at, $3), $3)
+		WHERE id = $1`, id, requests, lastUsed)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) queryKeys(ctx context.Context, query string, args ...any) ([]Key, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		var k Key
+		var lastUsed, revoked sql.NullTime
+		var quota sql.NullInt64
+		err := rows.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.RequestCount, &lastUsed, &k.CreatedAt, &revoked,
+			&quota, &k.RequestsToday)
+		if err != nil {
+			return nil, err
+		}
+		if quota.Valid {
+			k.DailyQuota = &quota.Int64
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			k.RevokedAt = &revoked.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+
+	"vue_go_cockroachdb/src/api/openapi"
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/models"
+)
+
+// loadSpec loads and validates the OpenAPI document.
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec())
+	if err != nil {
+		t.Fatalf("loading the OpenAPI document: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+// TestRoutesDocumented checks that every route of the router is in the OpenAPI
+// document, and every operation of the document is routed.
+func TestRoutesDocumented(t *testing.T) {
+	doc := loadSpec(t)
+	routed := map[string]bool{}
+	err := chi.Walk(NewRouter(Handlers{}).(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+route] = true
+		if route == "/openapi.json" || route == "/metrics" {
+			return nil
+		}
+		item := doc.Paths.Value(route)
+		if item == nil || item.GetOperation(method) == nil {
+			t.Errorf("%s %s is not in the OpenAPI document", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !routed[method+" "+path] {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+}
+
+// TestContract runs requests through the router, with an in-memory repository, and
+// validates the responses against the OpenAPI document.
+func TestContract(t *testing.T) {
+	doc := loadSpec(t)
+	specRouter, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the exports are checked as opaque strings
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.PlainBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/vnd.apache.parquet", openapi3filter.FileBodyDecoder)
+	repo := newContractRepo()
+	searcher := search.NewSearcher(repo)
+	stocksHandler := stocks.NewHandler(repo)
+	stocksHandler.Search = searcher
+	handler := NewRouter(Handlers{
+		Stocks: stocksHandler,
+		Search: &search.Handler{Searcher: searcher},
+	})
+	watchlist := repo.watched
+	missing := "00000000-0000-4000-8000-999999999999"
+
+	tests := []struct {
+		method, url, body string
+		code              int
+	}{
+		{"GET", "/stocks", "", http.StatusOK},
+		{"GET", "/stocks?search=ak&sort_by=target_to&order=asc&page=1&limit=2", "", http.StatusOK},
+		{"GET", "/stocks?page=9", "", http.StatusOK},
+		{"GET", "/stocks?watchlist=" + watchlist, "", http.StatusOK},
+		{"GET", "/stocks?watchlist=" + missing, "", http.StatusNotFound},
+		{"GET", "/stocks?sort_by=score", "", http.StatusBadRequest},
+		{"GET", "/stocks?limit=1000", "", http.StatusBadRequest},
+		{"GET", "/stocks/AKBA", "", http.StatusOK},
+		{"GET", "/stocks/MRNA", "", http.StatusOK},
+		{"GET", "/stocks/NOPE", "", http.StatusNotFound},
+		{"GET", "/stocks/FAIL", "", http.StatusInternalServerError},
+		{"GET", "/recommendations", "", http.StatusOK},
+		{"GET", "/recommendations?limit=1&minimum_score=9.5", "", http.StatusOK},
+		{"GET", "/recommendations?minimum_score=-1", "", http.StatusBadRequest},
+		{"GET", "/stocks/export?search=ak&sort_by=ticker&order=asc", "", http.StatusOK},
+		{"GET", "/stocks/export?format=ndjson&watchlist=" + watchlist, "", http.StatusOK},
+		{"GET", "/stocks/export?format=parquet", "", http.StatusOK},
+		{"GET", "/stocks/export?format=xlsx", "", http.StatusBadRequest},
+		{"GET", "/stocks/export?watchlist=" + missing, "", http.StatusNotFound},
+		{"GET", "/recommendations/export?minimum_score=9", "", http.StatusOK},
+		{"GET", "/recommendations/export?format=parquet&minimum_score=100", "", http.StatusOK},
+		{"GET", "/recommendations/export?minimum_score=-1", "", http.StatusBadRequest},
+		{"GET", "/stocks?search=akebia%20therap", "", http.StatusOK},
+		{"GET", "/stocks?search=zzzz", "", http.StatusOK},
+		{"GET", "/search/suggest?q=ak", "", http.StatusOK},
+		{"GET", "/search/suggest?q=modrna&limit=1", "", http.StatusOK},
+		{"GET", "/search/suggest", "", http.StatusBadRequest},
+		{"GET", "/search/suggest?q=ak&limit=0", "", http.StatusBadRequest},
+		{"GET", "/sectors", "", http.StatusOK},
+		{"GET", "/sectors?window=365d&top=1", "", http.StatusOK},
+		{"GET", "/sectors?window=week", "", http.StatusBadRequest},
+		{"GET", "/sectors/health%20care/recommendations?window=12h", "", http.StatusOK},
+		{"GET", "/sectors/Nope/recommendations", "", http.StatusNotFound},
+		{"GET", "/stats", "", http.StatusOK},
+		{"GET", "/stats?watchlist=" + watchlist, "", http.StatusOK},
+		{"GET", "/watchlists", "", http.StatusOK},
+		{"POST", "/watchlists", `{"name": "Pharma", "tickers": ["mrna", "AKBA"]}`, http.StatusCreated},
+		{"POST", "/watchlists", `{"name": "", "tickers": ["not a ticker"]}`, http.StatusBadRequest},
+		{"POST", "/watchlists", `{"name": 7}`, http.StatusBadRequest},
+		{"GET", "/watchlists/" + watchlist, "", http.StatusOK},
+		{"GET", "/watchlists/" + missing, "", http.StatusNotFound},
+		{"PATCH", "/watchlists/" + watchlist, `{"name": "Biotech"}`, http.StatusOK},
+		{"GET", "/watchlists/" + watchlist + "/tickers", "", http.StatusOK},
+		{"POST", "/watchlists/" + watchlist + "/tickers", `{"tickers": ["MRNA"]}`, http.StatusOK},
+		{"DELETE", "/watchlists/" + watchlist + "/tickers/MRNA", "", http.StatusOK},
+		{"DELETE", "/watchlists/" + watchlist, "", http.StatusNoContent},
+		{"DELETE", "/watchlists/" + watchlist, "", http.StatusNotFound},
+		{"GET", "/alerts", "", http.StatusServiceUnavailable},
+		{"POST", "/admin/etl/run", "", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		name := tt.method + " " + tt.url
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s = %d; want %d: %s", name, rec.Code, tt.code, rec.Body.String())
+			continue
+		}
+
+		route, pathParams, err := specRouter.FindRoute(httptest.NewRequest(tt.method, "http://localhost:8080"+tt.url, nil))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route},
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+		})
+		if err != nil {
+			t.Errorf("%s: the response doesn't match the OpenAPI document: %v\n%s", name, err, rec.Body.String())
+			continue
+		}
+		if unknown := undeclaredFields(t, route, rec); len(unknown) > 0 {
+			t.Errorf("%s: fields not in the OpenAPI document: %v", name, unknown)
+		}
+	}
+}
+
+// undeclaredFields returns the fields of the JSON response in rec that its schema
+// doesn't declare, which ValidateResponse accepts.
+func undeclaredFields(t *testing.T, route *routers.Route, rec *httptest.ResponseRecorder) []string {
+	response := route.Operation.Responses.Status(rec.Code)
+	if response == nil || rec.Body.Len() == 0 {
+		return nil
+	}
+	contentType := strings.Split(rec.Header().Get("Content-Type"), ";")[0]
+	mediaType := response.Value.Content.Get(contentType)
+	if mediaType == nil || (contentType != "application/json" && !strings.HasSuffix(contentType, "+json")) {
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+	}
+	var unknown []string
+	walkUndeclared(mediaType.Schema.Value, body, "", &unknown)
+	return unknown
+}
+
+func walkUndeclared(schema *openapi3.Schema, v any, path string, unknown *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		properties := map[string]*openapi3.Schema{}
+		collectProperties(schema, properties)
+		for key, value := range v {
+			if s, ok := properties[key]; ok {
+				walkUndeclared(s, value, path+"."+key, unknown)
+			} else if schema.AdditionalProperties.Schema != nil {
+				walkUndeclared(schema.AdditionalProperties.Schema.Value, value, path+"."+key, unknown)
+			} else if len(properties) > 0 {
+				*unknown = append(*unknown, path+"."+key)
+			}
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range v {
+				walkUndeclared(schema.Items.Value, item, fmt.Sprintf("%s[%d]", path, i), unknown)
+			}
+		}
+	}
+}
+
+func collectProperties(schema *openapi3.Schema, properties map[string]*openapi3.Schema) {
+	for name, p := range schema.Properties {
+		properties[name] = p.Value
+	}
+	for _, s := range schema.AllOf {
+		collectProperties(s.Value, properties)
+	}
+}
+
+// TestFrontendModels checks the TypeScript models of the frontend against the schemas
+// of the OpenAPI document: every field must be documented, the required ones must be
+// required, and the ones that can be null must be nullable.
+func TestFrontendModels(t *testing.T) {
+	doc := loadSpec(t)
+	models := map[string]string{ // file: schema
+		"stock.ts":          "Stock",
+		"recommendation.ts": "StockWithScore",
+	}
+	interfaceField := regexp.MustCompile(`^\s*(\w+)(\??):\s*([^;]+);`)
+
+	for file, schemaName := range models {
+		src, err := os.ReadFile(filepath.Join("..", "..", "..", "frontend", "src", "models", file))
+		if errors.Is(err, os.ErrNotExist) {
+			t.Skip("the frontend is not next to the backend")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		properties := map[string]*openapi3.Schema{}
+		required := map[string]bool{}
+		schema := doc.Components.Schemas[schemaName].Value
+		collectProperties(schema, properties)
+		for _, s := range append([]*openapi3.SchemaRef{{Value: schema}}, schema.AllOf...) {
+			for _, name := range s.Value.Required {
+				required[name] = true
+			}
+		}
+
+		for _, line := range strings.Split(string(src), "\n") {
+			m := interfaceField.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			field, optional, tsType := m[1], m[2] == "?", m[3]
+			p, ok := properties[field]
+			switch {
+			case !ok:
+				t.Errorf("%s: %s is not in the %s schema", file, field, schemaName)
+			case !optional && !required[field]:
+				t.Errorf("%s: %s is required in TypeScript but not in the %s schema", file, field, schemaName)
+			case strings.Contains(tsType, "null") != p.Nullable:
+				t.Errorf("%s: %s is %q in TypeScript but nullable=%v in the %s schema", file, field, tsType, p.Nullable, schemaName)
+			}
+		}
+	}
+}
+
+// contractRepo is the in-memory StockRepository with a few stocks and the watchlist
+// watched, for the contract tests. The ticker FAIL fails with an internal error.
+type contractRepo struct {
+	*stocks.MemoryStockRepository
+	watched string
+}
+
+func newContractRepo() *contractRepo {
+	at := time.Date(2025, 6, 3, 0, 30, 0, 0, time.UTC)
+	stock := func(ticker, company, action, from, to string, targetFrom, targetTo float64, score float64) models.StockWithScore {
+		s := models.StockWithScore{
+			Stock: models.Stock{Ticker: ticker, Company: company, Brokerage: "BMO Capital Markets", Action: action,
+				RatingFrom: from, RatingTo: to, TargetCurrency: "USD", Time: at},
+			RecommendationScore: score,
+		}
+		if targetTo > 0 {
+			s.TargetFrom = models.NewPrice(decimal.NewFromFloat(targetFrom))
+			s.TargetTo = models.NewPrice(decimal.NewFromFloat(targetTo))
+		}
+		at = at.Add(-time.Hour)
+		return s
+	}
+	r := &contractRepo{MemoryStockRepository: stocks.NewMemoryStockRepository()}
+	r.Add(
+		stock("AKBA", "Akebia Therapeutics", models.ActionUpgraded, "Hold", "Buy", 4, 6, 9.7),
+		stock("MRNA", "Moderna", models.ActionInitiated, "", "Neutral", 0, 0, 0),
+		stock("AKAM", "Akamai", models.ActionTargetLowered, "Outperform", "Outperform", 130, 120.5, 5.25),
+	)
+	r.AddCompanies(models.Company{Ticker: "AKBA", Name: "Akebia Therapeutics", Exchange: "NASDAQ", Sector: "Health Care", Industry: "Biotechnology"})
+	w, _ := r.CreateWatchlist(context.Background(), "Watched", []string{"AKBA"})
+	r.watched = w.ID
+	return r
+}
+
+func (r *contractRepo) GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error) {
+	if ticker == "FAIL" {
+		return nil, errors.New("pq: relation \"stocks\" does not exist")
+	}
+	return r.MemoryStockRepository.GetStockByTicker(ctx, ticker)
+}
@@ -0,0 +1,138 @@
+// Package metrics exposes the Prometheus metrics of the HTTP API: the requests and
+// their latency by chi route pattern, the statistics of the database pool and the
+// duration of the queries of the stock repository. Other packages, like the ETL,
+// register their metrics in the same Registry.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute is the route label of the requests that match no endpoint, so
+// scans of random paths don't create a series each.
+const unmatchedRoute = "unmatched"
+
+// otherMethod is the method label of the requests with a method outside the standard
+// ones, so clients sending arbitrary methods don't create a series each.
+const otherMethod = "OTHER"
+
+// streamContentType is the content type of the responses that stay open, like
+// /events/stream. Their duration is observed apart, in http_stream_duration_seconds,
+// so it doesn't skew the latency of the other requests.
+const streamContentType = "text/event-stream"
+
+// Metrics holds the metrics of a server and the Registry serving them.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	handler  http.Handler
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	streams  *prometheus.HistogramVec
+	queries  *prometheus.HistogramVec
+}
+
+// New returns the metrics of the HTTP API in a new Registry, with the metrics of the
+// Go runtime and the process.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests answered, by method, route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of the HTTP requests, by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		streams: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_stream_duration_seconds",
+			Help:    "Duration of the streamed (text/event-stream) responses, by route pattern.",
+			Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 7200, 14400, 28800},
+		}, []string{"route"}),
+		queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_query_duration_seconds",
+			Help:    "Duration of the queries of the stock repository, by method and result (ok or error).",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "result"}),
+	}
+	m.handler = promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.latency, m.streams, m.queries,
+	)
+	return m
+}
+
+// RegisterDB adds the statistics of the connection pool of db (sql.DB.Stats), as the
+// go_sql_* metrics labeled db_name=name.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Serve answers with the metrics of the Registry in the Prometheus text format.
+func (m *Metrics) Serve(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// Middleware counts the requests and observes their latency by the chi route pattern
+// they matched, like /stocks/{ticker}, so the tickers don't create a series each. It
+// must be used on the root router, before the routes are matched. Aborted responses,
+// like an export that failed midway, are counted with the status already sent. Methods
+// outside the standard ones are labeled OTHER, and the duration of streamed responses
+// goes to http_stream_duration_seconds instead of the latency.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			route := unmatchedRoute
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK // nothing written
+			}
+			method := methodLabel(r.Method)
+			m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			if strings.HasPrefix(ww.Header().Get("Content-Type"), streamContentType) {
+				m.streams.WithLabelValues(route).Observe(time.Since(start).Seconds())
+			} else {
+				m.latency.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// methodLabel returns the method label of a request with method.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// observeQuery records a query of the repository method started at start.
+func (m *Metrics) observeQuery(method string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.queries.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
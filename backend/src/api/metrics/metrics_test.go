@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/etl"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	etl.NewMetrics(m.Registry)
+	repo := m.Repository(stocks.NewMemoryStockRepository())
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/stocks/{ticker}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := repo.GetStockByTicker(r.Context(), chi.URLParam(r, "ticker")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	})
+	r.Get("/events/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": connected\n\n"))
+	})
+	r.Get("/metrics", m.Serve)
+	for _, path := range []string{"/stocks/AKBA", "/stocks/MRNA", "/no/such/path", "/events/stream"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO", "/stocks/AKBA", nil))
+	if _, err := repo.ListWatchlists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_requests_total{code="404",method="GET",route="/stocks/{ticker}"} 2`,
+		`http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`http_requests_total{code="405",method="OTHER",route="unmatched"} 1`,
+		`http_requests_total{code="200",method="GET",route="/events/stream"} 1`,
+		`http_stream_duration_seconds_count{route="/events/stream"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/stocks/{ticker}"} 2`,
+		`repository_query_duration_seconds_count{method="GetStockByTicker",result="error"} 2`,
+		`repository_query_duration_seconds_count{method="ListWatchlists",result="ok"} 1`,
+		`etl_failed_items_total{phase="transform"} 0`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics has no %s:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `http_request_duration_seconds_count{method="GET",route="/events/stream"}`) {
+		t.Errorf("/metrics observes the stream in the request latency:\n%s", body)
+	}
+}
@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/models"
+)
+
+// Repository returns repo observing the duration of its queries, by method: the
+// wrappers of StockReader, SectorReader, Exporter and WatchlistStore put together.
+func (m *Metrics) Repository(repo stocks.StockRepository) stocks.StockRepository {
+	return struct {
+		stocks.StockReader
+		stocks.SectorReader
+		stocks.Exporter
+		stocks.WatchlistStore
+	}{m.StockReader(repo), m.SectorReader(repo), m.Exporter(repo), m.WatchlistStore(repo)}
+}
+
+// StockReader returns repo observing the duration of its queries, by method.
+func (m *Metrics) StockReader(repo stocks.StockReader) stocks.StockReader {
+	return &stockReader{repo: repo, m: m}
+}
+
+type stockReader struct {
+	repo stocks.StockReader
+	m    *Metrics
+}
+
+func (r *stockReader) GetStocks(ctx context.Context, q stocks.StockQuery) ([]models.Stock, int, error) {
+	start := time.Now()
+	items, total, err := r.repo.GetStocks(ctx, q)
+	r.m.observeQuery("GetStocks", start, err)
+	return items, total, err
+}
+
+func (r *stockReader) GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error) {
+	start := time.Now()
+	s, err := r.repo.GetStockByTicker(ctx, ticker)
+	r.m.observeQuery("GetStockByTicker", start, err)
+	return s, err
+}
+
+func (r *stockReader) GetTopRecommendedStocks(ctx context.Context, q stocks.RecommendationQuery) ([]models.StockWithScore, error) {
+	start := time.Now()
+	items, err := r.repo.GetTopRecommendedStocks(ctx, q)
+	r.m.observeQuery("GetTopRecommendedStocks", start, err)
+	return items, err
+}
+
+func (r *stockReader) GetStats(ctx context.Context, watchlistID string) (*models.StockStats, error) {
+	start := time.Now()
+	stats, err := r.repo.GetStats(ctx, watchlistID)
+	r.m.observeQuery("GetStats", start, err)
+	return stats, err
+}
+
+func (r *stockReader) GetStockEvents(ctx context.Context, q stocks.StockQuery, afterSeq int64, limit int) ([]models.StockEvent, error) {
+	start := time.Now()
+	events, err := r.repo.GetStockEvents(ctx, q, afterSeq, limit)
+	r.m.observeQuery("GetStockEvents", start, err)
+	return events, err
+}
+
+func (r *stockReader) GetLatestIngestSeq(ctx context.Context) (int64, error) {
+	start := time.Now()
+	seq, err := r.repo.GetLatestIngestSeq(ctx)
+	r.m.observeQuery("GetLatestIngestSeq", start, err)
+	return seq, err
+}
+
+func (r *stockReader) GetDataVersion(ctx context.Context) (int64, error) {
+	start := time.Now()
+	version, err := r.repo.GetDataVersion(ctx)
+	r.m.observeQuery("GetDataVersion", start, err)
+	return version, err
+}
+
+func (r *stockReader) GetSearchActivity(ctx context.Context, recentSince time.Time) ([]search.Activity, error) {
+	start := time.Now()
+	activity, err := r.repo.GetSearchActivity(ctx, recentSince)
+	r.m.observeQuery("GetSearchActivity", start, err)
+	return activity, err
+}
+
+// SectorReader returns repo observing the duration of its queries, by method.
+func (m *Metrics) SectorReader(repo stocks.SectorReader) stocks.SectorReader {
+	return &sectorReader{repo: repo, m: m}
+}
+
+type sectorReader struct {
+	repo stocks.SectorReader
+	m    *Metrics
+}
+
+func (r *sectorReader) GetSectors(ctx context.Context, q stocks.SectorQuery) ([]models.SectorRollup, error) {
+	start := time.Now()
+	rollups, err := r.repo.GetSectors(ctx, q)
+	r.m.observeQuery("GetSectors", start, err)
+	return rollups, err
+}
+
+func (r *sectorReader) GetSectorRecommendations(ctx context.Context, q stocks.SectorQuery) ([]models.StockWithScore, error) {
+	start := time.Now()
+	items, err := r.repo.GetSectorRecommendations(ctx, q)
+	r.m.observeQuery("GetSectorRecommendations", start, err)
+	return items, err
+}
+
+// Exporter returns repo observing the duration of its exports, by method. The duration
+// includes sending their rows to the client.
+func (m *Metrics) Exporter(repo stocks.Exporter) stocks.Exporter {
+	return &exporter{repo: repo, m: m}
+}
+
+type exporter struct {
+	repo stocks.Exporter
+	m    *Metrics
+}
+
+func (r *exporter) ExportStocks(ctx context.Context, q stocks.StockQuery, each func(models.StockWithScore) error) error {
+	start := time.Now()
+	err := r.repo.ExportStocks(ctx, q, each)
+	r.m.observeQuery("ExportStocks", start, err)
+	return err
+}
+
+func (r *exporter) ExportRecommendations(ctx context.Context, q stocks.RecommendationQuery, each func(models.StockWithScore) error) error {
+	start := time.Now()
+	err := r.repo.ExportRecommendations(ctx, q, each)
+	r.m.observeQuery("ExportRecommendations", start, err)
+	return err
+}
+
+// WatchlistStore returns repo observing the duration of its queries, by method.
+func (m *Metrics) WatchlistStore(repo stocks.WatchlistStore) stocks.WatchlistStore {
+	return &watchlistStore{repo: repo, m: m}
+}
+
+type watchlistStore struct {
+	repo stocks.WatchlistStore
+	m    *Metrics
+}
+
+func (r *watchlistStore) ListWatchlists(ctx context.Context) ([]models.Watchlist, error) {
+	start := time.Now()
+	lists, err := r.repo.ListWatchlists(ctx)
+	r.m.observeQuery("ListWatchlists", start, err)
+	return lists, err
+}
+
+func (r *watchlistStore) GetWatchlist(ctx context.Context, id string) (*models.Watchlist, error) {
+	start := time.Now()
+	list, err := r.repo.GetWatchlist(ctx, id)
+	r.m.observeQuery("GetWatchlist", start, err)
+	return list, err
+}
+
+func (r *watchlistStore) CreateWatchlist(ctx context.Context, name string, tickers []string) (*models.Watchlist, error) {
+	start := time.Now()
+	list, err := r.repo.CreateWatchlist(ctx, name, tickers)
+	r.m.observeQuery("CreateWatchlist", start, err)
+	return list, err
+}
+
+func (r *watchlistStore) RenameWatchlist(ctx context.Context, id, name string) (*models.Watchlist, error) {
+	start := time.Now()
+	list, err := r.repo.RenameWatchlist(ctx, id, name)
+	r.m.observeQuery("RenameWatchlist", start, err)
+	return list, err
+}
+
+func (r *watchlistStore) DeleteWatchlist(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.repo.DeleteWatchlist(ctx, id)
+	r.m.observeQuery("DeleteWatchlist", start, err)
+	return err
+}
+
+func (r *watchlistStore) AddWatchlistTickers(ctx context.Context, id string, tickers []string) (*models.Watchlist, error) {
+	start := time.Now()
+	list, err := r.repo.AddWatchlistTickers(ctx, id, tickers)
+	r.m.observeQuery("AddWatchlistTickers", start, err)
+	return list, err
+}
+
+func (r *watchlistStore) RemoveWatchlistTicker(ctx context.Context, id, ticker string) (*models.Watchlist, error) {
+	start := time.Now()
+	list, err := r.repo.RemoveWatchlistTicker(ctx, id, ticker)
+	r.m.observeQuery("RemoveWatchlistTicker", start, err)
+	return list, err
+}
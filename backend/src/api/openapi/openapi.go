@@ -0,0 +1,24 @@
+// Package openapi has the OpenAPI 3 document of the HTTP API, served at /openapi.json.
+// It's the contract of the frontend with the backend: the contract tests of package api
+// check the responses of the handlers against it, so update it with the endpoints.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI document, as JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the OpenAPI document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(spec)
+}
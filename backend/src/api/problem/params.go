@@ -0,0 +1,148 @@
+package problem
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Params parses the query parameters of a request, collecting the error of each
+// invalid one instead of ignoring it:
+//
+//	p := problem.Query(r)
+//	page := p.Int("page", 1, 1, math.MaxInt)
+//	order := p.OneOf("order", "desc", "asc", "desc")
+//	if !p.Check(w, r) {
+//		return
+//	}
+type Params struct {
+	values url.Values
+	errs   []FieldError
+}
+
+// Query returns the Params of the query of r.
+func Query(r *http.Request) *Params {
+	return &Params{values: r.URL.Query()}
+}
+
+// Int returns the parameter name as an integer in [lo, hi], or def when it's missing.
+// hi is math.MaxInt for no upper bound.
+func (p *Params) Int(name string, def, lo, hi int) int {
+	s := strings.TrimSpace(p.values.Get(name))
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		p.Add(name, FieldInvalid, "must be an integer")
+		return def
+	}
+	if n < lo || n > hi {
+		if hi == math.MaxInt {
+			p.Add(name, FieldOutOfRange, fmt.Sprintf("must be at least %d", lo))
+		} else {
+			p.Add(name, FieldOutOfRange, fmt.Sprintf("must be between %d and %d", lo, hi))
+		}
+		return def
+	}
+	return n
+}
+
+// Float returns the parameter name as a finite number in [lo, hi], or def when it's
+// missing. hi is math.Inf(1) for no upper bound.
+func (p *Params) Float(name string, def, lo, hi float64) float64 {
+	s := strings.TrimSpace(p.values.Get(name))
+	if s == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		p.Add(name, FieldInvalid, "must be a number")
+		return def
+	}
+	if f < lo || f > hi {
+		if math.IsInf(hi, 1) {
+			p.Add(name, FieldOutOfRange, fmt.Sprintf("must be at least %g", lo))
+		} else {
+			p.Add(name, FieldOutOfRange, fmt.Sprintf("must be between %g and %g", lo, hi))
+		}
+		return def
+	}
+	return f
+}
+
+// Duration returns the parameter name as a duration in [lo, hi], or def when it's
+// missing. It's written as a Go duration ("36h", "90m") or in days ("7d").
+func (p *Params) Duration(name string, def, lo, hi time.Duration) time.Duration {
+	s := strings.TrimSpace(p.values.Get(name))
+	if s == "" {
+		return def
+	}
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		p.Add(name, FieldInvalid, `must be a duration, e.g. "7d" or "12h"`)
+		return def
+	}
+	if d < lo || d > hi {
+		p.Add(name, FieldOutOfRange, fmt.Sprintf("must be between %s and %s", formatDuration(lo), formatDuration(hi)))
+		return def
+	}
+	return d
+}
+
+// formatDuration formats d in days when it's a whole number of them.
+func formatDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// OneOf returns the parameter name, in lower case, if it's one of values, or def when
+// it's missing.
+func (p *Params) OneOf(name, def string, values ...string) string {
+	s := strings.ToLower(strings.TrimSpace(p.values.Get(name)))
+	if s == "" {
+		return def
+	}
+	if !slices.Contains(values, s) {
+		p.Add(name, FieldUnknown, "must be one of "+strings.Join(values, ", "))
+		return def
+	}
+	return s
+}
+
+// Add records an error of the field name.
+func (p *Params) Add(name, code, message string) {
+	p.errs = append(p.errs, FieldError{Field: name, Code: code, Message: message})
+}
+
+// Err returns the validation error of the invalid parameters, or nil.
+func (p *Params) Err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return Validation(p.errs...)
+}
+
+// Check answers 400 with the invalid parameters and returns false if there are any.
+func (p *Params) Check(w http.ResponseWriter, r *http.Request) bool {
+	if len(p.errs) == 0 {
+		return true
+	}
+	Invalid(w, r, p.errs...)
+	return false
+}
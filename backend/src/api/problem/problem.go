@@ -0,0 +1,172 @@
+// Package problem writes the errors of the HTTP API as RFC 7807 "problem details"
+// (application/problem+json), with a stable code that clients can switch on, the id of
+// the request and, for invalid input, the errors of each field:
+//
+//	{"type": "about:blank", "title": "Bad Request", "status": 400, "code": "validation_failed",
+//	 "detail": "The request has invalid parameters.", "request_id": "host/abc-000012",
+//	 "errors": [{"field": "limit", "code": "out_of_range", "message": "must be at most 100"}]}
+//
+// Internal errors are logged with the request id and answered without their message,
+// so database errors and SQL never reach the clients.
+package problem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"vue_go_cockroachdb/src/logging"
+)
+
+// ContentType is the media type of the problems.
+const ContentType = "application/problem+json"
+
+// Codes of the problems. They are part of the API: don't change them.
+const (
+	CodeInvalidJSON      = "invalid_json"      // the body is not the expected JSON
+	CodeValidation       = "validation_failed" // see the errors of the fields
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// Codes of the field errors.
+const (
+	FieldRequired   = "required"
+	FieldInvalid    = "invalid"      // wrong format or type
+	FieldOutOfRange = "out_of_range" // a number or length out of its bounds
+	FieldUnknown    = "unknown"      // not one of the accepted values
+)
+
+// Problem is the body of an error response.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is the problem of a parameter or field of the body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error that is answered as its problem. Stores and parsers return it
+// (usually through Validation) for errors the client should see.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []FieldError
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Field + " " + e.Errors[0].Message
+	}
+	return e.Detail
+}
+
+// Validation returns the error of invalid fields, answered 400.
+func Validation(errs ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeValidation, Detail: "The request has invalid parameters.", Errors: errs}
+}
+
+// Write answers with a problem with the given status, code and detail.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// NotFound answers 404 with detail, e.g. "Watchlist not found".
+func NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusNotFound, CodeNotFound, detail)
+}
+
+// InvalidJSON answers 400 for a body that can't be decoded, with the field of err when
+// it's a value of the wrong type.
+func InvalidJSON(w http.ResponseWriter, r *http.Request, err error) {
+	p := Problem{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Detail: "The body is not valid JSON for this endpoint."}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		p.Errors = []FieldError{{Field: typeErr.Field, Code: FieldInvalid, Message: "must not be a JSON " + typeErr.Value}}
+	}
+	write(w, r, p)
+}
+
+// Invalid answers 400 with the errors of the fields.
+func Invalid(w http.ResponseWriter, r *http.Request, errs ...FieldError) {
+	writeError(w, r, Validation(errs...))
+}
+
+// Internal logs err with the id of the request and answers 500 without its message.
+func Internal(w http.ResponseWriter, r *http.Request, detail string, err error) {
+	slog.ErrorContext(r.Context(), detail, "method", r.Method, "path", r.URL.Path, "error", err)
+	Write(w, r, http.StatusInternalServerError, CodeInternal, detail+". Quote the request id if you report it.")
+}
+
+// FromError answers with the problem of err: an *Error as is, sql.ErrNoRows as 404 with
+// notFound as detail, and anything else as an internal error with failed as detail.
+func FromError(w http.ResponseWriter, r *http.Request, err error, notFound, failed string) {
+	var perr *Error
+	switch {
+	case errors.As(err, &perr):
+		writeError(w, r, perr)
+	case errors.Is(err, sql.ErrNoRows):
+		NotFound(w, r, notFound)
+	default:
+		Internal(w, r, failed, err)
+	}
+}
+
+// WriteError answers with the problem of err, usually a validation error. Errors that
+// aren't an *Error are answered as internal errors.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	FromError(w, r, err, "Not found", "Request failed")
+}
+
+// RequestID is a middleware that gives each request an id, the one of its X-Request-Id
+// header or a new one, and answers it in the X-Request-Id header of the response. The
+// logs of the context of the request have the id as request_id (see logging.With).
+func RequestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetReqID(r.Context())
+		w.Header().Set(middleware.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.With(r.Context(), "request_id", id)))
+	}))
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *Error) {
+	write(w, r, Problem{Status: e.Status, Code: e.Code, Detail: e.Detail, Errors: e.Errors})
+}
+
+func write(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,117 @@
+package problem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs handler behind RequestID and decodes the problem it answers.
+func serve(t *testing.T, url string, handler http.HandlerFunc) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	RequestID(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+
+	var p Problem
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("Content-Type = %q; want %q", ct, ContentType)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	return rec, p
+}
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{fmt.Errorf("watchlist %q: %w", "x", sql.ErrNoRows), http.StatusNotFound, CodeNotFound, "Watchlist not found"},
+		{Validation(FieldError{Field: "name", Code: FieldRequired, Message: "is required"}), http.StatusBadRequest, CodeValidation, "The request has invalid parameters."},
+		{errors.New(`pq: column "x; DROP TABLE stocks" does not exist`), http.StatusInternalServerError, CodeInternal, "Failed to get stocks. Quote the request id if you report it."},
+	}
+
+	for _, tt := range tests {
+		rec, p := serve(t, "/stocks", func(w http.ResponseWriter, r *http.Request) {
+			FromError(w, r, tt.err, "Watchlist not found", "Failed to get stocks")
+		})
+		if rec.Code != tt.status || p.Status != tt.status || p.Code != tt.code || p.Detail != tt.detail {
+			t.Errorf("FromError(%v) = %d %+v; want %d %s %q", tt.err, rec.Code, p, tt.status, tt.code, tt.detail)
+		}
+		if p.Type != "about:blank" || p.Title != http.StatusText(tt.status) || p.Instance != "/stocks" {
+			t.Errorf("FromError(%v): type %q, title %q, instance %q", tt.err, p.Type, p.Title, p.Instance)
+		}
+		if p.RequestID == "" || p.RequestID != rec.Header().Get("X-Request-Id") {
+			t.Errorf("FromError(%v): request id %q, header %q", tt.err, p.RequestID, rec.Header().Get("X-Request-Id"))
+		}
+		if strings.Contains(rec.Body.String(), "pq:") {
+			t.Errorf("FromError(%v) leaked the error: %s", tt.err, rec.Body.String())
+		}
+	}
+}
+
+func TestInvalidJSON(t *testing.T) {
+	var v struct {
+		Limit int `json:"limit"`
+	}
+	err := json.Unmarshal([]byte(`{"limit": "ten"}`), &v)
+
+	rec, p := serve(t, "/alerts/rules/test", func(w http.ResponseWriter, r *http.Request) { InvalidJSON(w, r, err) })
+	want := []FieldError{{Field: "limit", Code: FieldInvalid, Message: "must not be a JSON string"}}
+	if rec.Code != http.StatusBadRequest || p.Code != CodeInvalidJSON || !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("InvalidJSON = %d %+v; want 400 %s with %v", rec.Code, p, CodeInvalidJSON, want)
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		url    string
+		errors []FieldError
+	}{
+		{"/stocks", nil},
+		{"/stocks?page=2&limit=100&order=ASC&score=7.5", nil},
+		{"/stocks?page=abc", []FieldError{{"page", FieldInvalid, "must be an integer"}}},
+		{"/stocks?page=0&limit=101", []FieldError{
+			{"page", FieldOutOfRange, "must be at least 1"},
+			{"limit", FieldOutOfRange, "must be between 1 and 100"},
+		}},
+		{"/stocks?order=sideways&score=-1", []FieldError{
+			{"order", FieldUnknown, "must be one of asc, desc"},
+			{"score", FieldOutOfRange, "must be between 0 and 10"},
+		}},
+		{"/stocks?score=high", []FieldError{{"score", FieldInvalid, "must be a number"}}},
+		{"/stocks?score=NaN", []FieldError{{"score", FieldInvalid, "must be a number"}}},
+		{"/stocks?score=%2BInf", []FieldError{{"score", FieldInvalid, "must be a number"}}},
+		{"/stocks?window=7d", nil},
+		{"/stocks?window=36h", nil},
+		{"/stocks?window=week", []FieldError{{"window", FieldInvalid, `must be a duration, e.g. "7d" or "12h"`}}},
+		{"/stocks?window=400d", []FieldError{{"window", FieldOutOfRange, "must be between 1h0m0s and 365d"}}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		p := Query(r)
+		p.Int("page", 1, 1, math.MaxInt)
+		p.Int("limit", 10, 1, 100)
+		p.OneOf("order", "desc", "asc", "desc")
+		p.Float("score", 0, 0, 10)
+		p.Duration("window", 24*time.Hour, time.Hour, 365*24*time.Hour)
+		if !reflect.DeepEqual(p.errs, tt.errors) {
+			t.Errorf("%s: errors %v; want %v", tt.url, p.errs, tt.errors)
+		}
+		if (p.Err() == nil) != (tt.errors == nil) {
+			t.Errorf("%s: Err() = %v", tt.url, p.Err())
+		}
+	}
+}
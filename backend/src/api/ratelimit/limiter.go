@@ -0,0 +1,173 @@
+// Package ratelimit limits the request rate of each client of the HTTP API with token
+// buckets: a client can make Burst requests at once, and then one every 1/Rate seconds.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"vue_go_cockroachdb/src/api/auth"
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+// sweepInterval is how often the buckets that are full again are dropped.
+const sweepInterval = time.Minute
+
+// Limiter keeps a token bucket per client. It's safe for concurrent use.
+type Limiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // size of the buckets
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was computed
+}
+
+// Decision is the result of Allow.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // size of the bucket
+	Remaining  int           // requests left right now
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, when it isn't
+}
+
+// New returns a Limiter allowing perMinute requests per minute to each client, with
+// bursts of up to burst requests.
+func New(perMinute, burst int) *Limiter {
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of client, if it has one.
+func (l *Limiter) Allow(client string) Decision {
+	return l.take(client, 1)
+}
+
+// take takes n tokens (0 or 1) from the bucket of client, if it has one.
+func (l *Limiter) take(client string, n float64) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	d := Decision{Limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens -= n
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.wait(1 - b.tokens)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = l.wait(l.burst - b.tokens)
+	return d
+}
+
+// wait is how long it takes to add tokens to a bucket.
+func (l *Limiter) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that are full by now, which behave like new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Middleware limits the requests of each client, identified by its API key or, without
+// one, by its IP. Every response has the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers; requests over the limit are answered 429 with Retry-After.
+// It must run after auth.Authenticator.Authenticate to tell the keys apart; the
+// requests rejected by Authenticate are limited by Unauthorized.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := l.Allow(clientID(r))
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+		if !d.Allowed {
+			h.Set("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", seconds(d.RetryAfter)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Unauthorized limits the requests of each IP answered 401, like those with a missing
+// or invalid API key, which Middleware can't tell apart by key. Each one takes a token
+// from the bucket of the IP; once it's empty, the requests of the IP are answered 429
+// before reaching next, so a flood of invalid keys doesn't look each one up. It must
+// run before auth.Authenticator.Authenticate.
+func (l *Limiter) Unauthorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := "unauthorized:" + clientIP(r)
+		if d := l.take(client, 0); !d.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+			problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited,
+				fmt.Sprintf("Too many unauthorized requests, retry in %d seconds", seconds(d.RetryAfter)))
+			return
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() == http.StatusUnauthorized {
+			l.Allow(client)
+		}
+	})
+}
+
+// clientID identifies the client of r for the limits.
+func clientID(r *http.Request) string {
+	if key := auth.FromContext(r.Context()); key != nil {
+		return "key:" + key.ID
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the IP of the client of r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds d up to whole seconds, as used by the headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
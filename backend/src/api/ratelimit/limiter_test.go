@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(60, 3) // one request per second, bursts of 3
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if d := l.Allow("a"); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d = %+v; want allowed with %d remaining", i+1, d, 2-i)
+		}
+	}
+	d := l.Allow("a")
+	if d.Allowed || d.RetryAfter != time.Second || d.Reset != 3*time.Second {
+		t.Errorf("request over the burst = %+v; want denied, retry after 1s, reset in 3s", d)
+	}
+	if d := l.Allow("b"); !d.Allowed {
+		t.Errorf("first request of another client = %+v; want allowed", d)
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	if d := l.Allow("a"); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("request after 1.5s = %+v; want allowed with 0 remaining", d)
+	}
+
+	// full buckets are dropped and start full again
+	now = now.Add(time.Hour)
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("the full bucket of a was not swept")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New(60, 1)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/stocks", nil).WithContext(context.Background())
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("10.0.0.1:1234"); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "1" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("first request: status %d, headers %v", rec.Code, rec.Header())
+	}
+	rec := serve("10.0.0.1:5678") // same IP, other port
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request: status %d, Retry-After %q; want 429 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("request from another IP: status %d; want 200", rec.Code)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	l := New(60, 2)
+	lookups := 0
+	handler := l.Unauthorized(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	serve := func(remoteAddr, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/stocks", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := serve("10.0.0.1:1234", "valid"); code != http.StatusOK {
+			t.Fatalf("request %d with a valid key: status %d; want 200, only 401s are limited", i+1, code)
+		}
+	}
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if code := serve("10.0.0.2:1234", "invalid"); code != want {
+			t.Errorf("request %d with an invalid key: status %d; want %d", i+1, code, want)
+		}
+	}
+	if lookups != 7 {
+		t.Errorf("%d requests reached the handler; want 7, none after the bucket of the IP is empty", lookups)
+	}
+	if code := serve("10.0.0.3:1234", "invalid"); code != http.StatusUnauthorized {
+		t.Errorf("invalid key from another IP: status %d; want 401", code)
+	}
+}
@@ -0,0 +1,249 @@
+// Package api wires the HTTP endpoints of the application.
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"vue_go_cockroachdb/src/api/admin"
+	"vue_go_cockroachdb/src/api/alerts"
+	"vue_go_cockroachdb/src/api/auth"
+	"vue_go_cockroachdb/src/api/metrics"
+	"vue_go_cockroachdb/src/api/openapi"
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/api/ratelimit"
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/api/webhooks"
+)
+
+// Handlers are the handlers of the endpoints served by NewRouter.
+type Handlers struct {
+	Stocks   *stocks.Handler
+	Search   *search.Handler
+	Alerts   *alerts.Handler
+	Webhooks *webhooks.Handler
+	Admin    *admin.Handler
+	Keys     *auth.Handler
+
+	// Auth checks the API keys and their scopes; nil leaves the API open.
+	Auth *auth.Authenticator
+	// RateLimit limits the requests of each API key or IP; nil disables it.
+	RateLimit *ratelimit.Limiter
+	// Metrics counts the requests and serves /metrics; nil answers 503 there.
+	Metrics *metrics.Metrics
+}
+
+// NewRouter configures the router with the CORS middleware, the endpoints for
+// retrieving stocks, stock details by ticker, recommendations and stats, their
+// exports, the sector rollups, the search suggestions, the stream of new events, the
+// watchlists, the alert rules, the webhook subscriptions, and the admin endpoints to
+// run the ETL and manage the API keys, as described by the OpenAPI document served at
+// /openapi.json, and the Prometheus metrics at /metrics. With h.Auth, reading the data
+// needs the read scope, changing the watchlists the watchlists scope, the ETL status and
+// failed items the etl scope, and the other changes and the rest of /admin the admin
+// scope. Every response has the id of its request in
+// X-Request-Id, which its logs have as request_id, and errors are answered as problems
+// (see package problem). The endpoints of a nil handler of h, other than Stocks,
+// answer 503.
+func NewRouter(h Handlers) http.Handler {
+	r := chi.NewRouter()
+	r.Use(problem.RequestID, logRequests)
+	if h.Metrics != nil {
+		r.Use(h.Metrics.Middleware)
+	}
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.NotFound(w, r, "No endpoint at "+r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
+
+	// CORS middleware to allow cross-origin requests
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, ETag")
+			if r.Method == "OPTIONS" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-Id, If-None-Match")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// to test:
+	// curl "http://localhost:8080/openapi.json"
+	r.Get("/openapi.json", openapi.Handler)
+
+	// to test:
+	// curl "http://localhost:8080/metrics"
+	r.With(available(h.Metrics != nil, "Metrics are")).Get("/metrics", h.Metrics.Serve)
+
+	// the rest of the endpoints authenticate and rate limit the requests, and check
+	// the scopes, which let everything through without authentication
+	var guards []func(http.Handler) http.Handler
+	anyone := func(next http.Handler) http.Handler { return next }
+	readScope, watchlistsScope, etlScope, adminScope := anyone, anyone, anyone, anyone
+	if h.Auth != nil {
+		if h.RateLimit != nil {
+			guards = append(guards, h.RateLimit.Unauthorized)
+		}
+		guards = append(guards, h.Auth.Authenticate)
+		readScope = h.Auth.Require(auth.ScopeRead)
+		watchlistsScope = h.Auth.Require(auth.ScopeWatchlists)
+		etlScope = h.Auth.Require(auth.ScopeETL)
+		adminScope = h.Auth.Require(auth.ScopeAdmin)
+	}
+	if h.RateLimit != nil {
+		guards = append(guards, h.RateLimit.Middleware)
+	}
+	api := r.With(guards...)
+	alertsAPI := api.With(available(h.Alerts != nil, "Alerts are"))
+	webhooksAPI := api.With(available(h.Webhooks != nil, "Webhooks are"))
+	adminAPI := api.With(available(h.Admin != nil, "The ETL is"))
+	keysAPI := api.With(available(h.Keys != nil, "API keys are"))
+	searchAPI := api.With(available(h.Search != nil, "Search is"))
+
+	// to test:
+	// curl "http://localhost:8080/stocks?page=1&limit=5"
+	api.With(readScope).Get("/stocks", h.Stocks.GetStocks)
+
+	// to test:
+	// curl "http://localhost:8080/stocks/AKBA"
+	api.With(readScope).Get("/stocks/{ticker}", h.Stocks.GetStockByTicker)
+
+	// to test:
+	// curl "http://localhost:8080/recommendations?limit=5&minimun_score=7"
+	api.With(readScope).Get("/recommendations", h.Stocks.GetRecommendations)
+
+	// to test:
+	// curl -o stocks.csv "http://localhost:8080/stocks/export?search=akebia&sort_by=time"
+	// curl -H "Accept: application/x-ndjson" "http://localhost:8080/recommendations/export?minimum_score=7"
+	// curl -o recommendations.parquet "http://localhost:8080/recommendations/export?format=parquet"
+	api.With(readScope).Get("/stocks/export", h.Stocks.ExportStocks)
+	api.With(readScope).Get("/recommendations/export", h.Stocks.ExportRecommendations)
+
+	// to test:
+	// curl "http://localhost:8080/stats?watchlist=<id>"
+	api.With(readScope).Get("/stats", h.Stocks.GetStats)
+
+	// to test:
+	// curl "http://localhost:8080/sectors?window=7d&top=3"
+	// curl "http://localhost:8080/sectors/Health%20Care/recommendations?window=30d&limit=5"
+	api.With(readScope).Get("/sectors", h.Stocks.GetSectors)
+	api.With(readScope).Get("/sectors/{sector}/recommendations", h.Stocks.GetSectorRecommendations)
+
+	// to test:
+	// curl "http://localhost:8080/search/suggest?q=hello%20grp"
+	searchAPI.With(readScope).Get("/search/suggest", h.Search.Suggest)
+
+	// to test:
+	// curl -N "http://localhost:8080/events/stream?watchlist=<id>"
+	// EventSource can't send headers, so only this route takes the key in the URL
+	r.With(auth.QueryToken).With(guards...).With(readScope).Get("/events/stream", h.Stocks.StreamEvents)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/watchlists" -d '{"name": "Biotech", "tickers": ["AKBA", "MRNA"]}'
+	// curl "http://localhost:8080/stocks?watchlist=<id>"
+	api.With(readScope).Get("/watchlists", h.Stocks.ListWatchlists)
+	api.With(watchlistsScope).Post("/watchlists", h.Stocks.CreateWatchlist)
+	api.With(readScope).Get("/watchlists/{id}", h.Stocks.GetWatchlist)
+	api.With(watchlistsScope).Patch("/watchlists/{id}", h.Stocks.UpdateWatchlist)
+	api.With(watchlistsScope).Delete("/watchlists/{id}", h.Stocks.DeleteWatchlist)
+	api.With(readScope).Get("/watchlists/{id}/tickers", h.Stocks.GetWatchlistTickers)
+	api.With(watchlistsScope).Post("/watchlists/{id}/tickers", h.Stocks.AddWatchlistTickers)
+	api.With(watchlistsScope).Delete("/watchlists/{id}/tickers/{ticker}", h.Stocks.RemoveWatchlistTicker)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/alerts/rules/test" -d '{"expression": "action = \"downgraded\""}'
+	// curl "http://localhost:8080/alerts?limit=10"
+	alertsAPI.With(readScope).Get("/alerts", h.Alerts.ListAlerts)
+	alertsAPI.With(readScope).Get("/alerts/rules", h.Alerts.ListRules)
+	alertsAPI.With(adminScope).Post("/alerts/rules", h.Alerts.CreateRule)
+	alertsAPI.With(readScope).Post("/alerts/rules/test", h.Alerts.TestRule)
+	alertsAPI.With(readScope).Get("/alerts/rules/{id}", h.Alerts.GetRule)
+	alertsAPI.With(adminScope).Patch("/alerts/rules/{id}", h.Alerts.UpdateRule)
+	alertsAPI.With(adminScope).Delete("/alerts/rules/{id}", h.Alerts.DeleteRule)
+	alertsAPI.With(readScope).Get("/alerts/rules/{id}/alerts", h.Alerts.ListAlerts)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/webhooks" -d '{"url": "https://example.com/hook", "filter": {"min_score": 8}}'
+	// curl "http://localhost:8080/webhooks/<id>/deliveries?status=failed"
+	webhooksAPI.With(readScope).Get("/webhooks", h.Webhooks.ListSubscriptions)
+	webhooksAPI.With(adminScope).Post("/webhooks", h.Webhooks.CreateSubscription)
+	webhooksAPI.With(readScope).Get("/webhooks/{id}", h.Webhooks.GetSubscription)
+	webhooksAPI.With(adminScope).Patch("/webhooks/{id}", h.Webhooks.UpdateSubscription)
+	webhooksAPI.With(adminScope).Delete("/webhooks/{id}", h.Webhooks.DeleteSubscription)
+	webhooksAPI.With(readScope).Get("/webhooks/{id}/deliveries", h.Webhooks.ListDeliveries)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/admin/etl/run"
+	adminAPI.With(adminScope).Post("/admin/etl/run", h.Admin.RunETL)
+
+	// to test:
+	// curl "http://localhost:8080/admin/etl/status"
+	adminAPI.With(etlScope).Get("/admin/etl/status", h.Admin.GetETLStatus)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/admin/rescore"
+	adminAPI.With(adminScope).Post("/admin/rescore", h.Admin.Rescore)
+
+	// to test:
+	// curl "http://localhost:8080/admin/failed-items?limit=10"
+	// curl -X POST "http://localhost:8080/admin/failed-items/retry" -d '{"ids": ["<id>"]}'
+	adminAPI.With(etlScope).Get("/admin/failed-items", h.Admin.ListFailedItems)
+	adminAPI.With(adminScope).Post("/admin/failed-items/retry", h.Admin.RetryFailedItems)
+
+	// to test:
+	// curl -X POST "http://localhost:8080/admin/keys" -H "Authorization: Bearer <admin key>" -d '{"name": "frontend", "scopes": ["read"]}'
+	keysAPI.With(adminScope).Get("/admin/keys", h.Keys.ListKeys)
+	keysAPI.With(adminScope).Post("/admin/keys", h.Keys.CreateKey)
+	keysAPI.With(adminScope).Get("/admin/keys/{id}", h.Keys.GetKey)
+	keysAPI.With(adminScope).Delete("/admin/keys/{id}", h.Keys.RevokeKey)
+	keysAPI.With(adminScope).Get("/admin/keys/{id}/usage", h.Keys.GetKeyUsage)
+
+	return r
+}
+
+// logRequests logs every request when it's answered, with its route pattern, status and
+// duration; the ones that fail with a 5xx as warnings.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK // nothing written
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+			slog.Log(r.Context(), level, "Request", "method", r.Method, "path", r.URL.Path,
+				"route", chi.RouteContext(r.Context()).RoutePattern(), "status", status,
+				"bytes", ww.BytesWritten(), "duration_ms", time.Since(start).Milliseconds())
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// available answers 503 to every request when ok is false: the endpoints have no
+// handler, as in the demo mode of the server. what is the subject of the detail.
+func available(ok bool, what string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if ok {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, what+" not available on this server.")
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+// maxSuggestions is the maximum ?limit= of /search/suggest.
+const maxSuggestions = 50
+
+// Handler serves the search endpoints.
+type Handler struct {
+	Searcher *Searcher
+}
+
+// Suggest answers GET /search/suggest?q=: the tickers and companies that best match q,
+// ranked by how well they match and how active they are recently.
+func (h *Handler) Suggest(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		p.Add("q", problem.FieldRequired, "is required")
+	}
+	limit := p.Int("limit", 10, 1, maxSuggestions)
+	if !p.Check(w, r) {
+		return
+	}
+
+	index, err := h.Searcher.Index(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "Failed to search", err)
+		return
+	}
+	suggestions := index.Search(query, limit, FieldTicker, FieldCompany)
+	if suggestions == nil {
+		suggestions = []Match{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"query":       query,
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,346 @@
+// Package search finds tickers, companies and brokerages by approximate text, with a
+// trigram index of the distinct values of those columns: it ranks the values by how
+// well they match and how active they are, tolerates typos ("Hello Grp") and reports
+// the matched ranges to highlight them. The stocks API filters its events by the
+// matched values, and GET /search/suggest completes what the user types.
+package search
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field is a searchable column of the stocks.
+type Field string
+
+const (
+	FieldTicker    Field = "ticker"
+	FieldCompany   Field = "company"
+	FieldBrokerage Field = "brokerage"
+)
+
+// Term is a value of a field, e.g. the company "Akebia Therapeutics".
+type Term struct {
+	Field Field  `json:"type"`
+	Value string `json:"value"`
+}
+
+// Activity counts the events of a combination of ticker, company and brokerage.
+type Activity struct {
+	Ticker, Company, Brokerage string
+	Events                     int
+	RecentEvents               int // in the activity window of the Searcher
+	LatestEvent                time.Time
+}
+
+// Match is a value found by Index.Search.
+type Match struct {
+	Term
+	// Related is the company of a ticker, or the ticker of a company, in their latest
+	// event. Empty for brokerages.
+	Related string `json:"related,omitempty"`
+	// Quality is how well the value matches, from 1 for the same text down to about
+	// 0.2 for a loose fuzzy match.
+	Quality float64 `json:"quality"`
+	// Score is the Quality weighted with the recent activity of the value; matches
+	// are ranked by it.
+	Score       float64   `json:"score"`
+	Events      int       `json:"events"`
+	LatestEvent time.Time `json:"latest_event"`
+	// Highlights are the matched ranges of the value, [start, end) in characters.
+	Highlights [][2]int `json:"highlights"`
+}
+
+// Quality of each kind of match. Fuzzy matches get fuzzyQuality times their trigram
+// similarity, which must reach minSimilarity.
+const (
+	exactQuality      = 1
+	prefixQuality     = 0.9
+	wordPrefixQuality = 0.8
+	substringQuality  = 0.7
+	fuzzyQuality      = 0.6
+
+	minSimilarity = 0.3 // the default threshold of pg_trgm
+	// minWordSimilarity is the similarity of a query word and a word of the value
+	// from which the word is highlighted in a fuzzy match.
+	minWordSimilarity = 0.25
+)
+
+// Index is an immutable trigram index of the values of the searchable fields.
+type Index struct {
+	entries  []entry
+	postings map[string][]int // trigram -> indexes of the entries that have it
+	now      time.Time        // reference of the recent activity
+}
+
+// entry is an indexed value.
+type entry struct {
+	Term
+	related       string
+	relatedLatest time.Time // latest event of the related value, to pick it
+	events        int
+	recent        int
+	latest        time.Time
+
+	text  normalized
+	grams []string // distinct trigrams of text
+}
+
+// Build returns the index of the tickers, companies and brokerages in activity. now is
+// the reference of the recent activity in the scores.
+func Build(activity []Activity, now time.Time) *Index {
+	ix := &Index{postings: map[string][]int{}, now: now}
+	byTerm := map[Term]int{}
+	add := func(t Term, related string, a Activity) {
+		if t.Value == "" {
+			return
+		}
+		i, ok := byTerm[t]
+		if !ok {
+			i = len(ix.entries)
+			byTerm[t] = i
+			ix.entries = append(ix.entries, entry{Term: t})
+		}
+		e := &ix.entries[i]
+		e.events += a.Events
+		e.recent += a.RecentEvents
+		if a.LatestEvent.After(e.latest) {
+			e.latest = a.LatestEvent
+		}
+		if related != "" && (e.related == "" || a.LatestEvent.After(e.relatedLatest)) {
+			e.related, e.relatedLatest = related, a.LatestEvent
+		}
+	}
+	for _, a := range activity {
+		add(Term{FieldTicker, a.Ticker}, a.Company, a)
+		add(Term{FieldCompany, a.Company}, a.Ticker, a)
+		add(Term{FieldBrokerage, a.Brokerage}, "", a)
+	}
+
+	for i := range ix.entries {
+		e := &ix.entries[i]
+		e.text = normalize(e.Value)
+		e.grams = trigrams(e.text.words())
+		for _, g := range e.grams {
+			ix.postings[g] = append(ix.postings[g], i)
+		}
+	}
+	return ix
+}
+
+// Search returns up to limit values of fields (all of them if none) matching query,
+// best first.
+func (ix *Index) Search(query string, limit int, fields ...Field) []Match {
+	q := normalize(query)
+	qWords := q.words()
+	if len(qWords) == 0 {
+		return nil
+	}
+	qText := strings.Join(qWords, " ")
+	qGrams := trigrams(qWords)
+
+	// the entries sharing trigrams with the query are the candidates
+	shared := map[int]int{}
+	for _, g := range qGrams {
+		for _, i := range ix.postings[g] {
+			shared[i]++
+		}
+	}
+
+	var matches []Match
+	for i, n := range shared {
+		e := &ix.entries[i]
+		if len(fields) > 0 && !slices.Contains(fields, e.Field) {
+			continue
+		}
+		quality, highlights := e.match(qText, qWords, float64(n)/float64(len(qGrams)+len(e.grams)-n))
+		if quality == 0 {
+			continue
+		}
+		matches = append(matches, Match{
+			Term:        e.Term,
+			Related:     e.related,
+			Quality:     round(quality),
+			Score:       round(0.8*quality + 0.2*ix.activity(e)),
+			Events:      e.events,
+			LatestEvent: e.latest,
+			Highlights:  highlights,
+		})
+	}
+
+	slices.SortFunc(matches, func(a, b Match) int {
+		switch {
+		case a.Score != b.Score:
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		case a.Field != b.Field:
+			return strings.Compare(string(a.Field), string(b.Field))
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// match returns the quality of the match of the query (normalized text and its words)
+// with e, and the ranges to highlight. similarity is the trigram similarity of the
+// query and e.
+func (e *entry) match(qText string, qWords []string, similarity float64) (float64, [][2]int) {
+	value := e.text.collapsed
+	switch i := strings.Index(value, qText); {
+	case value == qText:
+		return exactQuality, [][2]int{e.text.span(0, len(qText))}
+	case i == 0:
+		return prefixQuality, [][2]int{e.text.span(0, len(qText))}
+	case i > 0:
+		quality := substringQuality
+		if j := strings.Index(" "+value, " "+qText); j >= 0 {
+			quality, i = wordPrefixQuality, j
+		}
+		return quality, [][2]int{e.text.span(i, i+len(qText))}
+	}
+
+	// fuzzy: the whole texts, or each query word with its most similar word
+	vWords := e.text.words()
+	var words float64
+	highlighted := make([]bool, len(vWords))
+	for _, qw := range qWords {
+		best, bestWord := 0.0, -1
+		for j, vw := range vWords {
+			if s := wordSimilarity(qw, vw); s > best {
+				best, bestWord = s, j
+			}
+		}
+		words += best
+		if best >= minWordSimilarity {
+			highlighted[bestWord] = true
+		}
+	}
+	similarity = max(similarity, words/float64(len(qWords)))
+	if similarity < minSimilarity {
+		return 0, nil
+	}
+	var highlights [][2]int
+	for j, ok := range highlighted {
+		if ok {
+			highlights = append(highlights, e.text.wordSpan(j))
+		}
+	}
+	return fuzzyQuality * similarity, highlights
+}
+
+// activity is a measure in [0, 1] of how active the value is: half of it decays with
+// the age of its latest event (by 1/e a month), and half grows with its events in the
+// activity window, saturating around 20.
+func (ix *Index) activity(e *entry) float64 {
+	recency := 0.0
+	if !e.latest.IsZero() {
+		days := max(ix.now.Sub(e.latest).Hours()/24, 0)
+		recency = math.Exp(-days / 30)
+	}
+	volume := min(math.Log1p(float64(e.recent))/math.Log1p(20), 1)
+	return (recency + volume) / 2
+}
+
+// wordSimilarity is the trigram similarity of two words, or 1 if the first one is a
+// prefix of the second, as typed words usually are.
+func wordSimilarity(typed, word string) float64 {
+	if len(typed) >= 2 && strings.HasPrefix(word, typed) {
+		return 1
+	}
+	a, b := trigrams([]string{typed}), trigrams([]string{word})
+	n := 0
+	for _, g := range a {
+		if slices.Contains(b, g) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(a)+len(b)-n)
+}
+
+// trigrams returns the distinct trigrams of words, each padded as pg_trgm does: two
+// spaces before and one after, so the start of a word weighs more than its end.
+func trigrams(words []string) []string {
+	var grams []string
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			if g := string(padded[i : i+3]); !slices.Contains(grams, g) {
+				grams = append(grams, g)
+			}
+		}
+	}
+	return grams
+}
+
+// normalized is a value in lower case, with the characters other than letters and
+// digits turned into single spaces, and the position of each of its bytes in the
+// original value, in characters, to highlight the matches.
+type normalized struct {
+	collapsed string
+	pos       []int // character of the original value of each byte of collapsed
+}
+
+func normalize(s string) normalized {
+	var b strings.Builder
+	var n normalized
+	space := true // at the start, to drop the leading spaces
+	i := 0
+	for _, c := range s {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			before := b.Len()
+			b.WriteRune(unicode.ToLower(c))
+			for range b.Len() - before {
+				n.pos = append(n.pos, i)
+			}
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			n.pos = append(n.pos, i)
+			space = true
+		}
+		i++
+	}
+	n.collapsed = strings.TrimSuffix(b.String(), " ")
+	n.pos = n.pos[:len(n.collapsed)]
+	return n
+}
+
+// words returns the words of the normalized text.
+func (n normalized) words() []string {
+	return strings.Fields(n.collapsed)
+}
+
+// span returns the range of characters of the original value of the bytes [start, end)
+// of the normalized text.
+func (n normalized) span(start, end int) [2]int {
+	return [2]int{n.pos[start], n.pos[end-1] + 1}
+}
+
+// wordSpan returns the range of characters of the original value of the word i.
+func (n normalized) wordSpan(i int) [2]int {
+	start := 0
+	for range i {
+		start += strings.IndexByte(n.collapsed[start:], ' ') + 1
+	}
+	end := strings.IndexByte(n.collapsed[start:], ' ')
+	if end < 0 {
+		end = len(n.collapsed)
+	} else {
+		end += start
+	}
+	return n.span(start, end)
+}
+
+// round rounds a score to 3 decimals, so equal-looking scores tie.
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+
+func testIndex() *Index {
+	return Build([]Activity{
+		{Ticker: "GRPH", Company: "Hello Group", Brokerage: "Benchmark", Events: 3, RecentEvents: 3, LatestEvent: now.Add(-24 * time.Hour)},
+		{Ticker: "HELO", Company: "Hello Pal International", Brokerage: "The Benchmark Company", Events: 1, LatestEvent: now.AddDate(-1, 0, 0)},
+		{Ticker: "AKBA", Company: "Akebia Therapeutics", Brokerage: "BMO Capital Markets", Events: 5, RecentEvents: 5, LatestEvent: now},
+		{Ticker: "AKAM", Company: "Akamai Technologies", Brokerage: "BMO Capital Markets", Events: 1, LatestEvent: now.AddDate(0, -6, 0)},
+		{Ticker: "MRNA", Company: "Moderna, Inc.", Brokerage: "Goldman Sachs", Events: 2, RecentEvents: 1, LatestEvent: now.Add(-time.Hour)},
+	}, now)
+}
+
+func values(matches []Match) []string {
+	var vs []string
+	for _, m := range matches {
+		vs = append(vs, m.Value)
+	}
+	return vs
+}
+
+func TestSearchTypos(t *testing.T) {
+	ix := testIndex()
+	tests := []struct {
+		query string
+		first Term
+	}{
+		{"Hello Grp", Term{FieldCompany, "Hello Group"}},
+		{"helo group", Term{FieldCompany, "Hello Group"}},
+		{"modrna", Term{FieldCompany, "Moderna, Inc."}},
+		{"akebia therapeutcs", Term{FieldCompany, "Akebia Therapeutics"}},
+		{"goldman", Term{FieldBrokerage, "Goldman Sachs"}},
+	}
+	for _, tt := range tests {
+		matches := ix.Search(tt.query, 5)
+		if len(matches) == 0 || matches[0].Term != tt.first {
+			t.Errorf("Search(%q) = %v; want %v first", tt.query, values(matches), tt.first)
+		}
+	}
+	if matches := ix.Search("xyzzy", 5); len(matches) != 0 {
+		t.Errorf("Search(xyzzy) = %v; want nothing", values(matches))
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix := testIndex()
+
+	// the exact ticker, then the prefixes, the most active first
+	got := values(ix.Search("akba", 10, FieldTicker))
+	if len(got) == 0 || got[0] != "AKBA" {
+		t.Errorf("Search(akba) = %v; want AKBA first", got)
+	}
+	got = values(ix.Search("ak", 10, FieldCompany))
+	if want := []string{"Akebia Therapeutics", "Akamai Technologies"}; !slices.Equal(got, want) {
+		t.Errorf("Search(ak) = %v; want %v", got, want)
+	}
+
+	// a prefix beats the prefix of a later word, which beats a substring
+	matches := ix.Search("bench", 10, FieldBrokerage)
+	if got := values(matches); !slices.Equal(got, []string{"Benchmark", "The Benchmark Company"}) {
+		t.Errorf("Search(bench) = %v", got)
+	}
+	if len(matches) == 2 && matches[0].Quality <= matches[1].Quality {
+		t.Errorf("qualities %v, %v; want the prefix first", matches[0].Quality, matches[1].Quality)
+	}
+
+	for _, m := range ix.Search("hello", 10) {
+		if m.Field == FieldCompany && m.Value == "Hello Group" && m.Related != "GRPH" {
+			t.Errorf("related of Hello Group = %q; want GRPH", m.Related)
+		}
+	}
+	if got := ix.Search("a", 2); len(got) > 2 {
+		t.Errorf("Search(a, 2) returned %d matches", len(got))
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	ix := testIndex()
+	tests := []struct {
+		query, value string
+		want         [][2]int
+	}{
+		{"moderna inc", "Moderna, Inc.", [][2]int{{0, 12}}},
+		{"inc", "Moderna, Inc.", [][2]int{{9, 12}}},
+		{"Hello Grp", "Hello Group", [][2]int{{0, 5}, {6, 11}}},
+		{"markets capital", "BMO Capital Markets", [][2]int{{4, 11}, {12, 19}}},
+	}
+	for _, tt := range tests {
+		var got [][2]int
+		for _, m := range ix.Search(tt.query, 10) {
+			if m.Value == tt.value {
+				got = m.Highlights
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("highlights of %q in %q = %v; want %v", tt.query, tt.value, got, tt.want)
+		}
+	}
+}
+
+// countingSource is a Source with fixed activity that counts its reads.
+type countingSource struct {
+	version int64
+	reads   int
+}
+
+func (s *countingSource) GetSearchActivity(ctx context.Context, recentSince time.Time) ([]Activity, error) {
+	s.reads++
+	return []Activity{{Ticker: "AKBA", Company: "Akebia Therapeutics", Events: 1, LatestEvent: now}}, nil
+}
+
+func (s *countingSource) GetDataVersion(ctx context.Context) (int64, error) {
+	return s.version, nil
+}
+
+func TestSearcherRebuilds(t *testing.T) {
+	source := &countingSource{version: 1}
+	clock := now
+	s := NewSearcher(source)
+	s.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := s.Index(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.reads != 1 {
+		t.Errorf("%d reads of the same version; want 1", source.reads)
+	}
+	source.version = 2
+	s.Index(ctx)
+	if source.reads != 2 {
+		t.Errorf("%d reads after a new version; want 2", source.reads)
+	}
+	clock = clock.Add(maxIndexAge)
+	s.Index(ctx)
+	if source.reads != 3 {
+		t.Errorf("%d reads after an hour; want 3", source.reads)
+	}
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the activity window of a Searcher by default.
+const DefaultWindow = 30 * 24 * time.Hour
+
+// maxIndexAge is how long a Searcher keeps an index while the data doesn't change, so
+// the recent activity in the scores moves with time.
+const maxIndexAge = time.Hour
+
+// Source is the store of the searched events.
+type Source interface {
+	// GetSearchActivity returns the activity of every combination of ticker, company
+	// and brokerage, counting as recent the events since recentSince.
+	GetSearchActivity(ctx context.Context, recentSince time.Time) ([]Activity, error)
+	// GetDataVersion returns the version of the stored data, which moves when the
+	// events change.
+	GetDataVersion(ctx context.Context) (int64, error)
+}
+
+// Searcher keeps the Index of a Source, rebuilt when the data version moves. It's
+// safe for concurrent use.
+type Searcher struct {
+	Source Source
+	Window time.Duration // window of the recent activity, 0 for DefaultWindow
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	index   *Index
+	version int64
+}
+
+// NewSearcher returns a Searcher of source with the DefaultWindow.
+func NewSearcher(source Source) *Searcher {
+	return &Searcher{Source: source, now: time.Now}
+}
+
+// Index returns the index of the current data.
+func (s *Searcher) Index(ctx context.Context) (*Index, error) {
+	version, err := s.Source.GetDataVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index != nil && s.version == version && now.Sub(s.index.now) < maxIndexAge {
+		return s.index, nil
+	}
+	window := s.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	activity, err := s.Source.GetSearchActivity(ctx, now.Add(-window).UTC())
+	if err != nil {
+		return nil, err
+	}
+	s.index, s.version = Build(activity, now), version
+	return s.index, nil
+}
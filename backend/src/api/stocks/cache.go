@@ -0,0 +1,97 @@
+package stocks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// DefaultCacheEntries is the number of answers a ResponseCache keeps by default.
+const DefaultCacheEntries = 1000
+
+// ResponseCache keeps the JSON answers of /recommendations and /stats for the current
+// data version (see StockRepository.GetDataVersion): an answer is served again until
+// the ETL or a watchlist change moves the version, which drops every entry. It's safe
+// for concurrent use; a nil *ResponseCache caches nothing.
+type ResponseCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	version int64
+	entries map[string]cachedResponse
+}
+
+// cachedResponse is the body of an answer and its ETag.
+type cachedResponse struct {
+	body []byte
+	etag string
+}
+
+// NewResponseCache returns a cache of up to maxEntries answers, DefaultCacheEntries if
+// maxEntries is 0 or less.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+	return &ResponseCache{maxEntries: maxEntries, entries: map[string]cachedResponse{}}
+}
+
+// get returns the answer cached for key at the data version.
+func (c *ResponseCache) get(key string, version int64) (cachedResponse, bool) {
+	if c == nil {
+		return cachedResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version != c.version {
+		return cachedResponse{}, false
+	}
+	resp, ok := c.entries[key]
+	return resp, ok
+}
+
+// put caches the answer for key, computed at the data version. A newer version drops
+// the entries of the previous one; answers of an older version, computed by requests
+// that started before the change, aren't kept. When the cache is full an arbitrary
+// entry makes room.
+func (c *ResponseCache) put(key string, version int64, resp cachedResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case version < c.version:
+		return
+	case version > c.version:
+		c.version = version
+		clear(c.entries)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = resp
+}
+
+// newCachedResponse returns the body with a strong ETag derived from its content, so
+// every replica gives an answer the same ETag.
+func newCachedResponse(body []byte) cachedResponse {
+	sum := sha256.Sum256(body)
+	return cachedResponse{body: body, etag: `"` + hex.EncodeToString(sum[:12]) + `"`}
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, ignoring the weak
+// prefix as the comparison of RFC 9110 does for GET.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package stocks
+
+import "testing"
+
+func TestResponseCacheVersions(t *testing.T) {
+	c := NewResponseCache(2)
+	a, b := newCachedResponse([]byte("a")), newCachedResponse([]byte("b"))
+
+	c.put("x", 1, a)
+	if got, ok := c.get("x", 1); !ok || got.etag != a.etag {
+		t.Errorf("get(x, 1) = %v, %v; want a", got, ok)
+	}
+	if _, ok := c.get("x", 2); ok {
+		t.Error("get(x, 2) found the answer of version 1")
+	}
+	c.put("x", 0, b) // computed before version 1
+	if got, _ := c.get("x", 1); got.etag != a.etag {
+		t.Error("an answer of an older version replaced the current one")
+	}
+	c.put("y", 2, b)
+	if _, ok := c.get("x", 2); ok {
+		t.Error("version 2 kept the answers of version 1")
+	}
+
+	c.put("x", 2, a)
+	c.put("z", 2, a)
+	if n := len(c.entries); n != 2 {
+		t.Errorf("%d entries; want at most 2", n)
+	}
+
+	var disabled *ResponseCache
+	disabled.put("x", 1, a)
+	if _, ok := disabled.get("x", 1); ok {
+		t.Error("a nil cache returned an answer")
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"other", "abc"`, true},
+		{`"other"`, false},
+		{"*", true},
+		{"abc", false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v; want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,659 @@
+package stocks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/migrations"
+	"vue_go_cockroachdb/src/models"
+)
+
+// The conformance tests check that every StockRepository has the same search, sort,
+// pagination and score semantics. The SQL repository is tested on a temporary SQLite
+// file and, if TEST_DATABASE_URL is set, on that CockroachDB or PostgreSQL database,
+// whose stocks and watchlists are deleted.
+
+func TestMemoryStockRepositoryConformance(t *testing.T) {
+	testStockRepository(t, func(t *testing.T, events []models.StockWithScore) StockRepository {
+		r := NewMemoryStockRepository()
+		r.Add(events...)
+		r.AddCompanies(conformanceCompanies...)
+		return r
+	})
+}
+
+func TestCockroachDBStockRepositoryConformance(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+	testSQLStockRepository(t, dbURL)
+}
+
+func TestSQLiteStockRepositoryConformance(t *testing.T) {
+	testSQLStockRepository(t, "sqlite:"+filepath.Join(t.TempDir(), "stocks.db"))
+}
+
+// testSQLStockRepository runs the conformance tests on the database of dbURL, migrated
+// up, deleting its stocks and watchlists before each test.
+func testSQLStockRepository(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	db, err := app.GetDBConnection(ctx, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(ctx, db, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	testStockRepository(t, func(t *testing.T, events []models.StockWithScore) StockRepository {
+		for _, stmt := range []string{`DELETE FROM watchlists`, `DELETE FROM stocks`, `DELETE FROM companies`} {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, e := range events {
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO stocks (
+					ticker, company, brokerage, action, rating_from, rating_to,
+					target_from, target_to, time, recommendation_score, target_currency, company_mismatch
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12)`,
+				e.Ticker, e.Company, e.Brokerage, e.Action, e.RatingFrom, e.RatingTo,
+				e.TargetFrom, e.TargetTo, e.Time, e.RecommendationScore, e.TargetCurrency, e.CompanyMismatch)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, c := range conformanceCompanies {
+			_, err := db.ExecContext(ctx, `INSERT INTO companies (ticker, name, exchange, sector, industry) VALUES ($1, $2, $3, $4, $5)`,
+				c.Ticker, c.Name, c.Exchange, c.Sector, c.Industry)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return NewCockroachDBStockRepository(db)
+	})
+}
+
+// conformanceEvents are loaded, in this order, in the repositories under test. The
+// times and scores are distinct except for the AKAM and ADBE scores, which tie.
+func conformanceEvents() []models.StockWithScore {
+	at := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+	event := func(hoursAgo int, ticker, company, brokerage, action, from, to string, targets []float64, score float64) models.StockWithScore {
+		s := models.StockWithScore{
+			Stock: models.Stock{Ticker: ticker, Company: company, Brokerage: brokerage, Action: action,
+				RatingFrom: from, RatingTo: to, Time: at.Add(-time.Duration(hoursAgo) * time.Hour)},
+			RecommendationScore: score,
+		}
+		if targets != nil {
+			s.TargetFrom = models.NewPrice(decimal.NewFromFloat(targets[0]))
+			s.TargetTo = models.NewPrice(decimal.NewFromFloat(targets[1]))
+			s.TargetCurrency = "USD"
+		}
+		return s
+	}
+	mismatched := func(s models.StockWithScore) models.StockWithScore {
+		s.CompanyMismatch = true
+		return s
+	}
+	return []models.StockWithScore{
+		event(5, "AKBA", "Akebia Therapeutics", "BMO Capital Markets", models.ActionUpgraded, "Hold", "Buy", []float64{4, 6}, 9.7),
+		mismatched(event(1, "MRNA", "Moderna", "Goldman Sachs", models.ActionInitiated, "", "Neutral", nil, 1.5)),
+		event(3, "AKAM", "Akamai Technologies", "BMO Capital Markets", models.ActionTargetLowered, "Outperform", "Outperform", []float64{130, 120.5}, 5.25),
+		event(7, "OAK", "Oaktree Specialty Lending", "Keefe, Bruyette & Woods", models.ActionReiterated, "Market Perform", "Market Perform", []float64{17, 17}, 3),
+		event(2, "ADBE", "Adobe", "Goldman Sachs", models.ActionTargetRaised, "Buy", "Buy", []float64{600, 650}, 5.25),
+		event(9, "AKBA", "Akebia Therapeutics", "Goldman Sachs", models.ActionDowngraded, "Buy", "Hold", []float64{7, 5}, 0.5),
+		event(4, "ZM", "Zoom Video", "Wedbush", models.ActionTargetRaised, "Neutral", "Neutral", []float64{80, 95.25}, 6.8),
+	}
+}
+
+// conformanceCompanies are the companies table of the repositories under test. The
+// company of the events of MRNA doesn't match its name (company_mismatch).
+var conformanceCompanies = []models.Company{
+	{Ticker: "AKBA", Name: "Akebia Therapeutics", Exchange: "NASDAQ", Sector: "Health Care", Industry: "Biotechnology"},
+	{Ticker: "MRNA", Name: "Moderna Therapeutics", Sector: "Health Care"},
+}
+
+func testStockRepository(t *testing.T, newRepo func(t *testing.T, events []models.StockWithScore) StockRepository) {
+	ctx := context.Background()
+	events := conformanceEvents()
+	missing := "00000000-0000-4000-8000-999999999999"
+
+	// tickers returns the tickers and hours of the stocks, to compare orders.
+	tickers := func(stocks []models.Stock) []string {
+		var result []string
+		for _, s := range stocks {
+			result = append(result, fmt.Sprintf("%s@%s", s.Ticker, s.Time.UTC().Format("15h")))
+		}
+		return result
+	}
+
+	t.Run("GetStocks", func(t *testing.T) {
+		r := newRepo(t, events)
+		tests := []struct {
+			q     StockQuery
+			want  []string
+			total int
+		}{
+			{StockQuery{Page: 1, Limit: 10}, []string{"MRNA@11h", "ADBE@10h", "AKAM@09h", "ZM@08h", "AKBA@07h", "OAK@05h", "AKBA@03h"}, 7},
+			{StockQuery{Page: 2, Limit: 3}, []string{"ZM@08h", "AKBA@07h", "OAK@05h"}, 7},
+			{StockQuery{Page: 3, Limit: 3}, []string{"AKBA@03h"}, 7},
+			{StockQuery{Page: 4, Limit: 3}, nil, 7},
+			{StockQuery{Search: "aK", Page: 1, Limit: 10}, []string{"AKAM@09h", "AKBA@07h", "OAK@05h", "AKBA@03h"}, 4},
+			{StockQuery{Search: "akebia", Page: 2, Limit: 1}, []string{"AKBA@03h"}, 2},
+			{StockQuery{Search: "nothing", Page: 1, Limit: 10}, nil, 0},
+			{StockQuery{SortBy: "ticker", Order: "asc", Page: 1, Limit: 3}, []string{"ADBE@10h", "AKAM@09h"}, 7},
+			{StockQuery{SortBy: "time", Order: "asc", Page: 1, Limit: 2}, []string{"AKBA@03h", "OAK@05h"}, 7},
+			{StockQuery{SortBy: "target_to", Order: "asc", Page: 1, Limit: 2}, []string{"MRNA@11h", "AKBA@03h"}, 7},
+			{StockQuery{SortBy: "target_to", Order: "desc", Page: 1, Limit: 2}, []string{"ADBE@10h", "AKAM@09h"}, 7},
+			{StockQuery{SortBy: "company", Page: 1, Limit: 2}, []string{"ZM@08h", "OAK@05h"}, 7},
+		}
+		for _, tt := range tests {
+			stocks, total, err := r.GetStocks(ctx, tt.q)
+			if err != nil {
+				t.Errorf("GetStocks(%+v): %v", tt.q, err)
+				continue
+			}
+			got := tickers(stocks)
+			if tt.q.SortBy == "ticker" {
+				got = got[:2] // AKBA has two events
+			}
+			if !slices.Equal(got, tt.want) || total != tt.total {
+				t.Errorf("GetStocks(%+v) = %v, %d; want %v, %d", tt.q, got, total, tt.want, tt.total)
+			}
+		}
+	})
+
+	t.Run("GetStocksByMatches", func(t *testing.T) {
+		r := newRepo(t, events)
+		matches := []search.Term{{Field: search.FieldBrokerage, Value: "Goldman Sachs"}, {Field: search.FieldTicker, Value: "AKAM"}}
+		tests := []struct {
+			q     StockQuery
+			want  []string
+			total int
+		}{
+			{StockQuery{Matches: matches, Page: 1, Limit: 10}, []string{"MRNA@11h", "ADBE@10h", "AKBA@03h", "AKAM@09h"}, 4},
+			{StockQuery{Matches: matches, Page: 2, Limit: 3}, []string{"AKAM@09h"}, 4},
+			{StockQuery{Matches: matches, SortBy: "ticker", Order: "asc", Page: 1, Limit: 10}, []string{"ADBE@10h", "AKAM@09h", "AKBA@03h", "MRNA@11h"}, 4},
+			{StockQuery{Matches: []search.Term{{Field: search.FieldCompany, Value: "akebia therapeutics"}}, Page: 1, Limit: 10}, nil, 0},
+		}
+		for _, tt := range tests {
+			stocks, total, err := r.GetStocks(ctx, tt.q)
+			if err != nil {
+				t.Errorf("GetStocks(%+v): %v", tt.q, err)
+				continue
+			}
+			if got := tickers(stocks); !slices.Equal(got, tt.want) || total != tt.total {
+				t.Errorf("GetStocks(%+v) = %v, %d; want %v, %d", tt.q, got, total, tt.want, tt.total)
+			}
+		}
+		if _, _, err := r.GetStocks(ctx, StockQuery{Matches: []search.Term{{Field: "rating_to", Value: "Buy"}}, Page: 1, Limit: 10}); err == nil {
+			t.Error("GetStocks matching an unsearchable field didn't fail")
+		}
+	})
+
+	t.Run("GetSearchActivity", func(t *testing.T) {
+		r := newRepo(t, events)
+		at := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+		activity, err := r.GetSearchActivity(ctx, at.Add(-6*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(activity) != len(events) {
+			t.Errorf("GetSearchActivity returned %d combinations; want %d", len(activity), len(events))
+		}
+		want := map[string]search.Activity{
+			"AKBA/BMO Capital Markets": {Ticker: "AKBA", Company: "Akebia Therapeutics", Brokerage: "BMO Capital Markets", Events: 1, RecentEvents: 1, LatestEvent: at.Add(-5 * time.Hour)},
+			"AKBA/Goldman Sachs":       {Ticker: "AKBA", Company: "Akebia Therapeutics", Brokerage: "Goldman Sachs", Events: 1, LatestEvent: at.Add(-9 * time.Hour)},
+		}
+		for _, a := range activity {
+			w, ok := want[a.Ticker+"/"+a.Brokerage]
+			if !ok {
+				continue
+			}
+			delete(want, a.Ticker+"/"+a.Brokerage)
+			if a.Company != w.Company || a.Events != w.Events || a.RecentEvents != w.RecentEvents || !a.LatestEvent.Equal(w.LatestEvent) {
+				t.Errorf("activity of %s/%s = %+v; want %+v", a.Ticker, a.Brokerage, a, w)
+			}
+		}
+		for key := range want {
+			t.Errorf("no activity of %s", key)
+		}
+	})
+
+	t.Run("GetStocksSortsByEveryColumn", func(t *testing.T) {
+		r := newRepo(t, events)
+		for _, column := range SortColumns {
+			for _, order := range []string{"asc", "desc"} {
+				stocks, _, err := r.GetStocks(ctx, StockQuery{SortBy: column, Order: order, Page: 1, Limit: len(events)})
+				if err != nil {
+					t.Fatalf("GetStocks(%s %s): %v", column, order, err)
+				}
+				if len(stocks) != len(events) {
+					t.Fatalf("GetStocks(%s %s) returned %d stocks; want %d", column, order, len(stocks), len(events))
+				}
+				for i := 1; i < len(stocks); i++ {
+					c := compareColumn(column, &stocks[i-1], &stocks[i])
+					if order == "desc" {
+						c = -c
+					}
+					if c > 0 {
+						t.Errorf("GetStocks(%s %s) = %v: not sorted", column, order, tickers(stocks))
+						break
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("GetStocksRejectsUnknownSorts", func(t *testing.T) {
+		r := newRepo(t, events)
+		for _, q := range []StockQuery{{SortBy: "score"}, {SortBy: "time; DROP TABLE stocks"}, {SortBy: "time", Order: "sideways"}} {
+			q.Page, q.Limit = 1, 10
+			if _, _, err := r.GetStocks(ctx, q); err == nil {
+				t.Errorf("GetStocks(%+v) didn't fail", q)
+			}
+		}
+	})
+
+	t.Run("GetStockByTicker", func(t *testing.T) {
+		r := newRepo(t, events)
+		s, err := r.GetStockByTicker(ctx, "AKBA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Action != models.ActionUpgraded || !s.Time.Equal(events[0].Time) || s.TargetTo.Decimal.String() != "6" {
+			t.Errorf("GetStockByTicker(AKBA) = %+v; want the latest event", s)
+		}
+		if _, err := r.GetStockByTicker(ctx, "akba"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetStockByTicker(akba): %v; want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("CompanyInfo", func(t *testing.T) {
+		r := newRepo(t, events)
+		check := func(method string, s models.Stock) {
+			t.Helper()
+			var want *models.Company
+			for _, c := range conformanceCompanies {
+				if c.Ticker == s.Ticker {
+					want = &c
+				}
+			}
+			if !reflect.DeepEqual(s.CompanyInfo, want) {
+				t.Errorf("%s: company info of %s = %+v; want %+v", method, s.Ticker, s.CompanyInfo, want)
+			}
+			if s.CompanyMismatch != (s.Ticker == "MRNA") {
+				t.Errorf("%s: company mismatch of %s = %v", method, s.Ticker, s.CompanyMismatch)
+			}
+		}
+
+		stocks, _, err := r.GetStocks(ctx, StockQuery{Page: 1, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range stocks {
+			check("GetStocks", s)
+		}
+		s, err := r.GetStockByTicker(ctx, "MRNA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("GetStockByTicker", *s)
+		recommendations, err := r.GetTopRecommendedStocks(ctx, RecommendationQuery{Page: 1, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range recommendations {
+			check("GetTopRecommendedStocks", s.Stock)
+		}
+		events, err := r.GetStockEvents(ctx, StockQuery{}, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			check("GetStockEvents", e.Stock)
+		}
+	})
+
+	t.Run("GetTopRecommendedStocks", func(t *testing.T) {
+		r := newRepo(t, events)
+		tests := []struct {
+			q    RecommendationQuery
+			want []string
+		}{
+			{RecommendationQuery{Page: 1, Limit: 10}, []string{"AKBA 9.70", "ZM 6.80", "ADBE 5.25", "AKAM 5.25", "OAK 3.00", "MRNA 1.50", "AKBA 0.50"}},
+			{RecommendationQuery{Page: 2, Limit: 2}, []string{"ADBE 5.25", "AKAM 5.25"}},
+			{RecommendationQuery{Page: 1, Limit: 10, MinimumScore: 5.25}, []string{"AKBA 9.70", "ZM 6.80", "ADBE 5.25", "AKAM 5.25"}},
+			{RecommendationQuery{Page: 1, Limit: 10, MinimumScore: 10}, nil},
+		}
+		for _, tt := range tests {
+			recommendations, err := r.GetTopRecommendedStocks(ctx, tt.q)
+			if err != nil {
+				t.Errorf("GetTopRecommendedStocks(%+v): %v", tt.q, err)
+				continue
+			}
+			var got []string
+			for _, s := range recommendations {
+				got = append(got, fmt.Sprintf("%s %.2f", s.Ticker, s.RecommendationScore))
+				if want := fmt.Sprintf(" (score: %.2f)", s.RecommendationScore); !strings.HasSuffix(s.Company, want) {
+					t.Errorf("GetTopRecommendedStocks(%+v): company %q; want the suffix %q", tt.q, s.Company, want)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetTopRecommendedStocks(%+v) = %v; want %v", tt.q, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		r := newRepo(t, events)
+		export := func(read func(each func(models.StockWithScore) error) error) ([]string, error) {
+			var got []string
+			err := read(func(s models.StockWithScore) error {
+				got = append(got, fmt.Sprintf("%s@%s %.2f", s.Ticker, s.Time.UTC().Format("15h"), s.RecommendationScore))
+				if (s.CompanyInfo != nil) != (s.Ticker == "AKBA" || s.Ticker == "MRNA") {
+					t.Errorf("company info of %s = %+v", s.Ticker, s.CompanyInfo)
+				}
+				return nil
+			})
+			return got, err
+		}
+
+		for _, q := range []StockQuery{
+			{SortBy: "target_to", Order: "asc"},
+			{Search: "ak"},
+			{Matches: []search.Term{{Field: search.FieldBrokerage, Value: "Goldman Sachs"}, {Field: search.FieldTicker, Value: "AKBA"}}},
+		} {
+			got, err := export(func(each func(models.StockWithScore) error) error { return r.ExportStocks(ctx, q, each) })
+			if err != nil {
+				t.Errorf("ExportStocks(%+v): %v", q, err)
+				continue
+			}
+			q.Page, q.Limit = 1, 100
+			stocks, _, err := r.GetStocks(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tickers(stocks); len(got) != len(want) {
+				t.Errorf("ExportStocks(%+v) = %v; want %v", q, got, want)
+			} else {
+				for i := range got {
+					if !strings.HasPrefix(got[i], want[i]+" ") {
+						t.Errorf("ExportStocks(%+v) = %v; want the order of GetStocks %v", q, got, want)
+						break
+					}
+				}
+			}
+		}
+
+		got, err := export(func(each func(models.StockWithScore) error) error {
+			return r.ExportRecommendations(ctx, RecommendationQuery{MinimumScore: 5.25}, each)
+		})
+		if want := []string{"AKBA@07h 9.70", "ZM@08h 6.80", "ADBE@10h 5.25", "AKAM@09h 5.25"}; err != nil || !slices.Equal(got, want) {
+			t.Errorf("ExportRecommendations = %v, %v; want %v", got, err, want)
+		}
+
+		if err := r.ExportStocks(ctx, StockQuery{WatchlistID: missing}, func(models.StockWithScore) error { return nil }); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ExportStocks(missing watchlist): %v; want sql.ErrNoRows", err)
+		}
+		stop := errors.New("client gone")
+		calls := 0
+		err = r.ExportRecommendations(ctx, RecommendationQuery{}, func(models.StockWithScore) error { calls++; return stop })
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("ExportRecommendations stopped after %d events with %v; want 1 and the error of each", calls, err)
+		}
+	})
+
+	t.Run("GetStats", func(t *testing.T) {
+		r := newRepo(t, events)
+		stats, err := r.GetStats(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := events[1].Time
+		want := models.StockStats{
+			Events: 7, Tickers: 6, Brokerages: 4, MaxScore: 9.7, LatestEvent: &latest,
+			ByAction: map[string]int{models.ActionUpgraded: 1, models.ActionInitiated: 1, models.ActionTargetLowered: 1,
+				models.ActionReiterated: 1, models.ActionTargetRaised: 2, models.ActionDowngraded: 1},
+			ByRating: map[string]int{"Buy": 2, "Neutral": 2, "Outperform": 1, "Market Perform": 1, "Hold": 1},
+		}
+		if math.Abs(stats.AverageScore-32.0/7) > 1e-9 {
+			t.Errorf("GetStats average score = %v; want %v", stats.AverageScore, 32.0/7)
+		}
+		stats.AverageScore = 0
+		if stats.LatestEvent == nil || !stats.LatestEvent.Equal(latest) {
+			t.Errorf("GetStats latest event = %v; want %v", stats.LatestEvent, latest)
+		}
+		stats.LatestEvent = &latest
+		if !reflect.DeepEqual(*stats, want) {
+			t.Errorf("GetStats = %+v; want %+v", *stats, want)
+		}
+
+		empty, err := newRepo(t, nil).GetStats(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if empty.Events != 0 || empty.AverageScore != 0 || empty.MaxScore != 0 || empty.LatestEvent != nil {
+			t.Errorf("GetStats of no events = %+v", empty)
+		}
+	})
+
+	t.Run("GetSectors", func(t *testing.T) {
+		r := newRepo(t, events)
+		at := events[1].Time.Add(time.Hour)
+		sectors, err := r.GetSectors(ctx, SectorQuery{Since: at.Add(-8 * time.Hour), Top: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []models.SectorRollup{{
+			Sector: "Health Care",
+			Rollup: models.Rollup{Events: 2, Tickers: 2, AverageScore: 5.6, Upgrades: 1, Balance: 1},
+			TopTickers: []models.TickerRollup{
+				{Ticker: "AKBA", Company: "Akebia Therapeutics", Rollup: models.Rollup{Events: 1, AverageScore: 9.7, Upgrades: 1, Balance: 1}},
+				{Ticker: "MRNA", Company: "Moderna Therapeutics", Rollup: models.Rollup{Events: 1, AverageScore: 1.5}},
+			},
+			Industries: []models.IndustryRollup{
+				{Industry: "Biotechnology", Rollup: models.Rollup{Events: 1, Tickers: 1, AverageScore: 9.7, Upgrades: 1, Balance: 1}},
+				{Industry: "", Rollup: models.Rollup{Events: 1, Tickers: 1, AverageScore: 1.5}},
+			},
+		}}
+		if !reflect.DeepEqual(sectors, want) {
+			t.Errorf("GetSectors(8h) = %+v; want %+v", sectors, want)
+		}
+
+		// the downgrade of AKBA 9 hours ago evens the balance
+		sectors, err = r.GetSectors(ctx, SectorQuery{Sector: "health care", Since: at.Add(-10 * time.Hour), Top: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sectors) != 1 || sectors[0].Sector != "Health Care" || sectors[0].Events != 3 || sectors[0].Balance != 0 ||
+			sectors[0].AverageScore != 3.9 || len(sectors[0].TopTickers) != 1 || sectors[0].TopTickers[0].Ticker != "AKBA" {
+			t.Errorf("GetSectors(health care, 10h) = %+v", sectors)
+		}
+		sectors, err = r.GetSectors(ctx, SectorQuery{Sector: "Health Care", Since: at, Top: 5})
+		if err != nil || len(sectors) != 1 || sectors[0].Events != 0 || sectors[0].TopTickers == nil {
+			t.Errorf("GetSectors(Health Care, now) = %+v, %v; want an empty rollup", sectors, err)
+		}
+		if _, err := r.GetSectors(ctx, SectorQuery{Sector: "Energy", Top: 5}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetSectors(Energy): %v; want sql.ErrNoRows", err)
+		}
+
+		q := SectorQuery{Sector: "HEALTH CARE", Since: at.Add(-10 * time.Hour), Page: 1, Limit: 10}
+		recommendations, err := r.GetSectorRecommendations(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range recommendations {
+			got = append(got, fmt.Sprintf("%s %.2f", s.Ticker, s.RecommendationScore))
+			if s.CompanyInfo == nil || s.CompanyInfo.Sector != "Health Care" {
+				t.Errorf("GetSectorRecommendations: company info of %s = %+v", s.Ticker, s.CompanyInfo)
+			}
+		}
+		if want := []string{"AKBA 9.70", "MRNA 1.50", "AKBA 0.50"}; !slices.Equal(got, want) {
+			t.Errorf("GetSectorRecommendations(%+v) = %v; want %v", q, got, want)
+		}
+		q.Page, q.Limit = 2, 2
+		if recommendations, err := r.GetSectorRecommendations(ctx, q); err != nil || len(recommendations) != 1 {
+			t.Errorf("GetSectorRecommendations(%+v) = %d events, %v; want 1", q, len(recommendations), err)
+		}
+		if _, err := r.GetSectorRecommendations(ctx, SectorQuery{Sector: "Energy", Page: 1, Limit: 10}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetSectorRecommendations(Energy): %v; want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("GetStockEvents", func(t *testing.T) {
+		r := newRepo(t, events)
+		seq, err := r.GetLatestIngestSeq(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := r.GetStockEvents(ctx, StockQuery{}, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != len(events) || all[len(all)-1].Seq != seq {
+			t.Fatalf("GetStockEvents = %d events, latest sequence %d; want %d events ending at %d", len(all), all[len(all)-1].Seq, len(events), seq)
+		}
+		for i, e := range all {
+			if e.Ticker != events[i].Ticker || !e.Time.Equal(events[i].Time) || (i > 0 && e.Seq <= all[i-1].Seq) {
+				t.Errorf("GetStockEvents[%d] = %s at %v, sequence %d; want the loading order", i, e.Ticker, e.Time, e.Seq)
+			}
+		}
+
+		after, err := r.GetStockEvents(ctx, StockQuery{Search: "ak"}, all[2].Seq, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != 1 || after[0].Seq != all[3].Seq {
+			t.Errorf("GetStockEvents(ak after %d, 1) = %+v; want the OAK event", all[2].Seq, after)
+		}
+		if none, err := r.GetStockEvents(ctx, StockQuery{}, seq, 100); err != nil || len(none) != 0 {
+			t.Errorf("GetStockEvents(after the latest) = %v, %v; want none", none, err)
+		}
+	})
+
+	t.Run("Watchlists", func(t *testing.T) {
+		r := newRepo(t, events)
+		if lists, err := r.ListWatchlists(ctx); err != nil || len(lists) != 0 {
+			t.Fatalf("ListWatchlists = %v, %v; want none", lists, err)
+		}
+		w, err := r.CreateWatchlist(ctx, "Biotech", []string{"MRNA", "AKBA", "MRNA"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Name != "Biotech" || !slices.Equal(w.Tickers, []string{"AKBA", "MRNA"}) {
+			t.Errorf("CreateWatchlist = %+v", w)
+		}
+		empty, err := r.CreateWatchlist(ctx, "Empty", nil)
+		if err != nil || empty.Tickers == nil || len(empty.Tickers) != 0 {
+			t.Errorf("CreateWatchlist(no tickers) = %+v, %v; want an empty list", empty, err)
+		}
+
+		stocks, total, err := r.GetStocks(ctx, StockQuery{WatchlistID: w.ID, Page: 1, Limit: 10})
+		if got := tickers(stocks); err != nil || total != 3 || !slices.Equal(got, []string{"MRNA@11h", "AKBA@07h", "AKBA@03h"}) {
+			t.Errorf("GetStocks(watchlist) = %v, %d, %v", got, total, err)
+		}
+		recommendations, err := r.GetTopRecommendedStocks(ctx, RecommendationQuery{WatchlistID: w.ID, Page: 1, Limit: 10, MinimumScore: 1})
+		if err != nil || len(recommendations) != 2 {
+			t.Errorf("GetTopRecommendedStocks(watchlist) = %v, %v; want 2", recommendations, err)
+		}
+		if stats, err := r.GetStats(ctx, w.ID); err != nil || stats.Events != 3 || stats.Tickers != 2 {
+			t.Errorf("GetStats(watchlist) = %+v, %v", stats, err)
+		}
+		if e, err := r.GetStockEvents(ctx, StockQuery{WatchlistID: w.ID}, 0, 100); err != nil || len(e) != 3 {
+			t.Errorf("GetStockEvents(watchlist) = %d events, %v; want 3", len(e), err)
+		}
+
+		if w, err = r.AddWatchlistTickers(ctx, w.ID, []string{"ZM", "AKBA"}); err != nil || !slices.Equal(w.Tickers, []string{"AKBA", "MRNA", "ZM"}) {
+			t.Errorf("AddWatchlistTickers = %+v, %v", w, err)
+		}
+		if w, err = r.RemoveWatchlistTicker(ctx, w.ID, "MRNA"); err != nil || !slices.Equal(w.Tickers, []string{"AKBA", "ZM"}) {
+			t.Errorf("RemoveWatchlistTicker = %+v, %v", w, err)
+		}
+		if _, err := r.RemoveWatchlistTicker(ctx, w.ID, "MRNA"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RemoveWatchlistTicker(not in it): %v; want sql.ErrNoRows", err)
+		}
+		if w, err = r.RenameWatchlist(ctx, w.ID, "Health"); err != nil || w.Name != "Health" {
+			t.Errorf("RenameWatchlist = %+v, %v", w, err)
+		}
+		got, err := r.GetWatchlist(ctx, w.ID)
+		if err != nil || got.Name != "Health" || !slices.Equal(got.Tickers, []string{"AKBA", "ZM"}) {
+			t.Errorf("GetWatchlist = %+v, %v", got, err)
+		}
+
+		lists, err := r.ListWatchlists(ctx)
+		if err != nil || len(lists) != 2 || lists[0].ID != w.ID || lists[1].ID != empty.ID {
+			t.Errorf("ListWatchlists = %+v, %v; want Health and Empty", lists, err)
+		}
+		if err := r.DeleteWatchlist(ctx, w.ID); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{w.ID, missing, "not-a-uuid"} {
+			if _, err := r.GetWatchlist(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("GetWatchlist(%s): %v; want sql.ErrNoRows", id, err)
+			}
+			if err := r.DeleteWatchlist(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("DeleteWatchlist(%s): %v; want sql.ErrNoRows", id, err)
+			}
+			if _, err := r.RenameWatchlist(ctx, id, "x"); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("RenameWatchlist(%s): %v; want sql.ErrNoRows", id, err)
+			}
+			if _, _, err := r.GetStocks(ctx, StockQuery{WatchlistID: id, Page: 1, Limit: 10}); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("GetStocks(watchlist %s): %v; want sql.ErrNoRows", id, err)
+			}
+			if _, err := r.GetStats(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("GetStats(watchlist %s): %v; want sql.ErrNoRows", id, err)
+			}
+		}
+	})
+
+	t.Run("GetDataVersion", func(t *testing.T) {
+		r := newRepo(t, events)
+		version, err := r.GetDataVersion(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moved := func(change string) {
+			t.Helper()
+			next, err := r.GetDataVersion(ctx)
+			if err != nil || next <= version {
+				t.Errorf("GetDataVersion after %s = %d, %v; want more than %d", change, next, err, version)
+			}
+			version = next
+		}
+
+		w, err := r.CreateWatchlist(ctx, "Biotech", []string{"AKBA"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.AddWatchlistTickers(ctx, w.ID, []string{"MRNA"}); err != nil {
+			t.Fatal(err)
+		}
+		moved("AddWatchlistTickers")
+		if _, err := r.RemoveWatchlistTicker(ctx, w.ID, "AKBA"); err != nil {
+			t.Fatal(err)
+		}
+		moved("RemoveWatchlistTicker")
+		if err := r.DeleteWatchlist(ctx, w.ID); err != nil {
+			t.Fatal(err)
+		}
+		moved("DeleteWatchlist")
+	})
+}
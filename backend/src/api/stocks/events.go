@@ -0,0 +1,99 @@
+package stocks
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often an IngestWatcher polls the database by default.
+const DefaultWatchInterval = 2 * time.Second
+
+// IngestWatcher polls the ingest sequence of the stocks table and wakes up the
+// subscribers when it moves. Since it reads the database, it sees the events loaded by
+// any process: an ETL run in this server, another replica or the etl command.
+type IngestWatcher struct {
+	Repo     StockReader
+	Interval time.Duration // 0 for DefaultWatchInterval
+
+	mu      sync.Mutex
+	seq     int64
+	subs    map[chan struct{}]struct{}
+	stopped bool
+}
+
+// Run polls the database until ctx is done. Then it closes the channels of the
+// subscribers, so their streams end and don't hold up the server shutdown.
+func (w *IngestWatcher) Run(ctx context.Context) {
+	defer w.stop()
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		seq, err := w.Repo.GetLatestIngestSeq(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Ingest watcher failed", "error", err)
+		} else if err == nil {
+			w.update(seq)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives a value when new events may be available,
+// and a function to stop the subscription. Notifications are coalesced: a slow
+// subscriber gets one wake-up for any number of changes. The channel is closed when
+// Run returns.
+func (w *IngestWatcher) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		close(ch)
+		return ch, func() {}
+	}
+	if w.subs == nil {
+		w.subs = map[chan struct{}]struct{}{}
+	}
+	w.subs[ch] = struct{}{}
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subs, ch)
+		w.mu.Unlock()
+	}
+}
+
+// update records the latest sequence and notifies the subscribers if it changed.
+func (w *IngestWatcher) update(seq int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq == w.seq {
+		return
+	}
+	w.seq = seq
+	for ch := range w.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stop closes the channels of the subscribers.
+func (w *IngestWatcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for ch := range w.subs {
+		close(ch)
+		delete(w.subs, ch)
+	}
+}
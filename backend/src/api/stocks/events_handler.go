@@ -0,0 +1,204 @@
+package stocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/models"
+)
+
+const (
+	// eventsBatch is how many events are read from the database at a time.
+	eventsBatch = 500
+	// heartbeatInterval is how often a comment is sent to keep idle streams open
+	// through proxies.
+	heartbeatInterval = 15 * time.Second
+	// retryMillis is the reconnection delay suggested to the clients.
+	retryMillis = 5000
+	// reorderWait is how long a stream waits for the missing sequence values below the
+	// last event it sent, see streamCursor.
+	reorderWait = time.Minute
+)
+
+// StreamEvents pushes the events loaded or updated by the ETL as Server-Sent Events.
+// It accepts the search and watchlist filters of /stocks. Each event has its ingest
+// sequence as id, so a client reconnecting with the Last-Event-ID header (or
+// ?last_event_id=) gets the events it missed; new clients start with the next event.
+// Concurrent loads can commit an event with a lower id after a higher one was sent,
+// so the stream also reads again below the missing ids for a while (see streamCursor).
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if h.Watcher == nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Event stream not available")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Streaming not supported")
+		return
+	}
+	ctx := r.Context()
+
+	q := r.URL.Query()
+	query := StockQuery{Search: q.Get("search"), WatchlistID: q.Get("watchlist")}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+	var cursor streamCursor
+	if lastID != "" {
+		parsed, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || parsed < 0 {
+			problem.Invalid(w, r, problem.FieldError{Field: "Last-Event-ID", Code: problem.FieldInvalid, Message: "must be a non-negative integer"})
+			return
+		}
+		cursor.seq = parsed
+	} else {
+		latest, err := h.Repo.GetLatestIngestSeq(ctx)
+		if err != nil {
+			problem.Internal(w, r, "Failed to open event stream", err)
+			return
+		}
+		cursor.seq = latest
+	}
+
+	// subscribe before the first read so no change is missed in between
+	changed, unsubscribe := h.Watcher.Subscribe()
+	defer unsubscribe()
+
+	// the first read also checks the watchlist, while an error can still be answered
+	after := cursor.after(time.Now())
+	events, err := h.Repo.GetStockEvents(ctx, query, after, eventsBatch)
+	if err != nil {
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to open event stream")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		for len(events) > 0 {
+			now := time.Now()
+			for _, e := range events {
+				if cursor.take(e.Seq, now) {
+					if err := writeEvent(w, e); err != nil {
+						return
+					}
+				}
+				after = e.Seq
+			}
+			flusher.Flush()
+			if len(events) < eventsBatch {
+				break
+			}
+			if events, err = h.Repo.GetStockEvents(ctx, query, after, eventsBatch); err != nil {
+				return
+			}
+		}
+
+		// a late commit below the last event doesn't move the sequence the Watcher
+		// polls, so the gaps are read again on their own
+		var recheck <-chan time.Time
+		if len(cursor.gaps) > 0 {
+			recheck = time.After(DefaultWatchInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-recheck:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		case _, ok := <-changed:
+			if !ok {
+				return // shutting down
+			}
+		}
+		after = cursor.after(time.Now())
+		if events, err = h.Repo.GetStockEvents(ctx, query, after, eventsBatch); err != nil {
+			return // the client reconnects and resumes from the last id
+		}
+	}
+}
+
+// streamCursor is the position of a stream in the ingest sequence. A sequence value
+// is taken when an event is written but seen when its transaction commits, so
+// concurrent loads (the ETL of the server, the etl and import commands, the retries)
+// can commit an event below the last one sent. The values skipped by the stream are
+// kept as gaps for reorderWait, and read again until they show up or expire; values
+// that never do, like those of rolled back loads, just expire.
+type streamCursor struct {
+	seq  int64 // last event sent
+	gaps []seqGap
+}
+
+// seqGap is a range of sequence values skipped by the stream.
+type seqGap struct {
+	from, to int64 // inclusive
+	since    time.Time
+	sent     map[int64]bool // values of the range sent since
+}
+
+// after returns the sequence to read the events after: below the oldest gap, or the
+// last event sent.
+func (c *streamCursor) after(now time.Time) int64 {
+	gaps := c.gaps[:0]
+	for _, g := range c.gaps {
+		if now.Sub(g.since) < reorderWait {
+			gaps = append(gaps, g)
+		}
+	}
+	c.gaps = gaps
+	if len(c.gaps) > 0 {
+		return c.gaps[0].from - 1
+	}
+	return c.seq
+}
+
+// take reports whether the event of sequence seq, read after after(), has to be
+// sent, and records that it was.
+func (c *streamCursor) take(seq int64, now time.Time) bool {
+	if seq > c.seq {
+		if seq > c.seq+1 {
+			c.gaps = append(c.gaps, seqGap{from: c.seq + 1, to: seq - 1, since: now, sent: map[int64]bool{}})
+		}
+		c.seq = seq
+		return true
+	}
+	for _, g := range c.gaps {
+		if g.from <= seq && seq <= g.to && !g.sent[seq] {
+			g.sent[seq] = true
+			return true
+		}
+	}
+	return false
+}
+
+// writeEvent writes e as a "stock" event with its sequence as id.
+func writeEvent(w io.Writer, e models.StockEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\nevent: stock\ndata: %s\n\n", e.Seq, data)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,179 @@
+package stocks
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// eventsRepo serves the events of the stream tests from memory.
+type eventsRepo struct {
+	StockRepository
+
+	mu     sync.Mutex
+	events []models.StockEvent
+}
+
+func (r *eventsRepo) add(ticker string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := models.StockEvent{Seq: int64(len(r.events) + 1)}
+	e.Ticker = ticker
+	r.events = append(r.events, e)
+}
+
+func (r *eventsRepo) GetStockEvents(ctx context.Context, q StockQuery, afterSeq int64, limit int) ([]models.StockEvent, error) {
+	if q.WatchlistID != "" {
+		return nil, fmt.Errorf("watchlist %q: %w", q.WatchlistID, sql.ErrNoRows)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []models.StockEvent
+	for _, e := range r.events {
+		if e.Seq > afterSeq && len(events) < limit && strings.Contains(e.Ticker, q.Search) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *eventsRepo) GetLatestIngestSeq(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.events)), nil
+}
+
+func TestStreamEvents(t *testing.T) {
+	repo := &eventsRepo{}
+	repo.add("AAPL")
+	repo.add("MSFT")
+	repo.add("AMZN")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := &IngestWatcher{Repo: repo, Interval: 10 * time.Millisecond}
+	go watcher.Run(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc((&Handler{Repo: repo, Watcher: watcher}).StreamEvents))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?search=A", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q; want text/event-stream", ct)
+	}
+
+	ids := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+				ids <- id
+			}
+		}
+		close(ids)
+	}()
+	next := func() string {
+		select {
+		case id := <-ids:
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return ""
+		}
+	}
+
+	// MSFT (2) doesn't match the search
+	if id := next(); id != "3" {
+		t.Errorf("first event id = %s; want 3", id)
+	}
+	repo.add("MSFT")
+	repo.add("AMD")
+	if id := next(); id != "5" {
+		t.Errorf("event id after the watcher wake-up = %s; want 5", id)
+	}
+
+	// the stream ends when the watcher stops
+	cancel()
+	for range ids {
+	}
+}
+
+func TestStreamEventsErrors(t *testing.T) {
+	repo := &eventsRepo{}
+	tests := []struct {
+		name    string
+		handler *Handler
+		url     string
+		code    int
+	}{
+		{"no watcher", &Handler{Repo: repo}, "/events/stream", http.StatusServiceUnavailable},
+		{"invalid last event id", &Handler{Repo: repo, Watcher: &IngestWatcher{Repo: repo}}, "/events/stream?last_event_id=abc", http.StatusBadRequest},
+		{"unknown watchlist", &Handler{Repo: repo, Watcher: &IngestWatcher{Repo: repo}}, "/events/stream?watchlist=x", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler.StreamEvents(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d; want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	e := models.StockEvent{Seq: 42}
+	e.Ticker = "AAPL"
+	var b strings.Builder
+	if err := writeEvent(&b, e); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	if !strings.HasPrefix(got, "id: 42\nevent: stock\ndata: {\"seq\":42,\"ticker\":\"AAPL\"") || !strings.HasSuffix(got, "}\n\n") {
+		t.Errorf("writeEvent() = %q", got)
+	}
+}
+
+func TestStreamCursorGaps(t *testing.T) {
+	at := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+	c := streamCursor{seq: 1}
+	for _, seq := range []int64{2, 5} {
+		if !c.take(seq, at) {
+			t.Fatalf("take(%d) = false; want a new event sent", seq)
+		}
+	}
+	if after := c.after(at); after != 2 {
+		t.Errorf("after() with 3 and 4 missing = %d; want 2", after)
+	}
+
+	// 4 commits late: it's sent once, and 5 isn't sent again
+	for _, tt := range []struct {
+		seq  int64
+		want bool
+	}{{4, true}, {5, false}, {4, false}, {2, false}} {
+		if got := c.take(tt.seq, at.Add(time.Second)); got != tt.want {
+			t.Errorf("take(%d) = %v; want %v", tt.seq, got, tt.want)
+		}
+	}
+	if after := c.after(at.Add(reorderWait - time.Second)); after != 2 {
+		t.Errorf("after() before the gap expires = %d; want 2", after)
+	}
+	// 3 never shows up, like the value of a rolled back load
+	if after := c.after(at.Add(reorderWait)); after != 5 {
+		t.Errorf("after() once the gap expired = %d; want the last event, 5", after)
+	}
+}
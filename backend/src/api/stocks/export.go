@@ -0,0 +1,208 @@
+package stocks
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// Formats of the exports, chosen with ?format= or the Accept header.
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// ExportFormats are the formats of the exports, the default first.
+var ExportFormats = []string{FormatCSV, FormatNDJSON, FormatParquet}
+
+// exportMediaTypes are the content types of the formats, also accepted in the Accept
+// header.
+var exportMediaTypes = map[string]string{
+	FormatCSV:     "text/csv",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+// acceptedFormat returns the first export format named by the media types of an
+// Accept header, in their order (q-values aren't weighed), or "" if none is.
+// application/jsonl is also JSON Lines.
+func acceptedFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/jsonl" {
+			return FormatNDJSON
+		}
+		for format, t := range exportMediaTypes {
+			if mediaType == t {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// exportRowGroup is the number of rows of a Parquet row group, the most an export
+// keeps in memory.
+const exportRowGroup = 10_000
+
+// exportRow is an exported event in the flat columns of the CSV and Parquet exports.
+type exportRow struct {
+	Ticker              string    `parquet:"ticker"`
+	Company             string    `parquet:"company"`
+	Brokerage           string    `parquet:"brokerage"`
+	Action              string    `parquet:"action"`
+	RatingFrom          string    `parquet:"rating_from"`
+	RatingTo            string    `parquet:"rating_to"`
+	TargetFrom          *float64  `parquet:"target_from"`
+	TargetTo            *float64  `parquet:"target_to"`
+	TargetCurrency      string    `parquet:"target_currency"`
+	Time                time.Time `parquet:"time,timestamp(millisecond)"`
+	RecommendationScore float64   `parquet:"recommendation_score"`
+	CompanyMismatch     bool      `parquet:"company_mismatch"`
+	Exchange            string    `parquet:"exchange"`
+	Sector              string    `parquet:"sector"`
+	Industry            string    `parquet:"industry"`
+}
+
+// exportColumns is the header of the CSV exports, in the order of exportRow.
+var exportColumns = []string{"ticker", "company", "brokerage", "action", "rating_from", "rating_to",
+	"target_from", "target_to", "target_currency", "time", "recommendation_score", "company_mismatch",
+	"exchange", "sector", "industry"}
+
+func newExportRow(s models.StockWithScore) exportRow {
+	row := exportRow{
+		Ticker:              s.Ticker,
+		Company:             s.Company,
+		Brokerage:           s.Brokerage,
+		Action:              s.Action,
+		RatingFrom:          s.RatingFrom,
+		RatingTo:            s.RatingTo,
+		TargetCurrency:      s.TargetCurrency,
+		Time:                s.Time.UTC(),
+		RecommendationScore: s.RecommendationScore,
+		CompanyMismatch:     s.CompanyMismatch,
+	}
+	if s.TargetFrom.Valid {
+		f := s.TargetFrom.Decimal.InexactFloat64()
+		row.TargetFrom = &f
+	}
+	if s.TargetTo.Valid {
+		f := s.TargetTo.Decimal.InexactFloat64()
+		row.TargetTo = &f
+	}
+	if c := s.CompanyInfo; c != nil {
+		row.Exchange, row.Sector, row.Industry = c.Exchange, c.Sector, c.Industry
+	}
+	return row
+}
+
+// Export writes the events that read calls each with to w, in format, one of
+// ExportFormats: the same files as the export endpoints.
+func Export(w io.Writer, format string, read func(each func(models.StockWithScore) error) error) error {
+	out := newExportWriter(w, format)
+	if err := read(out.Write); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// exportWriter writes the events of an export in a format.
+type exportWriter interface {
+	Write(s models.StockWithScore) error
+	// Flush sends the rows written so far. Parquet only sends full row groups.
+	Flush() error
+	// Close writes what's left, like the footer of Parquet, without closing the
+	// underlying writer.
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format string) exportWriter {
+	switch format {
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{bw: bw, enc: json.NewEncoder(bw)}
+	case FormatParquet:
+		return &parquetWriter{pw: parquet.NewGenericWriter[exportRow](w,
+			parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(exportRowGroup))}
+	}
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+// csvWriter writes the exportColumns of the events, after a header with their names.
+type csvWriter struct {
+	cw     *csv.Writer
+	header bool // written
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.cw.Write(exportColumns)
+}
+
+func (c *csvWriter) Write(s models.StockWithScore) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	target := func(d *float64, s string) string {
+		if d == nil {
+			return ""
+		}
+		return s
+	}
+	row := newExportRow(s)
+	return c.cw.Write([]string{row.Ticker, row.Company, row.Brokerage, row.Action, row.RatingFrom, row.RatingTo,
+		target(row.TargetFrom, s.TargetFrom.Decimal.String()), target(row.TargetTo, s.TargetTo.Decimal.String()),
+		row.TargetCurrency, row.Time.Format(time.RFC3339), strconv.FormatFloat(row.RecommendationScore, 'f', -1, 64),
+		strconv.FormatBool(row.CompanyMismatch), row.Exchange, row.Sector, row.Industry})
+}
+
+func (c *csvWriter) Flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil { // of an empty export
+		return err
+	}
+	return c.Flush()
+}
+
+// ndjsonWriter writes the events as in the JSON of the API, one per line.
+type ndjsonWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(s models.StockWithScore) error { return n.enc.Encode(s) }
+func (n *ndjsonWriter) Flush() error                        { return n.bw.Flush() }
+func (n *ndjsonWriter) Close() error                        { return n.bw.Flush() }
+
+// parquetWriter writes the events as exportRows in row groups of exportRowGroup rows.
+type parquetWriter struct {
+	pw *parquet.GenericWriter[exportRow]
+}
+
+func (p *parquetWriter) Write(s models.StockWithScore) error {
+	_, err := p.pw.Write([]exportRow{newExportRow(s)})
+	return err
+}
+
+func (p *parquetWriter) Flush() error { return nil }
+func (p *parquetWriter) Close() error { return p.pw.Close() }
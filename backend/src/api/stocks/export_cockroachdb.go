@@ -0,0 +1,77 @@
+package stocks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+func (r *CockroachDBStockRepository) ExportStocks(ctx context.Context, q StockQuery, each func(models.StockWithScore) error) error {
+	orderBy, err := stockOrder(q)
+	if err != nil {
+		return err
+	}
+	if err := r.checkWatchlist(ctx, q.WatchlistID); err != nil {
+		return err
+	}
+
+	where := "TRUE"
+	filters, args := stockFilters(q, nil)
+	if len(filters) > 0 {
+		where = strings.Join(filters, " AND ")
+	}
+	if q.SortBy == "" && len(q.Matches) > 0 {
+		orderBy = "CASE " + strings.Join(relevanceCases(q.Matches), " ") + " END, " + orderBy
+	}
+	return r.export(ctx, where, orderBy, args, each)
+}
+
+func (r *CockroachDBStockRepository) ExportRecommendations(ctx context.Context, q RecommendationQuery, each func(models.StockWithScore) error) error {
+	if err := r.checkWatchlist(ctx, q.WatchlistID); err != nil {
+		return err
+	}
+
+	where := "recommendation_score >= $1"
+	args := []any{q.MinimumScore}
+	if q.WatchlistID != "" {
+		where += " AND " + watchlistFilter(2)
+		args = append(args, q.WatchlistID)
+	}
+	return r.export(ctx, where, "recommendation_score DESC, time DESC", args, each)
+}
+
+// export calls each with the events matching where, in the order of orderBy, as the
+// rows are read. The companies, a table much smaller than the stocks, are read first.
+func (r *CockroachDBStockRepository) export(ctx context.Context, where, orderBy string, args []any, each func(models.StockWithScore) error) error {
+	companies, err := r.companies(ctx, "TRUE")
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to,
+		       COALESCE(target_currency, ''), time, company_mismatch, recommendation_score
+		FROM stocks
+		WHERE %s
+		ORDER BY %s`, where, orderBy), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.StockWithScore
+		err := rows.Scan(&s.Ticker, &s.Company, &s.Brokerage, &s.Action, &s.RatingFrom, &s.RatingTo,
+			&s.TargetFrom, &s.TargetTo, &s.TargetCurrency, &s.Time, &s.CompanyMismatch, &s.RecommendationScore)
+		if err != nil {
+			return err
+		}
+		s.CompanyInfo = companies[s.Ticker]
+		if err := each(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
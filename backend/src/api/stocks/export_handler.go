@@ -0,0 +1,113 @@
+package stocks
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/models"
+)
+
+// exportFlushRows is how many rows an export writes between flushes to the client.
+const exportFlushRows = 1000
+
+// exportFormat parses the format of an export: ?format=, else the first format of the
+// Accept header, else CSV.
+func exportFormat(p *problem.Params, r *http.Request) string {
+	if format := p.OneOf("format", "", ExportFormats...); format != "" {
+		return format
+	}
+	if format := acceptedFormat(r.Header.Get("Accept")); format != "" {
+		return format
+	}
+	return FormatCSV
+}
+
+// ExportStocks streams every event of the filters and sort of /stocks, without
+// pagination, as CSV, JSON Lines or Parquet.
+func (h *Handler) ExportStocks(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	sortBy := p.OneOf("sort_by", "", SortColumns...)
+	order := p.OneOf("order", "desc", "asc", "desc")
+	format := exportFormat(p, r)
+	if !p.Check(w, r) {
+		return
+	}
+
+	q := StockQuery{
+		Search:      r.URL.Query().Get("search"),
+		SortBy:      sortBy,
+		Order:       order,
+		WatchlistID: r.URL.Query().Get("watchlist"),
+	}
+	if _, err := h.searchStocks(r.Context(), &q); err != nil {
+		problem.Internal(w, r, "Failed to search the stocks", err)
+		return
+	}
+	h.export(w, r, "stocks", format, func(ctx context.Context, each func(models.StockWithScore) error) error {
+		return h.Exports.ExportStocks(ctx, q, each)
+	})
+}
+
+// ExportRecommendations streams every event of the filters of /recommendations, by
+// score and without pagination, as CSV, JSON Lines or Parquet.
+func (h *Handler) ExportRecommendations(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	minimumScore := p.Float("minimum_score", 0, 0, math.Inf(1))
+	format := exportFormat(p, r)
+	if !p.Check(w, r) {
+		return
+	}
+
+	q := RecommendationQuery{MinimumScore: minimumScore, WatchlistID: r.URL.Query().Get("watchlist")}
+	h.export(w, r, "recommendations", format, func(ctx context.Context, each func(models.StockWithScore) error) error {
+		return h.Exports.ExportRecommendations(ctx, q, each)
+	})
+}
+
+// export answers with the events of read as the file name.format. The response starts
+// with the first event, so an error before it, like an unknown watchlist, is still
+// answered as a problem; a later one aborts the response, which the client sees
+// truncated.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, name, format string, read func(ctx context.Context, each func(models.StockWithScore) error) error) {
+	flusher, _ := w.(http.Flusher)
+	var out exportWriter
+	start := func() {
+		w.Header().Set("Content-Type", exportMediaTypes[format])
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+		w.WriteHeader(http.StatusOK)
+		out = newExportWriter(w, format)
+	}
+	rows := 0
+	err := read(r.Context(), func(s models.StockWithScore) error {
+		if out == nil {
+			start()
+		}
+		if err := out.Write(s); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushRows == 0 && flusher != nil {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && out == nil {
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to export "+name)
+		return
+	}
+	if out == nil {
+		start()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Export aborted", "export", name, "format", format, "rows", rows, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,154 @@
+package stocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+func TestAcceptedFormat(t *testing.T) {
+	tests := map[string]string{
+		"":                                      "",
+		"*/*":                                   "",
+		"text/csv":                              FormatCSV,
+		"text/html, application/x-ndjson;q=0.9": FormatNDJSON,
+		"application/jsonl":                     FormatNDJSON,
+		"application/vnd.apache.parquet, text/csv": FormatParquet,
+		"application/json":                         "",
+	}
+	for accept, want := range tests {
+		if got := acceptedFormat(accept); got != want {
+			t.Errorf("acceptedFormat(%q) = %q; want %q", accept, got, want)
+		}
+	}
+}
+
+func exportRepo() *MemoryStockRepository {
+	r := NewMemoryStockRepository()
+	r.Add(conformanceEvents()...)
+	r.AddCompanies(conformanceCompanies...)
+	return r
+}
+
+func TestExportFormats(t *testing.T) {
+	h := NewHandler(exportRepo())
+	get := func(url, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if strings.HasPrefix(url, "/stocks") {
+			h.ExportStocks(rec, req)
+		} else {
+			h.ExportRecommendations(rec, req)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", url, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	rec := get("/stocks/export?sort_by=ticker&order=asc", "")
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Content-Type = %q; want text/csv", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="stocks.csv"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 8 || !slices.Equal(records[0], exportColumns) {
+		t.Fatalf("CSV export = %v; want the header and 7 events", records)
+	}
+	want := []string{"ADBE", "Adobe", "Goldman Sachs", models.ActionTargetRaised, "Buy", "Buy", "600", "650", "USD",
+		"2025-06-03T10:00:00Z", "5.25", "false", "", "", ""}
+	if !slices.Equal(records[1], want) {
+		t.Errorf("first CSV row = %q; want %q", records[1], want)
+	}
+	if akba := records[3]; akba[0] != "AKBA" || akba[12] != "NASDAQ" || akba[13] != "Health Care" || akba[14] != "Biotechnology" {
+		t.Errorf("CSV row of AKBA = %q; want its company columns", akba)
+	}
+
+	rec = get("/recommendations/export?minimum_score=5", "application/x-ndjson")
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		var s models.StockWithScore
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("NDJSON line %q: %v", line, err)
+		}
+		got = append(got, s.Company)
+	}
+	if want := []string{"Akebia Therapeutics", "Zoom Video", "Adobe", "Akamai Technologies"}; !slices.Equal(got, want) {
+		t.Errorf("NDJSON export = %v; want %v", got, want)
+	}
+
+	rec = get("/recommendations/export?format=parquet", "text/csv")
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="recommendations.parquet"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	rows, err := parquet.Read[exportRow](bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 || rows[0].Ticker != "AKBA" || rows[0].RecommendationScore != 9.7 || rows[0].TargetTo == nil ||
+		*rows[0].TargetTo != 6 || rows[0].Sector != "Health Care" || !rows[0].Time.Equal(conformanceEvents()[0].Time) {
+		t.Errorf("Parquet export = %+v", rows)
+	}
+	for _, r := range rows {
+		if r.Ticker == "MRNA" && r.TargetFrom != nil {
+			t.Errorf("target_from of MRNA = %v; want null", *r.TargetFrom)
+		}
+	}
+
+	// an empty export still has the header
+	rec = get("/stocks/export?search=zzzz", "")
+	if rec.Body.String() != strings.Join(exportColumns, ",")+"\n" {
+		t.Errorf("empty CSV export = %q; want the header", rec.Body.String())
+	}
+}
+
+// failingExportRepo exports an event and then fails.
+type failingExportRepo struct {
+	Exporter
+	before error // returned before the first event
+}
+
+func (r failingExportRepo) ExportStocks(ctx context.Context, q StockQuery, each func(models.StockWithScore) error) error {
+	if r.before != nil {
+		return r.before
+	}
+	if err := each(conformanceEvents()[0]); err != nil {
+		return err
+	}
+	return errors.New("pq: connection reset")
+}
+
+func TestExportErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Handler{Exports: failingExportRepo{before: watchlistNotFound("x")}}).ExportStocks(rec, httptest.NewRequest(http.MethodGet, "/stocks/export", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Header().Get("Content-Type"), "problem+json") {
+		t.Errorf("export of a missing watchlist = %d %s; want a 404 problem", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("export failing after a row panicked with %v; want http.ErrAbortHandler", r)
+		}
+	}()
+	(&Handler{Exports: failingExportRepo{}}).ExportStocks(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stocks/export", nil))
+}
@@ -2,38 +2,93 @@
 package stocks
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/models"
 )
 
+// DefaultMaxPageSize is the maximum limit of the paginated endpoints when the Handler
+// doesn't set one.
+const DefaultMaxPageSize = 100
+
+// Handler serves the endpoints of the stocks API. Its stores are usually the same
+// StockRepository, set with NewHandler.
 type Handler struct {
-	Repo StockRepository
+	Repo        StockReader
+	Sectors     SectorReader
+	Exports     Exporter
+	Watchlists  WatchlistStore
+	Watcher     *IngestWatcher // nil disables /events/stream
+	MaxPageSize int            // maximum ?limit=, 0 for DefaultMaxPageSize
+
+	// Cache keeps the answers of /recommendations and /stats; nil disables it. Their
+	// ETags and Cache-Control headers are sent anyway.
+	Cache *ResponseCache
+	// CacheMaxAge is the max-age of the Cache-Control of /recommendations and /stats;
+	// 0 makes the clients revalidate every time (If-None-Match).
+	CacheMaxAge time.Duration
+
+	// Search makes ?search= of /stocks fuzzy and ranked; nil keeps a plain substring
+	// search of the ticker and company.
+	Search *search.Searcher
+
+	now func() time.Time // of the sector windows, nil for time.Now
 }
 
-func (h *Handler) GetStocks(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
+// NewHandler returns a Handler reading and storing everything in repo.
+func NewHandler(repo StockRepository) *Handler {
+	return &Handler{Repo: repo, Sectors: repo, Exports: repo, Watchlists: repo}
+}
+
+// maxSearchMatches is the number of values, the best ones, that a search of /stocks
+// looks for.
+const maxSearchMatches = 50
 
-	search := q.Get("search")
-	sortBy := q.Get("sort_by")
-	order := q.Get("order")
-	if order == "" {
-		order = "desc"
+// maxPageSize is the maximum ?limit= of the paginated endpoints.
+func (h *Handler) maxPageSize() int {
+	if h.MaxPageSize <= 0 {
+		return DefaultMaxPageSize
 	}
+	return h.MaxPageSize
+}
 
-	page, _ := strconv.Atoi(q.Get("page"))
-	if page < 1 {
-		page = 1
+func (h *Handler) GetStocks(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	page := p.Int("page", 1, 1, math.MaxInt32)
+	limit := p.Int("limit", 10, 1, h.maxPageSize())
+	sortBy := p.OneOf("sort_by", "", SortColumns...)
+	order := p.OneOf("order", "desc", "asc", "desc")
+	if !p.Check(w, r) {
+		return
 	}
 
-	limit, _ := strconv.Atoi(q.Get("limit"))
-	if limit < 1 {
-		limit = 10
+	q := StockQuery{
+		Search:      r.URL.Query().Get("search"),
+		SortBy:      sortBy,
+		Order:       order,
+		Page:        page,
+		Limit:       limit,
+		WatchlistID: r.URL.Query().Get("watchlist"),
+	}
+	matches, err := h.searchStocks(r.Context(), &q)
+	if err != nil {
+		problem.Internal(w, r, "Failed to search the stocks", err)
+		return
 	}
 
-	stocks, total, err := h.Repo.GetStocks(r.Context(), search, sortBy, order, page, limit)
+	stocks, total, err := h.Repo.GetStocks(r.Context(), q)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to get stocks")
 		return
 	}
 
@@ -49,17 +104,63 @@ func (h *Handler) GetStocks(w http.ResponseWriter, r *http.Request) {
 		"limit":      limit,
 		"totalPages": totalPages,
 	}
+	if q.Matches != nil {
+		resp["highlights"] = searchHighlights(matches, stocks)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// searchStocks sets the Matches of q, with h.Search, to the best values for its
+// Search, and returns them.
+func (h *Handler) searchStocks(ctx context.Context, q *StockQuery) ([]search.Match, error) {
+	if h.Search == nil || strings.TrimSpace(q.Search) == "" {
+		return nil, nil
+	}
+	index, err := h.Search.Index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := index.Search(q.Search, maxSearchMatches)
+	q.Matches = []search.Term{{Field: search.FieldTicker}} // nothing matches, but the watchlist is still checked
+	if len(matches) > 0 {
+		q.Matches = q.Matches[:0]
+		for _, m := range matches {
+			q.Matches = append(q.Matches, m.Term)
+		}
+	}
+	return matches, nil
+}
+
+// searchHighlights returns the matched ranges of the values of stocks found by a
+// search, by field and value.
+func searchHighlights(matches []search.Match, stocks []models.Stock) map[search.Field]map[string][][2]int {
+	shown := map[search.Term]bool{}
+	for _, s := range stocks {
+		shown[search.Term{Field: search.FieldTicker, Value: s.Ticker}] = true
+		shown[search.Term{Field: search.FieldCompany, Value: s.Company}] = true
+		shown[search.Term{Field: search.FieldBrokerage, Value: s.Brokerage}] = true
+	}
+	highlights := map[search.Field]map[string][][2]int{}
+	for _, m := range matches {
+		if !shown[m.Term] || len(m.Highlights) == 0 {
+			continue
+		}
+		if highlights[m.Field] == nil {
+			highlights[m.Field] = map[string][][2]int{}
+		}
+		highlights[m.Field][m.Value] = m.Highlights
+	}
+	return highlights
+}
+
 func (h *Handler) GetStockByTicker(w http.ResponseWriter, r *http.Request) {
 	ticker := r.PathValue("ticker")
 
 	stock, err := h.Repo.GetStockByTicker(r.Context(), ticker)
 	if err != nil {
-		http.Error(w, "Stock not found", http.StatusNotFound)
+		problem.FromError(w, r, err, "Stock not found", "Failed to get stock")
 		return
 	}
 
@@ -68,35 +169,78 @@ func (h *Handler) GetStockByTicker(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	p := problem.Query(r)
+	limit := p.Int("limit", 5, 1, h.maxPageSize())
+	minimumScore := p.Float("minimum_score", 0, 0, math.Inf(1))
+	page := p.Int("page", 1, 1, math.MaxInt32)
+	if !p.Check(w, r) {
+		return
+	}
 
-	limit := 5
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
+	q := RecommendationQuery{
+		Page:         page,
+		Limit:        limit,
+		MinimumScore: minimumScore,
+		WatchlistID:  r.URL.Query().Get("watchlist"),
 	}
+	key := fmt.Sprintf("recommendations?limit=%d&minimum_score=%s&page=%d&watchlist=%s",
+		q.Limit, strconv.FormatFloat(q.MinimumScore, 'g', -1, 64), q.Page, strings.ToLower(q.WatchlistID))
+	h.writeCached(w, r, key, func(ctx context.Context) (any, error) {
+		return h.Repo.GetTopRecommendedStocks(ctx, q)
+	}, "Failed to get recommendations")
+}
 
-	minimumScore := 0.0
-	if s := r.URL.Query().Get("minimum_score"); s != "" {
-		if parsed, err := strconv.ParseFloat(s, 64); err == nil && parsed >= 0 {
-			minimumScore = parsed
+// GetStats answers with aggregates of the stored events, optionally limited to the
+// tickers of a watchlist.
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	watchlistID := r.URL.Query().Get("watchlist")
+	h.writeCached(w, r, "stats?watchlist="+strings.ToLower(watchlistID), func(ctx context.Context) (any, error) {
+		return h.Repo.GetStats(ctx, watchlistID)
+	}, "Failed to get stats")
+}
+
+// writeCached answers with the JSON of load, read through h.Cache under key: the
+// parsed query parameters in a fixed order, so equivalent URLs share the entry. The
+// answer carries an ETag, and a request whose If-None-Match has it gets a 304. Errors
+// of load are answered as problems, with failed as the detail of the unexpected ones,
+// and aren't cached.
+func (h *Handler) writeCached(w http.ResponseWriter, r *http.Request, key string, load func(ctx context.Context) (any, error), failed string) {
+	ctx := r.Context()
+	cache, version := h.Cache, int64(0)
+	if cache != nil {
+		var err error
+		if version, err = h.Repo.GetDataVersion(ctx); err != nil {
+			slog.WarnContext(ctx, "Response cache disabled for this request", "error", err)
+			cache = nil
 		}
 	}
 
-	page := 1
-	if p := r.URL.Query().Get("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
+	resp, ok := cache.get(key, version)
+	if !ok {
+		v, err := load(ctx)
+		if err != nil {
+			problem.FromError(w, r, err, "Watchlist not found", failed)
+			return
 		}
+		body, err := json.Marshal(v)
+		if err != nil {
+			problem.Internal(w, r, failed, err)
+			return
+		}
+		resp = newCachedResponse(append(body, '\n'))
+		cache.put(key, version, resp)
 	}
 
-	stocks, err := h.Repo.GetTopRecommendedStocks(ctx, page, limit, minimumScore)
-	if err != nil {
-		http.Error(w, "Failed to get recommendations", http.StatusInternalServerError)
+	w.Header().Set("ETag", resp.etag)
+	if h.CacheMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.CacheMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), resp.etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stocks)
+	w.Write(resp.body)
 }
@@ -0,0 +1,262 @@
+package stocks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/api/problem"
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/models"
+)
+
+// pageRepo answers every page with no stocks.
+type pageRepo struct {
+	StockRepository
+}
+
+func (pageRepo) GetStocks(ctx context.Context, q StockQuery) ([]models.Stock, int, error) {
+	return nil, 0, nil
+}
+
+func (pageRepo) GetTopRecommendedStocks(ctx context.Context, q RecommendationQuery) ([]models.StockWithScore, error) {
+	return nil, nil
+}
+
+func TestMaxPageSize(t *testing.T) {
+	tests := []struct {
+		handler *Handler
+		url     string
+		code    int
+	}{
+		{&Handler{Repo: pageRepo{}}, "/stocks?limit=100", http.StatusOK},
+		{&Handler{Repo: pageRepo{}}, "/stocks?limit=100000", http.StatusBadRequest},
+		{&Handler{Repo: pageRepo{}, MaxPageSize: 20}, "/stocks?limit=21", http.StatusBadRequest},
+		{&Handler{Repo: pageRepo{}, MaxPageSize: 20}, "/recommendations?limit=20", http.StatusOK},
+		{&Handler{Repo: pageRepo{}, MaxPageSize: 20}, "/recommendations?limit=50", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if req.URL.Path == "/stocks" {
+			tt.handler.GetStocks(rec, req)
+		} else {
+			tt.handler.GetRecommendations(rec, req)
+		}
+		if rec.Code != tt.code {
+			t.Errorf("GET %s (max %d) = %d; want %d", tt.url, tt.handler.MaxPageSize, rec.Code, tt.code)
+		}
+	}
+}
+
+// tickerRepo has only the stock AKBA and fails on the ticker FAIL.
+type tickerRepo struct {
+	StockRepository
+}
+
+func (tickerRepo) GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error) {
+	switch ticker {
+	case "AKBA":
+		return &models.Stock{Ticker: "AKBA"}, nil
+	case "FAIL":
+		return nil, errors.New("pq: connection refused")
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestGetStockByTickerErrors(t *testing.T) {
+	h := &Handler{Repo: tickerRepo{}}
+	tests := []struct {
+		ticker string
+		code   int
+	}{
+		{"AKBA", http.StatusOK},
+		{"NOPE", http.StatusNotFound},
+		{"FAIL", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/stocks/"+tt.ticker, nil)
+		req.SetPathValue("ticker", tt.ticker)
+		h.GetStockByTicker(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("GET /stocks/%s = %d; want %d", tt.ticker, rec.Code, tt.code)
+		}
+		if strings.Contains(rec.Body.String(), "pq:") {
+			t.Errorf("GET /stocks/%s leaked the error: %s", tt.ticker, rec.Body.String())
+		}
+	}
+}
+
+func TestGetStocksParams(t *testing.T) {
+	tests := []struct {
+		url    string
+		fields []string // of the errors
+	}{
+		{"/stocks?sort_by=target_to&order=ASC", nil},
+		{"/stocks?sort_by=time%3BDROP%20TABLE%20stocks", []string{"sort_by"}},
+		{"/stocks?sort_by=ticker&order=asc,ticker", []string{"order"}},
+		{"/stocks?page=abc&limit=-1", []string{"page", "limit"}},
+		{"/recommendations?minimum_score=high", []string{"minimum_score"}},
+	}
+
+	h := &Handler{Repo: pageRepo{}}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if req.URL.Path == "/stocks" {
+			h.GetStocks(rec, req)
+		} else {
+			h.GetRecommendations(rec, req)
+		}
+
+		if tt.fields == nil {
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET %s = %d; want 200", tt.url, rec.Code)
+			}
+			continue
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil || rec.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s = %d (%v); want a 400 problem", tt.url, rec.Code, err)
+		}
+		var fields []string
+		for _, e := range p.Errors {
+			fields = append(fields, e.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("GET %s: invalid fields %v; want %v", tt.url, fields, tt.fields)
+		}
+	}
+}
+
+func TestStockOrder(t *testing.T) {
+	if got, err := stockOrder(StockQuery{SortBy: "company", Order: "asc"}); err != nil || got != "company ASC" {
+		t.Errorf("stockOrder(company, asc) = %q, %v", got, err)
+	}
+	for _, q := range []StockQuery{{SortBy: "time; DROP TABLE stocks"}, {SortBy: "time", Order: "DESC, ticker"}} {
+		if got, err := stockOrder(q); err == nil {
+			t.Errorf("stockOrder(%+v) = %q; want an error", q, got)
+		}
+	}
+}
+
+// countingRepo counts the recommendation and stats queries that reach the repository.
+type countingRepo struct {
+	*MemoryStockRepository
+	queries int
+}
+
+func (r *countingRepo) GetTopRecommendedStocks(ctx context.Context, q RecommendationQuery) ([]models.StockWithScore, error) {
+	r.queries++
+	return r.MemoryStockRepository.GetTopRecommendedStocks(ctx, q)
+}
+
+func (r *countingRepo) GetStats(ctx context.Context, watchlistID string) (*models.StockStats, error) {
+	r.queries++
+	return r.MemoryStockRepository.GetStats(ctx, watchlistID)
+}
+
+func TestCachedAnswers(t *testing.T) {
+	repo := &countingRepo{MemoryStockRepository: NewMemoryStockRepository()}
+	repo.Add(conformanceEvents()...)
+	h := &Handler{Repo: repo, Cache: NewResponseCache(10)}
+	get := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if req.URL.Path == "/stats" {
+			h.GetStats(rec, req)
+		} else {
+			h.GetRecommendations(rec, req)
+		}
+		return rec
+	}
+
+	first := get("/recommendations?limit=2&minimum_score=1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("GET /recommendations = %d, ETag %q, Cache-Control %q", first.Code, etag, first.Header().Get("Cache-Control"))
+	}
+	same := get("/recommendations?minimum_score=1.0&page=1&limit=02", "")
+	if same.Header().Get("ETag") != etag || same.Body.String() != first.Body.String() || repo.queries != 1 {
+		t.Errorf("equivalent query: ETag %q, %d queries; want the cached answer", same.Header().Get("ETag"), repo.queries)
+	}
+	if rec := get("/recommendations?limit=2&minimum_score=1", `W/"other", `+etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("GET with If-None-Match = %d %q; want an empty 304", rec.Code, rec.Body.String())
+	}
+	if get("/stats", "").Code != http.StatusOK || get("/stats?watchlist=", "").Code != http.StatusOK || repo.queries != 2 {
+		t.Errorf("GET /stats twice: %d queries; want 2 (the first recommendations and stats)", repo.queries)
+	}
+	for range 2 {
+		if rec := get("/stats?watchlist=00000000-0000-4000-8000-000000000000", ""); rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+			t.Errorf("GET /stats of a missing watchlist = %d, ETag %q; want 404 without ETag", rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+	if repo.queries != 4 {
+		t.Errorf("%d queries; want 4, as errors aren't cached", repo.queries)
+	}
+
+	// a load moves the data version
+	newer := conformanceEvents()[0]
+	newer.Time, newer.RecommendationScore = newer.Time.Add(time.Hour), 9.9
+	repo.Add(newer)
+	rec := get("/recommendations?limit=2&minimum_score=1", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || repo.queries != 5 {
+		t.Errorf("GET after a load = %d, ETag %q, %d queries; want a new answer", rec.Code, rec.Header().Get("ETag"), repo.queries)
+	}
+
+	h.CacheMaxAge = 30 * time.Second
+	if got := get("/stats", "").Header().Get("Cache-Control"); got != "private, max-age=30" {
+		t.Errorf("Cache-Control = %q; want private, max-age=30", got)
+	}
+}
+
+func TestGetStocksFuzzySearch(t *testing.T) {
+	repo := NewMemoryStockRepository()
+	at := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+	for i, s := range []models.Stock{
+		{Ticker: "GRPH", Company: "Hello Group", Brokerage: "Benchmark"},
+		{Ticker: "AKBA", Company: "Akebia Therapeutics", Brokerage: "BMO Capital Markets"},
+		{Ticker: "HELO", Company: "Hello Pal International", Brokerage: "BMO Capital Markets"},
+	} {
+		s.Time = at.Add(time.Duration(i) * time.Hour)
+		repo.Add(models.StockWithScore{Stock: s})
+	}
+	h := &Handler{Repo: repo, Search: search.NewSearcher(repo)}
+
+	rec := httptest.NewRecorder()
+	h.GetStocks(rec, httptest.NewRequest(http.MethodGet, "/stocks?search=Hello+Grp", nil))
+	var resp struct {
+		Items      []models.Stock
+		Total      int
+		Highlights map[search.Field]map[string][][2]int
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Items) != 2 || resp.Items[0].Ticker != "GRPH" {
+		t.Fatalf("search=Hello Grp found %+v; want GRPH first, then HELO", resp.Items)
+	}
+	if got := resp.Highlights[search.FieldCompany]["Hello Group"]; !reflect.DeepEqual(got, [][2]int{{0, 5}, {6, 11}}) {
+		t.Errorf("highlights of Hello Group = %v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.GetStocks(rec, httptest.NewRequest(http.MethodGet, "/stocks?search=xyzzy", nil))
+	if !strings.Contains(rec.Body.String(), `"total":0`) {
+		t.Errorf("search=xyzzy = %s; want nothing", rec.Body.String())
+	}
+}
@@ -3,12 +3,18 @@ package stocks
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
+	"vue_go_cockroachdb/src/api/search"
 	"vue_go_cockroachdb/src/models"
 )
 
+// CockroachDBStockRepository is the StockRepository of the SQL databases: CockroachDB,
+// PostgreSQL and SQLite (see app.Dialect). Its queries only use the SQL common to them.
 type CockroachDBStockRepository struct {
 	DB *sql.DB
 }
@@ -17,43 +23,44 @@ func NewCockroachDBStockRepository(db *sql.DB) *CockroachDBStockRepository {
 	return &CockroachDBStockRepository{DB: db}
 }
 
-func (r *CockroachDBStockRepository) GetStocks(ctx context.Context, search, sortBy, order string, page, limit int) ([]models.Stock, int, error) {
-	offset := (page - 1) * limit
+func (r *CockroachDBStockRepository) GetStocks(ctx context.Context, q StockQuery) ([]models.Stock, int, error) {
+	orderBy, err := stockOrder(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := r.checkWatchlist(ctx, q.WatchlistID); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (q.Page - 1) * q.Limit
 	baseQuery := `
-        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, time,
+        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, COALESCE(target_currency, ''), time, company_mismatch,
                COUNT(*) OVER() as total_count
         FROM stocks
     `
 
-	var filters []string
-	var args []any
-	argIndex := 1
-
-	if search != "" {
-		filters = append(filters, fmt.Sprintf("(LOWER(ticker) LIKE LOWER($%d) OR LOWER(company) LIKE LOWER($%d))", argIndex, argIndex+1))
-		args = append(args, "%"+search+"%", "%"+search+"%")
-		argIndex += 2
-	}
+	filters, args := stockFilters(q, nil)
+	argIndex := len(args) + 1
 
 	if len(filters) > 0 {
 		baseQuery += " WHERE " + strings.Join(filters, " AND ")
 	}
 
-	if sortBy != "" {
-		baseQuery += fmt.Sprintf(" ORDER BY %s %s", sortBy, strings.ToUpper(order))
-	} else {
-		baseQuery += " ORDER BY time DESC"
+	if q.SortBy == "" && len(q.Matches) > 0 {
+		// the filters start with the matches, whose arguments are the first ones
+		orderBy = "CASE " + strings.Join(relevanceCases(q.Matches), " ") + " END, " + orderBy
 	}
+	baseQuery += " ORDER BY " + orderBy
 
 	baseQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-	args = append(args, limit, offset)
+	args = append(args, q.Limit, offset)
 
 	rows, err := r.DB.QueryContext(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
-	var stocks []models.Stock
+	stocks := []models.Stock{}
 	total := 0
 	for rows.Next() {
 		var s models.Stock
@@ -67,7 +74,9 @@ func (r *CockroachDBStockRepository) GetStocks(ctx context.Context, search, sort
 			&s.RatingTo,
 			&s.TargetFrom,
 			&s.TargetTo,
+			&s.TargetCurrency,
 			&s.Time,
+			&s.CompanyMismatch,
 			&rowTotal,
 		)
 		if err != nil {
@@ -76,13 +85,55 @@ func (r *CockroachDBStockRepository) GetStocks(ctx context.Context, search, sort
 		stocks = append(stocks, s)
 		total = rowTotal
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := r.attachCompanies(ctx, pointers(stocks)...); err != nil {
+		return nil, 0, err
+	}
+	if len(stocks) == 0 && offset > 0 {
+		// past the last page there's no row to carry the total
+		filters, args := stockFilters(q, nil)
+		query := "SELECT COUNT(*) FROM stocks"
+		if len(filters) > 0 {
+			query += " WHERE " + strings.Join(filters, " AND ")
+		}
+		if err := r.DB.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
 	return stocks, total, nil
 }
 
+// stockOrder returns the ORDER BY of q. The column and direction are interpolated in
+// the query, so only the SortColumns and asc or desc are accepted, as are only the
+// search fields in the Matches.
+func stockOrder(q StockQuery) (string, error) {
+	for _, m := range q.Matches { // also interpolated
+		if m.Field != search.FieldTicker && m.Field != search.FieldCompany && m.Field != search.FieldBrokerage {
+			return "", fmt.Errorf("unknown search field %q", m.Field)
+		}
+	}
+	if q.SortBy == "" {
+		return "time DESC", nil
+	}
+	if !slices.Contains(SortColumns, q.SortBy) {
+		return "", fmt.Errorf("unknown sort column %q", q.SortBy)
+	}
+	switch strings.ToLower(q.Order) {
+	case "", "desc":
+		return q.SortBy + " DESC", nil
+	case "asc":
+		return q.SortBy + " ASC", nil
+	}
+	return "", fmt.Errorf("unknown sort order %q", q.Order)
+}
+
 func (r *CockroachDBStockRepository) GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error) {
 	query := `
-        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, time
+        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, COALESCE(target_currency, ''), time, company_mismatch
         FROM stocks WHERE ticker = $1
+        ORDER BY time DESC LIMIT 1
     `
 	row := r.DB.QueryRowContext(ctx, query, ticker)
 	var s models.Stock
@@ -95,33 +146,50 @@ func (r *CockroachDBStockRepository) GetStockByTicker(ctx context.Context, ticke
 		&s.RatingTo,
 		&s.TargetFrom,
 		&s.TargetTo,
+		&s.TargetCurrency,
 		&s.Time,
+		&s.CompanyMismatch,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.attachCompanies(ctx, &s); err != nil {
+		return nil, err
+	}
 	return &s, nil
 }
 
-func (r *CockroachDBStockRepository) GetTopRecommendedStocks(ctx context.Context, page, limit int, minimumScore float64) ([]models.StockWithScore, error) {
-	offset := (page - 1) * limit
+func (r *CockroachDBStockRepository) GetTopRecommendedStocks(ctx context.Context, q RecommendationQuery) ([]models.StockWithScore, error) {
+	if err := r.checkWatchlist(ctx, q.WatchlistID); err != nil {
+		return nil, err
+	}
+
+	offset := (q.Page - 1) * q.Limit
+
+	where := "recommendation_score >= $1"
+	args := []any{q.MinimumScore}
+	if q.WatchlistID != "" {
+		where += " AND " + watchlistFilter(2)
+		args = append(args, q.WatchlistID)
+	}
 
 	// esto porque ya todo esta calculado en la bd por tanto no hace falta calcularlo de nuevo
-	query := `
-        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, time, recommendation_score
+	query := fmt.Sprintf(`
+        SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to, COALESCE(target_currency, ''), time, company_mismatch, recommendation_score
         FROM stocks
-		WHERE recommendation_score >= $1
+		WHERE %s
         ORDER BY recommendation_score DESC, time DESC
-		LIMIT $2 OFFSET $3
-        `
+		LIMIT $%d OFFSET $%d
+        `, where, len(args)+1, len(args)+2)
+	args = append(args, q.Limit, offset)
 
-	rows, err := r.DB.QueryContext(ctx, query, minimumScore, limit, offset)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var recommendations []models.StockWithScore
+	recommendations := []models.StockWithScore{}
 	for rows.Next() {
 		var s models.StockWithScore
 		err := rows.Scan(
@@ -133,7 +201,9 @@ func (r *CockroachDBStockRepository) GetTopRecommendedStocks(ctx context.Context
 			&s.RatingTo,
 			&s.TargetFrom,
 			&s.TargetTo,
+			&s.TargetCurrency,
 			&s.Time,
+			&s.CompanyMismatch,
 			&s.RecommendationScore,
 		)
 
@@ -143,6 +213,291 @@ func (r *CockroachDBStockRepository) GetTopRecommendedStocks(ctx context.Context
 		s.Company = fmt.Sprintf("%s (score: %.2f)", s.Company, s.RecommendationScore)
 		recommendations = append(recommendations, s)
 	}
+	stocks := make([]*models.Stock, len(recommendations))
+	for i := range recommendations {
+		stocks[i] = &recommendations[i].Stock
+	}
+	if err := r.attachCompanies(ctx, stocks...); err != nil {
+		return nil, err
+	}
 
 	return recommendations, nil
 }
+
+func (r *CockroachDBStockRepository) GetStats(ctx context.Context, watchlistID string) (*models.StockStats, error) {
+	if err := r.checkWatchlist(ctx, watchlistID); err != nil {
+		return nil, err
+	}
+
+	where := "TRUE"
+	var args []any
+	if watchlistID != "" {
+		where = watchlistFilter(1)
+		args = append(args, watchlistID)
+	}
+
+	stats := models.StockStats{}
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT ticker), COUNT(DISTINCT brokerage),
+		       COALESCE(AVG(recommendation_score), 0), COALESCE(MAX(recommendation_score), 0)
+		FROM stocks WHERE `+where, args...).Scan(
+		&stats.Events, &stats.Tickers, &stats.Brokerages, &stats.AverageScore, &stats.MaxScore,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// read from the column, as SQLite returns MAX(time) as text
+	var latest time.Time
+	err = r.DB.QueryRowContext(ctx, `SELECT time FROM stocks WHERE `+where+` ORDER BY time DESC LIMIT 1`, args...).Scan(&latest)
+	switch {
+	case err == nil:
+		stats.LatestEvent = &latest
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	if stats.ByAction, err = r.countBy(ctx, "action", where, args); err != nil {
+		return nil, err
+	}
+	if stats.ByRating, err = r.countBy(ctx, "rating_to", where, args); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// countBy counts the events matching where per value of column.
+func (r *CockroachDBStockRepository) countBy(ctx context.Context, column, where string, args []any) (map[string]int, error) {
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(
+		`SELECT COALESCE(%[1]s, ''), COUNT(*) FROM stocks WHERE %[2]s GROUP BY %[1]s`, column, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var value string
+		var n int
+		if err := rows.Scan(&value, &n); err != nil {
+			return nil, err
+		}
+		counts[value] += n
+	}
+	return counts, rows.Err()
+}
+
+// GetStockEvents returns up to limit events with an ingest sequence greater than
+// afterSeq, in sequence order, filtered by the search and watchlist of q.
+func (r *CockroachDBStockRepository) GetStockEvents(ctx context.Context, q StockQuery, afterSeq int64, limit int) ([]models.StockEvent, error) {
+	if err := r.checkWatchlist(ctx, q.WatchlistID); err != nil {
+		return nil, err
+	}
+
+	q.Matches = nil // only the Search is used
+	filters, args := stockFilters(q, []any{afterSeq})
+	filters = append([]string{"ingest_seq > $1"}, filters...)
+	args = append(args, limit)
+
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT ingest_seq, ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to,
+		       COALESCE(target_currency, ''), time, company_mismatch, recommendation_score
+		FROM stocks
+		WHERE %s
+		ORDER BY ingest_seq
+		LIMIT $%d`, strings.Join(filters, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.StockEvent
+	for rows.Next() {
+		var e models.StockEvent
+		err := rows.Scan(
+			&e.Seq,
+			&e.Ticker,
+			&e.Company,
+			&e.Brokerage,
+			&e.Action,
+			&e.RatingFrom,
+			&e.RatingTo,
+			&e.TargetFrom,
+			&e.TargetTo,
+			&e.TargetCurrency,
+			&e.Time,
+			&e.CompanyMismatch,
+			&e.RecommendationScore,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stocks := make([]*models.Stock, len(events))
+	for i := range events {
+		stocks[i] = &events[i].Stock
+	}
+	return events, r.attachCompanies(ctx, stocks...)
+}
+
+// attachCompanies sets the CompanyInfo of stocks from the companies table.
+func (r *CockroachDBStockRepository) attachCompanies(ctx context.Context, stocks ...*models.Stock) error {
+	var args []any
+	var placeholders []string
+	seen := map[string]bool{}
+	for _, s := range stocks {
+		if !seen[s.Ticker] {
+			seen[s.Ticker] = true
+			args = append(args, s.Ticker)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	companies, err := r.companies(ctx, "ticker IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return err
+	}
+	for _, s := range stocks {
+		s.CompanyInfo = companies[s.Ticker]
+	}
+	return nil
+}
+
+// companies returns the rows of the companies table matching the where condition, by
+// ticker.
+func (r *CockroachDBStockRepository) companies(ctx context.Context, where string, args ...any) (map[string]*models.Company, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT ticker, name, COALESCE(exchange, ''), COALESCE(sector, ''), COALESCE(industry, '')
+		FROM companies WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	companies := map[string]*models.Company{}
+	for rows.Next() {
+		var c models.Company
+		if err := rows.Scan(&c.Ticker, &c.Name, &c.Exchange, &c.Sector, &c.Industry); err != nil {
+			return nil, err
+		}
+		companies[c.Ticker] = &c
+	}
+	return companies, rows.Err()
+}
+
+// pointers returns pointers to the stocks.
+func pointers(stocks []models.Stock) []*models.Stock {
+	ptrs := make([]*models.Stock, len(stocks))
+	for i := range stocks {
+		ptrs[i] = &stocks[i]
+	}
+	return ptrs
+}
+
+// GetLatestIngestSeq returns the greatest ingest sequence of the stored events, 0 if
+// there are none.
+func (r *CockroachDBStockRepository) GetLatestIngestSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(ingest_seq), 0) FROM stocks`).Scan(&seq)
+	return seq, err
+}
+
+func (r *CockroachDBStockRepository) GetSearchActivity(ctx context.Context, recentSince time.Time) ([]search.Activity, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT ticker, COALESCE(company, ''), COALESCE(brokerage, ''), COUNT(*),
+		       SUM(CASE WHEN time >= $1 THEN 1 ELSE 0 END), MAX(time)
+		FROM stocks
+		GROUP BY ticker, company, brokerage`, recentSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []search.Activity
+	for rows.Next() {
+		var a search.Activity
+		var latest anyTime
+		if err := rows.Scan(&a.Ticker, &a.Company, &a.Brokerage, &a.Events, &a.RecentEvents, &latest); err != nil {
+			return nil, err
+		}
+		a.LatestEvent = latest.Time
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// anyTime scans a time also from the text SQLite returns for expressions such as
+// MAX(time).
+type anyTime struct {
+	time.Time
+}
+
+func (t *anyTime) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case string:
+		return t.parse(v)
+	case []byte:
+		return t.parse(string(v))
+	}
+	return fmt.Errorf("can't scan %T as a time", src)
+}
+
+func (t *anyTime) parse(s string) error {
+	var err error
+	t.Time, err = time.Parse("2006-01-02 15:04:05.999999999-07:00", s)
+	return err
+}
+
+func (r *CockroachDBStockRepository) GetDataVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := r.DB.QueryRowContext(ctx, `SELECT version FROM data_version`).Scan(&version)
+	return version, err
+}
+
+// stockFilters returns the WHERE conditions for the search and watchlist of q, with
+// their arguments appended to args.
+func stockFilters(q StockQuery, args []any) ([]string, []any) {
+	var filters []string
+	switch {
+	case len(q.Matches) > 0:
+		conditions := make([]string, len(q.Matches))
+		for i, m := range q.Matches {
+			conditions[i] = fmt.Sprintf("%s = $%d", m.Field, len(args)+1)
+			args = append(args, m.Value)
+		}
+		filters = append(filters, "("+strings.Join(conditions, " OR ")+")")
+	case q.Search != "":
+		filters = append(filters, fmt.Sprintf("(LOWER(ticker) LIKE LOWER($%d) OR LOWER(company) LIKE LOWER($%d))", len(args)+1, len(args)+2))
+		args = append(args, "%"+q.Search+"%", "%"+q.Search+"%")
+	}
+	if q.WatchlistID != "" {
+		filters = append(filters, watchlistFilter(len(args)+1))
+		args = append(args, q.WatchlistID)
+	}
+	return filters, args
+}
+
+// relevanceCases returns the WHEN clauses of a CASE giving each event the position of
+// its first match, when matches are the first arguments of the query. The fields are
+// interpolated in the query, so only the search fields are accepted.
+func relevanceCases(matches []search.Term) []string {
+	cases := make([]string, 0, len(matches)+1)
+	for i, m := range matches {
+		cases = append(cases, fmt.Sprintf("WHEN %s = $%d THEN %d", m.Field, i+1, i))
+	}
+	return append(cases, fmt.Sprintf("ELSE %d", len(matches)))
+}
+
+// watchlistFilter is the WHERE condition limiting stocks to the tickers of the
+// watchlist passed as the argument number arg.
+func watchlistFilter(arg int) string {
+	return fmt.Sprintf("ticker IN (SELECT ticker FROM watchlist_tickers WHERE watchlist_id = $%d)", arg)
+}
@@ -2,12 +2,97 @@ package stocks
 
 import (
 	"context"
+	"time"
+
+	"vue_go_cockroachdb/src/api/search"
 	"vue_go_cockroachdb/src/models"
 )
 
-// interface
+// SortColumns are the columns GetStocks can sort by.
+var SortColumns = []string{"ticker", "company", "brokerage", "action", "rating_from", "rating_to", "target_from", "target_to", "time"}
+
+// StockQuery filters, sorts and paginates GetStocks.
+type StockQuery struct {
+	Search string
+	// Matches, if set, replace Search: only the events with one of these values, sorted
+	// by default by the first of them they have (the best match) and then by time.
+	Matches     []search.Term
+	SortBy      string // one of SortColumns, or empty to sort by relevance or time
+	Order       string // "asc" or "desc"
+	Page, Limit int
+	WatchlistID string // if set, only the tickers of this watchlist
+}
+
+// RecommendationQuery filters and paginates GetTopRecommendedStocks.
+type RecommendationQuery struct {
+	Page, Limit  int
+	MinimumScore float64
+	WatchlistID  string // if set, only the tickers of this watchlist
+}
+
+// StockRepository is the data access of the stocks API: every store a Handler uses.
+// CockroachDBStockRepository and MemoryStockRepository implement it whole, but the
+// handlers, the metrics and the tests depend on the small interfaces they need, so new
+// features add an interface instead of growing this one. Methods filtering by a
+// watchlist that doesn't exist return an error wrapping sql.ErrNoRows.
 type StockRepository interface {
-	GetStocks(ctx context.Context, search, sortBy, order string, page, limit int) ([]models.Stock, int, error)
+	StockReader
+	SectorReader
+	Exporter
+	WatchlistStore
+}
+
+// StockReader reads the events, their recommendations and stats, and the versions
+// of the data.
+type StockReader interface {
+	GetStocks(ctx context.Context, q StockQuery) ([]models.Stock, int, error)
 	GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error)
-	GetTopRecommendedStocks(ctx context.Context, page, limit int, minimumScore float64) ([]models.StockWithScore, error)
+	GetTopRecommendedStocks(ctx context.Context, q RecommendationQuery) ([]models.StockWithScore, error)
+	GetStats(ctx context.Context, watchlistID string) (*models.StockStats, error)
+	// GetStockEvents returns up to limit events loaded or updated after the ingest
+	// sequence afterSeq, in sequence order. Only the Search and WatchlistID of q are used.
+	GetStockEvents(ctx context.Context, q StockQuery, afterSeq int64, limit int) ([]models.StockEvent, error)
+	// GetLatestIngestSeq returns the ingest sequence of the last loaded or updated event.
+	GetLatestIngestSeq(ctx context.Context) (int64, error)
+	// GetDataVersion returns the version of the stored data, which moves whenever the
+	// ETL changes the events or a watchlist changes.
+	GetDataVersion(ctx context.Context) (int64, error)
+	// GetSearchActivity returns the activity of every combination of ticker, company
+	// and brokerage, for the search index (see search.Source).
+	GetSearchActivity(ctx context.Context, recentSince time.Time) ([]search.Activity, error)
+}
+
+// SectorReader rolls up the events by the sector of their ticker.
+type SectorReader interface {
+	// GetSectors rolls up the events of q by the sector of their ticker. A q.Sector no
+	// company has is an error wrapping sql.ErrNoRows; without events it has an empty
+	// rollup.
+	GetSectors(ctx context.Context, q SectorQuery) ([]models.SectorRollup, error)
+	// GetSectorRecommendations returns a page of the events of q.Sector in the window of
+	// q, by score. A sector no company has is an error wrapping sql.ErrNoRows.
+	GetSectorRecommendations(ctx context.Context, q SectorQuery) ([]models.StockWithScore, error)
+}
+
+// Exporter streams the events of the exports.
+type Exporter interface {
+	// ExportStocks calls each with every event of q, as GetStocks filters and sorts
+	// them but without paging them, as it reads them from the database. An error of each
+	// stops the export and is returned.
+	ExportStocks(ctx context.Context, q StockQuery, each func(models.StockWithScore) error) error
+	// ExportRecommendations is ExportStocks for the events of GetTopRecommendedStocks,
+	// whose company is left as it is.
+	ExportRecommendations(ctx context.Context, q RecommendationQuery, each func(models.StockWithScore) error) error
+}
+
+// WatchlistStore stores the watchlists. Methods on a watchlist that doesn't exist
+// return an error wrapping sql.ErrNoRows.
+type WatchlistStore interface {
+	ListWatchlists(ctx context.Context) ([]models.Watchlist, error)
+	GetWatchlist(ctx context.Context, id string) (*models.Watchlist, error)
+	CreateWatchlist(ctx context.Context, name string, tickers []string) (*models.Watchlist, error)
+	RenameWatchlist(ctx context.Context, id, name string) (*models.Watchlist, error)
+	DeleteWatchlist(ctx context.Context, id string) error
+	// AddWatchlistTickers adds tickers to the watchlist, ignoring the ones already in it.
+	AddWatchlistTickers(ctx context.Context, id string, tickers []string) (*models.Watchlist, error)
+	RemoveWatchlistTicker(ctx context.Context, id, ticker string) (*models.Watchlist, error)
 }
@@ -0,0 +1,586 @@
+package stocks
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/models"
+)
+
+// MemoryStockRepository is a StockRepository that keeps the events and watchlists in
+// memory, with the search, sort, pagination and score semantics of
+// CockroachDBStockRepository (checked by the conformance tests of both). It's used by
+// the tests and by the demo mode of the server. It's safe for concurrent use.
+type MemoryStockRepository struct {
+	mu         sync.RWMutex
+	events     []models.StockEvent // in ingest order
+	seq        int64               // ingest sequence of the last added event
+	version    int64               // data version, bumped by Add and the watchlist changes
+	watchlists []*models.Watchlist // in creation order
+	companies  map[string]models.Company
+	now        func() time.Time
+}
+
+// NewMemoryStockRepository returns an empty MemoryStockRepository.
+func NewMemoryStockRepository() *MemoryStockRepository {
+	return &MemoryStockRepository{now: time.Now, companies: map[string]models.Company{}}
+}
+
+// AddCompanies stores the canonical metadata of tickers, as the companies table of the
+// SQL repository, replacing the one of a stored ticker.
+func (r *MemoryStockRepository) AddCompanies(companies ...models.Company) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range companies {
+		r.companies[c.Ticker] = c
+	}
+	if len(companies) > 0 {
+		r.version++
+	}
+}
+
+// withCompany returns s with the metadata of its ticker.
+func (r *MemoryStockRepository) withCompany(s models.Stock) models.Stock {
+	if c, ok := r.companies[s.Ticker]; ok {
+		s.CompanyInfo = &c
+	}
+	return s
+}
+
+// Add stores events as the ETL loads them: an event with the ticker and time of a
+// stored one replaces it, and every added event gets the next ingest sequence.
+func (r *MemoryStockRepository) Add(events ...models.StockWithScore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range events {
+		r.events = slices.DeleteFunc(r.events, func(stored models.StockEvent) bool {
+			return stored.Ticker == e.Ticker && stored.Time.Equal(e.Time)
+		})
+		r.seq++
+		r.events = append(r.events, models.StockEvent{Seq: r.seq, StockWithScore: e})
+	}
+	if len(events) > 0 {
+		r.version++
+	}
+}
+
+func (r *MemoryStockRepository) GetStocks(ctx context.Context, q StockQuery) ([]models.Stock, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches, err := r.stocks(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	stocks := []models.Stock{}
+	for _, e := range paginate(matches, q.Page, q.Limit) {
+		stocks = append(stocks, r.withCompany(e.Stock))
+	}
+	return stocks, len(matches), nil
+}
+
+// stocks returns the events of q, sorted but not paginated.
+func (r *MemoryStockRepository) stocks(q StockQuery) ([]models.StockEvent, error) {
+	if _, err := stockOrder(q); err != nil {
+		return nil, err
+	}
+	matches, err := r.filter(q.Search, q.Matches, q.WatchlistID)
+	if err != nil {
+		return nil, err
+	}
+	column, desc := q.SortBy, !strings.EqualFold(q.Order, "asc")
+	if column == "" {
+		column, desc = "time", true
+	}
+	slices.SortStableFunc(matches, func(a, b models.StockEvent) int {
+		if q.SortBy == "" && len(q.Matches) > 0 {
+			if c := cmp.Compare(relevance(q.Matches, &a.Stock), relevance(q.Matches, &b.Stock)); c != 0 {
+				return c
+			}
+		}
+		c := compareColumn(column, &a.Stock, &b.Stock)
+		if desc {
+			return -c
+		}
+		return c
+	})
+	return matches, nil
+}
+
+func (r *MemoryStockRepository) GetStockByTicker(ctx context.Context, ticker string) (*models.Stock, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *models.Stock
+	for i := range r.events {
+		if s := &r.events[i].Stock; s.Ticker == ticker && (latest == nil || s.Time.After(latest.Time)) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("stock %q: %w", ticker, sql.ErrNoRows)
+	}
+	stock := r.withCompany(*latest)
+	return &stock, nil
+}
+
+func (r *MemoryStockRepository) GetTopRecommendedStocks(ctx context.Context, q RecommendationQuery) ([]models.StockWithScore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches, err := r.recommended(q)
+	if err != nil {
+		return nil, err
+	}
+	recommendations := []models.StockWithScore{}
+	for _, e := range paginate(matches, q.Page, q.Limit) {
+		s := e.StockWithScore
+		s.Stock = r.withCompany(s.Stock)
+		s.Company = fmt.Sprintf("%s (score: %.2f)", s.Company, s.RecommendationScore)
+		recommendations = append(recommendations, s)
+	}
+	return recommendations, nil
+}
+
+// recommended returns the events of q by score, not paginated.
+func (r *MemoryStockRepository) recommended(q RecommendationQuery) ([]models.StockEvent, error) {
+	matches, err := r.filter("", nil, q.WatchlistID)
+	if err != nil {
+		return nil, err
+	}
+	matches = slices.DeleteFunc(matches, func(e models.StockEvent) bool { return e.RecommendationScore < q.MinimumScore })
+	slices.SortStableFunc(matches, func(a, b models.StockEvent) int {
+		return cmp.Or(cmp.Compare(b.RecommendationScore, a.RecommendationScore), b.Time.Compare(a.Time))
+	})
+	return matches, nil
+}
+
+func (r *MemoryStockRepository) GetStats(ctx context.Context, watchlistID string) (*models.StockStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches, err := r.filter("", nil, watchlistID)
+	if err != nil {
+		return nil, err
+	}
+	stats := models.StockStats{ByAction: map[string]int{}, ByRating: map[string]int{}}
+	tickers, brokerages := map[string]bool{}, map[string]bool{}
+	total := 0.0
+	for i, e := range matches {
+		stats.Events++
+		tickers[e.Ticker] = true
+		brokerages[e.Brokerage] = true
+		total += e.RecommendationScore
+		if i == 0 || e.RecommendationScore > stats.MaxScore {
+			stats.MaxScore = e.RecommendationScore
+		}
+		if stats.LatestEvent == nil || e.Time.After(*stats.LatestEvent) {
+			latest := e.Time
+			stats.LatestEvent = &latest
+		}
+		stats.ByAction[e.Action]++
+		stats.ByRating[e.RatingTo]++
+	}
+	stats.Tickers, stats.Brokerages = len(tickers), len(brokerages)
+	if stats.Events > 0 {
+		stats.AverageScore = total / float64(stats.Events)
+	}
+	return &stats, nil
+}
+
+func (r *MemoryStockRepository) GetStockEvents(ctx context.Context, q StockQuery, afterSeq int64, limit int) ([]models.StockEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches, err := r.filter(q.Search, nil, q.WatchlistID)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.StockEvent{}
+	for _, e := range matches { // already in ingest order
+		if e.Seq > afterSeq && len(events) < limit {
+			e.Stock = r.withCompany(e.Stock)
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *MemoryStockRepository) GetLatestIngestSeq(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var seq int64
+	for _, e := range r.events {
+		seq = max(seq, e.Seq)
+	}
+	return seq, nil
+}
+
+func (r *MemoryStockRepository) GetDataVersion(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version, nil
+}
+
+func (r *MemoryStockRepository) GetSearchActivity(ctx context.Context, recentSince time.Time) ([]search.Activity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type key struct{ ticker, company, brokerage string }
+	byKey := map[key]int{}
+	var activity []search.Activity
+	for _, e := range r.events {
+		k := key{e.Ticker, e.Company, e.Brokerage}
+		i, ok := byKey[k]
+		if !ok {
+			i = len(activity)
+			byKey[k] = i
+			activity = append(activity, search.Activity{Ticker: e.Ticker, Company: e.Company, Brokerage: e.Brokerage})
+		}
+		a := &activity[i]
+		a.Events++
+		if !e.Time.Before(recentSince) {
+			a.RecentEvents++
+		}
+		if e.Time.After(a.LatestEvent) {
+			a.LatestEvent = e.Time
+		}
+	}
+	return activity, nil
+}
+
+func (r *MemoryStockRepository) GetSectors(ctx context.Context, q SectorQuery) ([]models.SectorRollup, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if q.Sector != "" {
+		name, err := r.sectorName(q.Sector)
+		if err != nil {
+			return nil, err
+		}
+		q.Sector = name
+	}
+	var rows []sectorRow
+	index := map[string]int{} // ticker -> row
+	for _, e := range r.events {
+		c, ok := r.companies[e.Ticker]
+		if !ok || c.Sector == "" || (q.Sector != "" && c.Sector != q.Sector) || e.Time.Before(q.Since) {
+			continue
+		}
+		i, ok := index[e.Ticker]
+		if !ok {
+			i = len(rows)
+			index[e.Ticker] = i
+			rows = append(rows, sectorRow{sector: c.Sector, industry: c.Industry, ticker: c.Ticker, company: c.Name})
+		}
+		rows[i].events++
+		rows[i].scoreSum += e.RecommendationScore
+		rows[i].upgrades += boolInt(e.Action == models.ActionUpgraded)
+		rows[i].downgrades += boolInt(e.Action == models.ActionDowngraded)
+	}
+	sectors := buildSectors(rows, q.Top)
+	if q.Sector != "" && len(sectors) == 0 {
+		sectors = append(sectors, emptySector(q.Sector))
+	}
+	return sectors, nil
+}
+
+func (r *MemoryStockRepository) GetSectorRecommendations(ctx context.Context, q SectorQuery) ([]models.StockWithScore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, err := r.sectorName(q.Sector)
+	if err != nil {
+		return nil, err
+	}
+	var matches []models.StockEvent
+	for _, e := range r.events {
+		if r.companies[e.Ticker].Sector == name && !e.Time.Before(q.Since) {
+			matches = append(matches, e)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b models.StockEvent) int {
+		return cmp.Or(cmp.Compare(b.RecommendationScore, a.RecommendationScore), b.Time.Compare(a.Time))
+	})
+	recommendations := []models.StockWithScore{}
+	for _, e := range paginate(matches, q.Page, q.Limit) {
+		s := e.StockWithScore
+		s.Stock = r.withCompany(s.Stock)
+		recommendations = append(recommendations, s)
+	}
+	return recommendations, nil
+}
+
+// sectorName returns the name of the sector as written in the companies, compared
+// ignoring the case.
+func (r *MemoryStockRepository) sectorName(sector string) (string, error) {
+	for _, c := range r.companies {
+		if c.Sector != "" && strings.EqualFold(c.Sector, sector) {
+			return c.Sector, nil
+		}
+	}
+	return "", sectorNotFound(sector)
+}
+
+func (r *MemoryStockRepository) ExportStocks(ctx context.Context, q StockQuery, each func(models.StockWithScore) error) error {
+	r.mu.RLock()
+	matches, err := r.stocks(q)
+	r.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return r.export(matches, each)
+}
+
+func (r *MemoryStockRepository) ExportRecommendations(ctx context.Context, q RecommendationQuery, each func(models.StockWithScore) error) error {
+	r.mu.RLock()
+	matches, err := r.recommended(q)
+	r.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return r.export(matches, each)
+}
+
+// export calls each with the events, without holding the lock while it writes them.
+func (r *MemoryStockRepository) export(events []models.StockEvent, each func(models.StockWithScore) error) error {
+	for _, e := range events {
+		s := e.StockWithScore
+		r.mu.RLock()
+		s.Stock = r.withCompany(s.Stock)
+		r.mu.RUnlock()
+		if err := each(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryStockRepository) ListWatchlists(ctx context.Context) ([]models.Watchlist, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	watchlists := []models.Watchlist{}
+	for _, w := range r.watchlists {
+		watchlists = append(watchlists, copyWatchlist(w))
+	}
+	return watchlists, nil
+}
+
+func (r *MemoryStockRepository) GetWatchlist(ctx context.Context, id string) (*models.Watchlist, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, err := r.watchlist(id)
+	if err != nil {
+		return nil, err
+	}
+	c := copyWatchlist(w)
+	return &c, nil
+}
+
+func (r *MemoryStockRepository) CreateWatchlist(ctx context.Context, name string, tickers []string) (*models.Watchlist, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := &models.Watchlist{ID: newUUID(), Name: name, Tickers: []string{}, CreatedAt: r.now().UTC()}
+	addTickers(w, tickers)
+	r.watchlists = append(r.watchlists, w)
+	c := copyWatchlist(w)
+	return &c, nil
+}
+
+func (r *MemoryStockRepository) RenameWatchlist(ctx context.Context, id, name string) (*models.Watchlist, error) {
+	return r.updateWatchlist(id, func(w *models.Watchlist) error {
+		w.Name = name
+		return nil
+	})
+}
+
+func (r *MemoryStockRepository) DeleteWatchlist(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted, err := r.watchlist(id)
+	if err != nil {
+		return err
+	}
+	r.watchlists = slices.DeleteFunc(r.watchlists, func(w *models.Watchlist) bool { return w == deleted })
+	r.version++
+	return nil
+}
+
+func (r *MemoryStockRepository) AddWatchlistTickers(ctx context.Context, id string, tickers []string) (*models.Watchlist, error) {
+	return r.updateWatchlist(id, func(w *models.Watchlist) error {
+		addTickers(w, tickers)
+		r.version++
+		return nil
+	})
+}
+
+func (r *MemoryStockRepository) RemoveWatchlistTicker(ctx context.Context, id, ticker string) (*models.Watchlist, error) {
+	return r.updateWatchlist(id, func(w *models.Watchlist) error {
+		i := slices.Index(w.Tickers, ticker)
+		if i < 0 {
+			return fmt.Errorf("ticker %q in watchlist %q: %w", ticker, id, sql.ErrNoRows)
+		}
+		w.Tickers = slices.Delete(w.Tickers, i, i+1)
+		r.version++
+		return nil
+	})
+}
+
+// updateWatchlist applies update to the watchlist id and returns a copy of it.
+func (r *MemoryStockRepository) updateWatchlist(id string, update func(w *models.Watchlist) error) (*models.Watchlist, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, err := r.watchlist(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(w); err != nil {
+		return nil, err
+	}
+	c := copyWatchlist(w)
+	return &c, nil
+}
+
+// watchlist returns the watchlist id. r.mu must be held.
+func (r *MemoryStockRepository) watchlist(id string) (*models.Watchlist, error) {
+	for _, w := range r.watchlists {
+		if strings.EqualFold(w.ID, id) {
+			return w, nil
+		}
+	}
+	return nil, watchlistNotFound(id)
+}
+
+// filter returns the events matching the search matches, or else the text (in the
+// ticker or company, ignoring the case), and the tickers of the watchlist, in ingest
+// order. r.mu must be held.
+func (r *MemoryStockRepository) filter(text string, matches []search.Term, watchlistID string) ([]models.StockEvent, error) {
+	var tickers []string
+	if watchlistID != "" {
+		w, err := r.watchlist(watchlistID)
+		if err != nil {
+			return nil, err
+		}
+		tickers = w.Tickers
+	}
+	text = strings.ToLower(text)
+
+	var events []models.StockEvent
+	for _, e := range r.events {
+		switch {
+		case len(matches) > 0:
+			if relevance(matches, &e.Stock) == len(matches) {
+				continue
+			}
+		case text != "" && !strings.Contains(strings.ToLower(e.Ticker), text) && !strings.Contains(strings.ToLower(e.Company), text):
+			continue
+		}
+		if watchlistID != "" && !slices.Contains(tickers, e.Ticker) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// relevance returns the position of the first of matches that s has, len(matches) if
+// none.
+func relevance(matches []search.Term, s *models.Stock) int {
+	for i, m := range matches {
+		var value string
+		switch m.Field {
+		case search.FieldTicker:
+			value = s.Ticker
+		case search.FieldCompany:
+			value = s.Company
+		case search.FieldBrokerage:
+			value = s.Brokerage
+		}
+		if value == m.Value {
+			return i
+		}
+	}
+	return len(matches)
+}
+
+// compareColumn compares a and b by one of the SortColumns. Missing targets sort
+// first, as NULL does in CockroachDB.
+func compareColumn(column string, a, b *models.Stock) int {
+	switch column {
+	case "ticker":
+		return strings.Compare(a.Ticker, b.Ticker)
+	case "company":
+		return strings.Compare(a.Company, b.Company)
+	case "brokerage":
+		return strings.Compare(a.Brokerage, b.Brokerage)
+	case "action":
+		return strings.Compare(a.Action, b.Action)
+	case "rating_from":
+		return strings.Compare(a.RatingFrom, b.RatingFrom)
+	case "rating_to":
+		return strings.Compare(a.RatingTo, b.RatingTo)
+	case "target_from", "target_to":
+		x, y := a.TargetFrom, b.TargetFrom
+		if column == "target_to" {
+			x, y = a.TargetTo, b.TargetTo
+		}
+		if !x.Valid || !y.Valid {
+			return cmp.Compare(boolInt(x.Valid), boolInt(y.Valid))
+		}
+		return x.Decimal.Cmp(y.Decimal)
+	}
+	return a.Time.Compare(b.Time)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// paginate returns the page (from 1) of items with limit items per page.
+func paginate[T any](items []T, page, limit int) []T {
+	start := min(max(page-1, 0)*limit, len(items))
+	return items[start:min(start+limit, len(items))]
+}
+
+// addTickers adds the tickers that aren't in w yet, keeping them sorted.
+func addTickers(w *models.Watchlist, tickers []string) {
+	for _, t := range tickers {
+		if !slices.Contains(w.Tickers, t) {
+			w.Tickers = append(w.Tickers, t)
+		}
+	}
+	slices.Sort(w.Tickers)
+}
+
+func copyWatchlist(w *models.Watchlist) models.Watchlist {
+	c := *w
+	c.Tickers = slices.Clone(w.Tickers)
+	return c
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
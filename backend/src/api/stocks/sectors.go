@@ -0,0 +1,103 @@
+package stocks
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// SectorQuery selects the events of GetSectors and GetSectorRecommendations: the ones
+// since Since of the tickers with a sector in the companies table.
+type SectorQuery struct {
+	Sector      string // if set, only this sector, compared ignoring the case
+	Since       time.Time
+	Top         int // top tickers per sector
+	Page, Limit int // of GetSectorRecommendations
+}
+
+// sectorRow aggregates the events of a ticker in the window of a SectorQuery. The
+// repositories read them and buildSectors rolls them up, so the rollups are the same.
+type sectorRow struct {
+	sector, industry, ticker, company string
+	events                            int
+	scoreSum                          float64
+	upgrades, downgrades              int
+}
+
+// buildSectors rolls up the rows by sector, best balance first, with the top tickers
+// of each one by average score and its industries by balance.
+func buildSectors(rows []sectorRow, top int) []models.SectorRollup {
+	type group struct {
+		rollup   models.Rollup
+		scoreSum float64
+	}
+	add := func(g *group, r sectorRow, ticker bool) {
+		g.rollup.Events += r.events
+		g.rollup.Upgrades += r.upgrades
+		g.rollup.Downgrades += r.downgrades
+		if ticker {
+			g.rollup.Tickers++
+		}
+		g.scoreSum += r.scoreSum
+	}
+	finish := func(g *group) models.Rollup {
+		r := g.rollup
+		r.Balance = r.Upgrades - r.Downgrades
+		if r.Events > 0 {
+			r.AverageScore = math.Round(g.scoreSum/float64(r.Events)*100) / 100
+		}
+		return r
+	}
+
+	var names []string
+	sectors := map[string]*group{}
+	industries := map[string]map[string]*group{}
+	tickers := map[string][]models.TickerRollup{}
+	for _, r := range rows {
+		if sectors[r.sector] == nil {
+			names = append(names, r.sector)
+			sectors[r.sector] = &group{}
+			industries[r.sector] = map[string]*group{}
+		}
+		add(sectors[r.sector], r, true)
+		if industries[r.sector][r.industry] == nil {
+			industries[r.sector][r.industry] = &group{}
+		}
+		add(industries[r.sector][r.industry], r, true)
+		t := &group{}
+		add(t, r, false)
+		tickers[r.sector] = append(tickers[r.sector], models.TickerRollup{Ticker: r.ticker, Company: r.company, Rollup: finish(t)})
+	}
+
+	byBalance := func(a, b models.Rollup) int {
+		return cmp.Or(cmp.Compare(b.Balance, a.Balance), cmp.Compare(b.AverageScore, a.AverageScore))
+	}
+	result := make([]models.SectorRollup, 0, len(names))
+	for _, name := range names {
+		s := models.SectorRollup{Sector: name, Rollup: finish(sectors[name]), Industries: []models.IndustryRollup{}}
+		for industry, g := range industries[name] {
+			s.Industries = append(s.Industries, models.IndustryRollup{Industry: industry, Rollup: finish(g)})
+		}
+		slices.SortFunc(s.Industries, func(a, b models.IndustryRollup) int {
+			return cmp.Or(byBalance(a.Rollup, b.Rollup), cmp.Compare(a.Industry, b.Industry))
+		})
+		s.TopTickers = tickers[name]
+		slices.SortFunc(s.TopTickers, func(a, b models.TickerRollup) int {
+			return cmp.Or(cmp.Compare(b.AverageScore, a.AverageScore), cmp.Compare(b.Events, a.Events), cmp.Compare(a.Ticker, b.Ticker))
+		})
+		s.TopTickers = s.TopTickers[:min(top, len(s.TopTickers))]
+		result = append(result, s)
+	}
+	slices.SortFunc(result, func(a, b models.SectorRollup) int {
+		return cmp.Or(byBalance(a.Rollup, b.Rollup), cmp.Compare(a.Sector, b.Sector))
+	})
+	return result
+}
+
+// emptySector is the rollup of a sector without events in the window.
+func emptySector(name string) models.SectorRollup {
+	return models.SectorRollup{Sector: name, TopTickers: []models.TickerRollup{}, Industries: []models.IndustryRollup{}}
+}
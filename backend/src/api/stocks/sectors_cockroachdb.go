@@ -0,0 +1,107 @@
+package stocks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+func sectorNotFound(name string) error {
+	return fmt.Errorf("sector %q: %w", name, sql.ErrNoRows)
+}
+
+// sectorName returns the name of the sector, as written in the companies table, or an
+// error wrapping sql.ErrNoRows if no company has it.
+func (r *CockroachDBStockRepository) sectorName(ctx context.Context, sector string) (string, error) {
+	var name string
+	err := r.DB.QueryRowContext(ctx, `SELECT sector FROM companies WHERE LOWER(sector) = LOWER($1) LIMIT 1`, sector).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", sectorNotFound(sector)
+	}
+	return name, err
+}
+
+func (r *CockroachDBStockRepository) GetSectors(ctx context.Context, q SectorQuery) ([]models.SectorRollup, error) {
+	where := "s.time >= $1 AND COALESCE(c.sector, '') <> ''"
+	args := []any{q.Since.UTC(), models.ActionUpgraded, models.ActionDowngraded}
+	if q.Sector != "" {
+		name, err := r.sectorName(ctx, q.Sector)
+		if err != nil {
+			return nil, err
+		}
+		q.Sector = name
+		where += " AND c.sector = $4"
+		args = append(args, name)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT c.sector, COALESCE(c.industry, ''), s.ticker, c.name, COUNT(*),
+		       COALESCE(SUM(s.recommendation_score), 0),
+		       SUM(CASE WHEN s.action = $2 THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN s.action = $3 THEN 1 ELSE 0 END)
+		FROM stocks s JOIN companies c ON c.ticker = s.ticker
+		WHERE `+where+`
+		GROUP BY c.sector, c.industry, s.ticker, c.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []sectorRow
+	for rows.Next() {
+		var g sectorRow
+		if err := rows.Scan(&g.sector, &g.industry, &g.ticker, &g.company, &g.events, &g.scoreSum, &g.upgrades, &g.downgrades); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sectors := buildSectors(groups, q.Top)
+	if q.Sector != "" && len(sectors) == 0 {
+		sectors = append(sectors, emptySector(q.Sector))
+	}
+	return sectors, nil
+}
+
+func (r *CockroachDBStockRepository) GetSectorRecommendations(ctx context.Context, q SectorQuery) ([]models.StockWithScore, error) {
+	name, err := r.sectorName(ctx, q.Sector)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT ticker, company, brokerage, action, rating_from, rating_to, target_from, target_to,
+		       COALESCE(target_currency, ''), time, company_mismatch, recommendation_score
+		FROM stocks
+		WHERE time >= $1 AND ticker IN (SELECT ticker FROM companies WHERE sector = $2)
+		ORDER BY recommendation_score DESC, time DESC
+		LIMIT $3 OFFSET $4`, q.Since.UTC(), name, q.Limit, (q.Page-1)*q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := []models.StockWithScore{}
+	for rows.Next() {
+		var s models.StockWithScore
+		err := rows.Scan(&s.Ticker, &s.Company, &s.Brokerage, &s.Action, &s.RatingFrom, &s.RatingTo,
+			&s.TargetFrom, &s.TargetTo, &s.TargetCurrency, &s.Time, &s.CompanyMismatch, &s.RecommendationScore)
+		if err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stocks := make([]*models.Stock, len(recommendations))
+	for i := range recommendations {
+		stocks[i] = &recommendations[i].Stock
+	}
+	return recommendations, r.attachCompanies(ctx, stocks...)
+}
@@ -0,0 +1,81 @@
+package stocks
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+// Windows of the sector rollups: the default and the range of ?window=.
+const (
+	defaultSectorWindow = 30 * 24 * time.Hour
+	minSectorWindow     = time.Hour
+	maxSectorWindow     = 365 * 24 * time.Hour
+)
+
+// maxTopTickers is the maximum ?top= of the sector rollups.
+const maxTopTickers = 20
+
+// sectorQuery parses the window and top tickers of the sector endpoints.
+func (h *Handler) sectorQuery(p *problem.Params) SectorQuery {
+	window := p.Duration("window", defaultSectorWindow, minSectorWindow, maxSectorWindow)
+	top := p.Int("top", 5, 1, maxTopTickers)
+	now := time.Now
+	if h.now != nil {
+		now = h.now
+	}
+	return SectorQuery{Since: now().Add(-window).UTC(), Top: top}
+}
+
+// GetSectors answers with the rollups of the events of the window by the sector of
+// their ticker, the sectors the brokerages are rotating into first.
+func (h *Handler) GetSectors(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	q := h.sectorQuery(p)
+	if !p.Check(w, r) {
+		return
+	}
+
+	sectors, err := h.Sectors.GetSectors(r.Context(), q)
+	if err != nil {
+		problem.Internal(w, r, "Failed to get sectors", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"since":   q.Since,
+		"sectors": sectors,
+	})
+}
+
+// GetSectorRecommendations answers with the rollup of a sector and a page of its
+// events of the window, by score.
+func (h *Handler) GetSectorRecommendations(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	q := h.sectorQuery(p)
+	q.Page = p.Int("page", 1, 1, math.MaxInt32)
+	q.Limit = p.Int("limit", 10, 1, h.maxPageSize())
+	if !p.Check(w, r) {
+		return
+	}
+	q.Sector = r.PathValue("sector")
+
+	sectors, err := h.Sectors.GetSectors(r.Context(), q)
+	if err != nil {
+		problem.FromError(w, r, err, "Sector not found", "Failed to get the sector")
+		return
+	}
+	recommendations, err := h.Sectors.GetSectorRecommendations(r.Context(), q)
+	if err != nil {
+		problem.FromError(w, r, err, "Sector not found", "Failed to get the sector recommendations")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"since":  q.Since,
+		"sector": sectors[0],
+		"items":  recommendations,
+		"page":   q.Page,
+		"limit":  q.Limit,
+	})
+}
@@ -0,0 +1,193 @@
+package stocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+// maxWatchlistNameLength is the maximum length of a watchlist name, in bytes.
+const maxWatchlistNameLength = 100
+
+// tickerPattern matches the tickers accepted in watchlists, once uppercased
+// (e.g. "AAPL", "BRK.B", "RDS-A").
+var tickerPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.\-]{0,14}$`)
+
+type watchlistRequest struct {
+	Name    *string  `json:"name"`
+	Tickers []string `json:"tickers"`
+}
+
+// ListWatchlists answers with every watchlist and its tickers.
+func (h *Handler) ListWatchlists(w http.ResponseWriter, r *http.Request) {
+	watchlists, err := h.Watchlists.ListWatchlists(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "Failed to list watchlists", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, watchlists)
+}
+
+// CreateWatchlist creates a watchlist from {"name": "...", "tickers": ["AAPL", ...]}.
+func (h *Handler) CreateWatchlist(w http.ResponseWriter, r *http.Request) {
+	var req watchlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	if req.Name == nil {
+		problem.Invalid(w, r, problem.FieldError{Field: "name", Code: problem.FieldRequired, Message: "is required"})
+		return
+	}
+	name, err := normalizeWatchlistName(*req.Name)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	tickers, err := normalizeTickers(req.Tickers)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	watchlist, err := h.Watchlists.CreateWatchlist(r.Context(), name, tickers)
+	if err != nil {
+		problem.Internal(w, r, "Failed to create watchlist", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, watchlist)
+}
+
+// GetWatchlist answers with a watchlist and its tickers.
+func (h *Handler) GetWatchlist(w http.ResponseWriter, r *http.Request) {
+	watchlist, err := h.Watchlists.GetWatchlist(r.Context(), r.PathValue("id"))
+	writeWatchlist(w, r, watchlist, err)
+}
+
+// UpdateWatchlist renames a watchlist with {"name": "..."}.
+func (h *Handler) UpdateWatchlist(w http.ResponseWriter, r *http.Request) {
+	var req watchlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	if req.Name == nil {
+		problem.Invalid(w, r, problem.FieldError{Field: "name", Code: problem.FieldRequired, Message: "is required"})
+		return
+	}
+	name, err := normalizeWatchlistName(*req.Name)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	watchlist, err := h.Watchlists.RenameWatchlist(r.Context(), r.PathValue("id"), name)
+	writeWatchlist(w, r, watchlist, err)
+}
+
+// DeleteWatchlist deletes a watchlist and its tickers.
+func (h *Handler) DeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	err := h.Watchlists.DeleteWatchlist(r.Context(), r.PathValue("id"))
+	if err != nil {
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to delete watchlist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWatchlistTickers answers with the sorted tickers of a watchlist.
+func (h *Handler) GetWatchlistTickers(w http.ResponseWriter, r *http.Request) {
+	watchlist, err := h.Watchlists.GetWatchlist(r.Context(), r.PathValue("id"))
+	if err != nil {
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to get watchlist")
+		return
+	}
+	writeJSON(w, http.StatusOK, watchlist.Tickers)
+}
+
+// AddWatchlistTickers adds {"tickers": ["AAPL", ...]} to a watchlist and answers with it.
+func (h *Handler) AddWatchlistTickers(w http.ResponseWriter, r *http.Request) {
+	var req watchlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	tickers, err := normalizeTickers(req.Tickers)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if len(tickers) == 0 {
+		problem.Invalid(w, r, problem.FieldError{Field: "tickers", Code: problem.FieldRequired, Message: "is required"})
+		return
+	}
+
+	watchlist, err := h.Watchlists.AddWatchlistTickers(r.Context(), r.PathValue("id"), tickers)
+	writeWatchlist(w, r, watchlist, err)
+}
+
+// RemoveWatchlistTicker removes a ticker from a watchlist and answers with it.
+func (h *Handler) RemoveWatchlistTicker(w http.ResponseWriter, r *http.Request) {
+	ticker := strings.ToUpper(strings.TrimSpace(r.PathValue("ticker")))
+	watchlist, err := h.Watchlists.RemoveWatchlistTicker(r.Context(), r.PathValue("id"), ticker)
+	writeWatchlist(w, r, watchlist, err)
+}
+
+// writeWatchlist answers with watchlist, or with the error of the repository call that returned it.
+func writeWatchlist(w http.ResponseWriter, r *http.Request, watchlist any, err error) {
+	if err != nil {
+		problem.FromError(w, r, err, "Watchlist not found", "Failed to update watchlist")
+		return
+	}
+	writeJSON(w, http.StatusOK, watchlist)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// normalizeWatchlistName trims name and checks it isn't empty or too long. Errors
+// are *problem.Error.
+func normalizeWatchlistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", problem.Validation(problem.FieldError{Field: "name", Code: problem.FieldRequired, Message: "must not be empty"})
+	}
+	if len(name) > maxWatchlistNameLength {
+		return "", problem.Validation(problem.FieldError{Field: "name", Code: problem.FieldOutOfRange,
+			Message: fmt.Sprintf("must be at most %d characters", maxWatchlistNameLength)})
+	}
+	return name, nil
+}
+
+// normalizeTickers uppercases, validates, sorts and deduplicates tickers. Errors are
+// *problem.Error, with the position of each invalid ticker.
+func normalizeTickers(tickers []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	var errs []problem.FieldError
+	for i, t := range tickers {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if !tickerPattern.MatchString(t) {
+			errs = append(errs, problem.FieldError{Field: fmt.Sprintf("tickers[%d]", i), Code: problem.FieldInvalid,
+				Message: fmt.Sprintf("invalid ticker %q", t)})
+			continue
+		}
+		if !seen[t] {
+			seen[t] = true
+			normalized = append(normalized, t)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, problem.Validation(errs...)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
@@ -0,0 +1,32 @@
+package stocks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTickers(t *testing.T) {
+	tests := []struct {
+		input    []string
+		expected []string
+		err      bool
+	}{
+		{nil, []string{}, false},
+		{[]string{" aapl", "MSFT", "AAPL", "brk.b"}, []string{"AAPL", "BRK.B", "MSFT"}, false},
+		{[]string{"RDS-A"}, []string{"RDS-A"}, false},
+		{[]string{""}, nil, true},
+		{[]string{"AAPL; DROP TABLE stocks"}, nil, true},
+		{[]string{"-AAPL"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTickers(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("normalizeTickers(%q) error = %v; want error: %v", tt.input, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("normalizeTickers(%q) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
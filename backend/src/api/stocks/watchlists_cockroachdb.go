@@ -0,0 +1,221 @@
+package stocks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// uuidPattern matches the watchlist ids. Other ids can't exist, and are reported as not
+// found instead of as a failed cast in the database.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func watchlistNotFound(id string) error {
+	return fmt.Errorf("watchlist %q: %w", id, sql.ErrNoRows)
+}
+
+// checkWatchlist returns an error wrapping sql.ErrNoRows if id is set and there's no
+// watchlist with that id.
+func (r *CockroachDBStockRepository) checkWatchlist(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	if !uuidPattern.MatchString(id) {
+		return watchlistNotFound(id)
+	}
+	var exists bool
+	if err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM watchlists WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return watchlistNotFound(id)
+	}
+	return nil
+}
+
+func (r *CockroachDBStockRepository) ListWatchlists(ctx context.Context) ([]models.Watchlist, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, name, created_at FROM watchlists ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchlists := []models.Watchlist{}
+	byID := map[string]int{}
+	for rows.Next() {
+		w := models.Watchlist{Tickers: []string{}}
+		if err := rows.Scan(&w.ID, &w.Name, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		byID[strings.ToLower(w.ID)] = len(watchlists)
+		watchlists = append(watchlists, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the tickers are read apart, as SQLite has no arrays to aggregate them
+	tickers, err := r.DB.QueryContext(ctx, `SELECT watchlist_id, ticker FROM watchlist_tickers ORDER BY ticker`)
+	if err != nil {
+		return nil, err
+	}
+	defer tickers.Close()
+	for tickers.Next() {
+		var id, ticker string
+		if err := tickers.Scan(&id, &ticker); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[strings.ToLower(id)]; ok {
+			watchlists[i].Tickers = append(watchlists[i].Tickers, ticker)
+		}
+	}
+	return watchlists, tickers.Err()
+}
+
+func (r *CockroachDBStockRepository) GetWatchlist(ctx context.Context, id string) (*models.Watchlist, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, watchlistNotFound(id)
+	}
+
+	var w models.Watchlist
+	err := r.DB.QueryRowContext(ctx, `SELECT id, name, created_at FROM watchlists WHERE id = $1`, id).
+		Scan(&w.ID, &w.Name, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, watchlistNotFound(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `SELECT ticker FROM watchlist_tickers WHERE watchlist_id = $1 ORDER BY ticker`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	w.Tickers = []string{}
+	for rows.Next() {
+		var ticker string
+		if err := rows.Scan(&ticker); err != nil {
+			return nil, err
+		}
+		w.Tickers = append(w.Tickers, ticker)
+	}
+	return &w, rows.Err()
+}
+
+func (r *CockroachDBStockRepository) CreateWatchlist(ctx context.Context, name string, tickers []string) (*models.Watchlist, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, `INSERT INTO watchlists (name, created_at) VALUES ($1, $2) RETURNING id`, name, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertWatchlistTickers(ctx, tx, id, tickers); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWatchlist(ctx, id)
+}
+
+func (r *CockroachDBStockRepository) RenameWatchlist(ctx context.Context, id, name string) (*models.Watchlist, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, watchlistNotFound(id)
+	}
+	res, err := r.DB.ExecContext(ctx, `UPDATE watchlists SET name = $2 WHERE id = $1`, id, name)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, watchlistNotFound(id)
+	}
+	return r.GetWatchlist(ctx, id)
+}
+
+func (r *CockroachDBStockRepository) DeleteWatchlist(ctx context.Context, id string) error {
+	if !uuidPattern.MatchString(id) {
+		return watchlistNotFound(id)
+	}
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM watchlists WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return watchlistNotFound(id)
+	}
+	r.bumpDataVersion(ctx)
+	return nil
+}
+
+func (r *CockroachDBStockRepository) AddWatchlistTickers(ctx context.Context, id string, tickers []string) (*models.Watchlist, error) {
+	if err := r.checkWatchlist(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := insertWatchlistTickers(ctx, r.DB, id, tickers); err != nil {
+		return nil, err
+	}
+	r.bumpDataVersion(ctx)
+	return r.GetWatchlist(ctx, id)
+}
+
+func (r *CockroachDBStockRepository) RemoveWatchlistTicker(ctx context.Context, id, ticker string) (*models.Watchlist, error) {
+	if err := r.checkWatchlist(ctx, id); err != nil {
+		return nil, err
+	}
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM watchlist_tickers WHERE watchlist_id = $1 AND ticker = $2`, id, ticker)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, fmt.Errorf("ticker %q in watchlist %q: %w", ticker, id, sql.ErrNoRows)
+	}
+	r.bumpDataVersion(ctx)
+	return r.GetWatchlist(ctx, id)
+}
+
+// bumpDataVersion moves the data version after a change of the tickers of a watchlist,
+// which changes the answers filtered by it (see etl.BumpDataVersion). Its error is
+// only logged, as the change is already stored.
+func (r *CockroachDBStockRepository) bumpDataVersion(ctx context.Context) {
+	_, err := r.DB.ExecContext(ctx, `UPDATE data_version SET version = version + 1, updated_at = $1`, time.Now().UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to bump the data version", "error", err)
+	}
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertWatchlistTickers adds tickers to the watchlist id, skipping the ones already in it.
+func insertWatchlistTickers(ctx context.Context, db execer, id string, tickers []string) error {
+	for _, ticker := range tickers {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO watchlist_tickers (watchlist_id, ticker) VALUES ($1, $2)
+			ON CONFLICT (watchlist_id, ticker) DO NOTHING
+		`, id, ticker)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// Defaults of the Dispatcher.
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseBackoff = 30 * time.Second
+	DefaultMaxBackoff  = 6 * time.Hour
+
+	claimBatch     = 10
+	requestTimeout = 10 * time.Second
+	// claimLease is how long the claimed deliveries are kept from other dispatchers:
+	// the time to send the whole batch, one request after another, and a margin to
+	// record them. The deliveries still unsent when the batch runs out of time are left
+	// to the next claim after the lease.
+	claimSendTime = claimBatch * requestTimeout
+	claimLease    = claimSendTime + 30*time.Second
+)
+
+// Dispatcher sends the pending deliveries of the outbox.
+type Dispatcher struct {
+	Store  *Store
+	Client *http.Client // nil for a client with a 10s timeout
+
+	MaxAttempts int           // attempts before a delivery is failed; 0 for DefaultMaxAttempts
+	BaseBackoff time.Duration // wait after the first failed attempt, doubled after each one; 0 for DefaultBaseBackoff
+	MaxBackoff  time.Duration // 0 for DefaultMaxBackoff
+}
+
+// AfterETL queues the events inserted by an ETL run and tries to send them right away.
+// It has the signature of an etl.Hook, so events updated by the run aren't sent again.
+func (d *Dispatcher) AfterETL(ctx context.Context, inserted []models.StockWithScore) error {
+	queued, err := d.Store.Enqueue(ctx, inserted)
+	if err != nil {
+		return fmt.Errorf("queue webhook deliveries: %w", err)
+	}
+	if queued == 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "Webhook deliveries queued", "deliveries", queued)
+	_, _, err = d.DeliverPending(ctx)
+	return err
+}
+
+// Run sends the pending deliveries every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, _, err := d.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Webhook dispatcher failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending sends every due delivery once and returns how many were delivered
+// and how many attempts failed.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (delivered, failed int, err error) {
+	for {
+		claimedAt := time.Now()
+		due, err := d.Store.claim(ctx, claimBatch, claimLease)
+		if err != nil {
+			return delivered, failed, fmt.Errorf("claim webhook deliveries: %w", err)
+		}
+		if len(due) == 0 {
+			return delivered, failed, nil
+		}
+
+		for _, c := range due {
+			if time.Since(claimedAt) >= claimSendTime {
+				break // the lease of the rest could expire while they are sent
+			}
+			code, sendErr := d.send(ctx, c)
+			if sendErr == nil {
+				delivered++
+				err = d.Store.markDelivered(ctx, c.ID, code)
+			} else {
+				failed++
+				var next *time.Time
+				if attempts := c.Attempts + 1; attempts < d.maxAttempts() {
+					t := time.Now().Add(d.backoff(attempts))
+					next = &t
+				} else {
+					slog.WarnContext(ctx, "Webhook delivery failed", "delivery", c.ID, "url", c.URL, "attempts", attempts, "error", sendErr)
+				}
+				err = d.Store.markFailed(ctx, c.ID, code, sendErr, next)
+			}
+			if err != nil {
+				return delivered, failed, fmt.Errorf("record webhook delivery %s: %w", c.ID, err)
+			}
+		}
+	}
+}
+
+// send posts the payload of c to its URL, signed with its secret, within requestTimeout
+// whatever the Client. It returns the status code of the response, 0 if there was
+// none, and an error unless it was 2xx.
+func (d *Dispatcher) send(ctx context.Context, c claimed) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(c.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stock-recommender-webhooks/1")
+	req.Header.Set(HeaderID, c.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Signature(c.Secret, timestamp, c.Payload))
+
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("receiver answered %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // let the connection be reused
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts > 0 {
+		return d.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	base, maxWait := d.BaseBackoff, d.MaxBackoff
+	if base <= 0 {
+		base = DefaultBaseBackoff
+	}
+	if maxWait <= 0 {
+		maxWait = DefaultMaxBackoff
+	}
+	wait := base
+	for i := 1; i < attempts && wait < maxWait; i++ {
+		wait *= 2
+	}
+	return min(wait, maxWait)
+}
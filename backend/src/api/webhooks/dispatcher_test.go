@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+func TestSendSignsThePayload(t *testing.T) {
+	const secret = "whsec_0123456789abcdef"
+	payload := []byte(`{"id":"d1","type":"recommendation.created","data":{"ticker":"AKBA"}}`)
+
+	var received []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+			http.Error(w, "bad timestamp", http.StatusBadRequest)
+			return
+		}
+		// what a receiver does to verify a delivery
+		want := Signature(secret, timestamp, body)
+		if !hmac.Equal([]byte(r.Header.Get(HeaderSignature)), []byte(want)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(HeaderID) != "d1" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+		received = body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	d := &Dispatcher{}
+	code, err := d.send(context.Background(), claimed{ID: "d1", URL: receiver.URL, Secret: secret, Payload: payload})
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("send() = %d, %v; want 204 without error", code, err)
+	}
+	if string(received) != string(payload) {
+		t.Errorf("receiver got %s; want %s", received, payload)
+	}
+
+	// a receiver with another secret rejects the delivery
+	code, err = d.send(context.Background(), claimed{ID: "d1", URL: receiver.URL, Secret: "another secret!!", Payload: payload})
+	if code != http.StatusUnauthorized || err == nil || !strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("send() with a wrong secret = %d, %v; want 401 with the receiver message", code, err)
+	}
+}
+
+func TestSendWithoutResponse(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	receiver.Close() // nothing listening
+
+	code, err := (&Dispatcher{}).send(context.Background(), claimed{ID: "d1", URL: receiver.URL, Payload: []byte(`{}`)})
+	if code != 0 || err == nil {
+		t.Errorf("send() to a closed receiver = %d, %v; want 0 and an error", code, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseBackoff: time.Minute, MaxBackoff: 10 * time.Minute}
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{60, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := d.backoff(tt.attempts); got != tt.expected {
+			t.Errorf("backoff(%d) = %v; want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	event := models.StockWithScore{
+		Stock:               models.Stock{Ticker: "AKBA", Brokerage: "HC Wainwright", Action: models.ActionUpgraded},
+		RecommendationScore: 7,
+	}
+	five, eight := 5.0, 8.0
+
+	tests := []struct {
+		filter   Filter
+		expected bool
+	}{
+		{Filter{}, true},
+		{Filter{Tickers: []string{"MSFT", "akba"}}, true},
+		{Filter{Tickers: []string{"MSFT"}}, false},
+		{Filter{Brokerages: []string{"hc wainwright"}, Actions: []string{"upgraded"}}, true},
+		{Filter{Actions: []string{"downgraded"}}, false},
+		{Filter{MinScore: &five}, true},
+		{Filter{MinScore: &eight}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(event); got != tt.expected {
+			t.Errorf("%+v.Match() = %v; want %v", tt.filter, got, tt.expected)
+		}
+	}
+}
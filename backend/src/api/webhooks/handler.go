@@ -0,0 +1,158 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/problem"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// Handler serves the /webhooks endpoints.
+type Handler struct {
+	Store *Store
+}
+
+type subscriptionRequest struct {
+	URL     string `json:"url"`
+	Secret  string `json:"secret"` // generated if empty
+	Filter  Filter `json:"filter"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// ListSubscriptions answers with every subscription, without secrets.
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.Store.ListSubscriptions(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "Failed to list webhook subscriptions", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// CreateSubscription creates a subscription from {"url": "...", "secret": "...",
+// "filter": {"tickers": [...], "brokerages": [...], "actions": [...], "min_score": 5}}.
+// The response is the only one that includes the secret.
+func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	var errs []problem.FieldError
+	if !validURL(req.URL) {
+		errs = append(errs, problem.FieldError{Field: "url", Code: problem.FieldInvalid, Message: "must be an absolute http or https URL"})
+	}
+	if req.Secret != "" && len(req.Secret) < 16 {
+		errs = append(errs, problem.FieldError{Field: "secret", Code: problem.FieldOutOfRange, Message: "must be at least 16 characters"})
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, errs...)
+		return
+	}
+	filter := Filter{
+		Tickers:    cleanList(req.Filter.Tickers, strings.ToUpper),
+		Brokerages: cleanList(req.Filter.Brokerages, nil),
+		Actions:    cleanList(req.Filter.Actions, strings.ToLower),
+		MinScore:   req.Filter.MinScore,
+	}
+
+	sub, err := h.Store.CreateSubscription(r.Context(), req.URL, req.Secret, filter)
+	if err != nil {
+		problem.Internal(w, r, "Failed to create webhook subscription", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// GetSubscription answers with a subscription, without its secret.
+func (h *Handler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.Store.GetSubscription(r.Context(), r.PathValue("id"))
+	writeSubscription(w, r, sub, err)
+}
+
+// UpdateSubscription enables or disables a subscription with {"enabled": false}.
+func (h *Handler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.InvalidJSON(w, r, err)
+		return
+	}
+	if req.Enabled == nil {
+		problem.Invalid(w, r, problem.FieldError{Field: "enabled", Code: problem.FieldRequired, Message: "is required"})
+		return
+	}
+
+	sub, err := h.Store.SetSubscriptionEnabled(r.Context(), r.PathValue("id"), *req.Enabled)
+	writeSubscription(w, r, sub, err)
+}
+
+// DeleteSubscription deletes a subscription and its deliveries.
+func (h *Handler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.DeleteSubscription(r.Context(), r.PathValue("id"))
+	if err != nil {
+		problem.FromError(w, r, err, "Webhook subscription not found", "Failed to delete webhook subscription")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries answers with the delivery log of a subscription, newest first: what
+// was sent, the attempts and the last response. It accepts ?status= and ?limit=.
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	p := problem.Query(r)
+	status := p.OneOf("status", "", StatusPending, StatusDelivered, StatusFailed)
+	limit := p.Int("limit", defaultDeliveriesLimit, 1, maxDeliveriesLimit)
+	if !p.Check(w, r) {
+		return
+	}
+
+	deliveries, err := h.Store.ListDeliveries(r.Context(), r.PathValue("id"), status, limit)
+	if err != nil {
+		problem.FromError(w, r, err, "Webhook subscription not found", "Failed to list webhook deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func writeSubscription(w http.ResponseWriter, r *http.Request, sub *Subscription, err error) {
+	if err != nil {
+		problem.FromError(w, r, err, "Webhook subscription not found", "Failed to get webhook subscription")
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// validURL reports whether raw is an absolute http or https URL.
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// cleanList trims the values, drops the empty ones and applies normalize, if not nil.
+func cleanList(values []string, normalize func(string) string) []string {
+	cleaned := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if normalize != nil {
+			v = normalize(v)
+		}
+		cleaned = append(cleaned, v)
+	}
+	return cleaned
+}
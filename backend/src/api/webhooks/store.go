@@ -0,0 +1,355 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// EventType is the type of the events sent to the subscriptions.
+const EventType = "recommendation.created"
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"   // waiting for its first or next attempt
+	StatusDelivered = "delivered" // the receiver answered 2xx
+	StatusFailed    = "failed"    // every attempt failed
+)
+
+// Delivery is an event queued for a subscription in the outbox (webhook_deliveries table).
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Ticker         string          `json:"ticker"`
+	EventTime      time.Time       `json:"event_time"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"` // only while pending
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload"` // body sent on every attempt
+}
+
+// payload is the body of a delivery.
+type payload struct {
+	ID        string                `json:"id"` // id of the delivery
+	Type      string                `json:"type"`
+	CreatedAt time.Time             `json:"created_at"`
+	Data      models.StockWithScore `json:"data"`
+}
+
+// uuidPattern matches the ids of subscriptions. Other ids can't exist, and are reported
+// as not found instead of as a failed cast in the database.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Store reads and writes the subscriptions and the outbox. Methods on a subscription
+// that doesn't exist return an error wrapping sql.ErrNoRows.
+type Store struct {
+	DB *sql.DB
+}
+
+func subscriptionNotFound(id string) error {
+	return fmt.Errorf("webhook subscription %q: %w", id, sql.ErrNoRows)
+}
+
+const subscriptionColumns = `id, url, tickers, brokerages, actions, min_score, enabled, created_at`
+
+// ListSubscriptions returns every subscription, oldest first, without their secrets.
+func (s *Store) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	return s.querySubscriptions(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at, id`)
+}
+
+// GetSubscription returns the subscription id, without its secret.
+func (s *Store) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, subscriptionNotFound(id)
+	}
+	subs, err := s.querySubscriptions(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return nil, subscriptionNotFound(id)
+	}
+	return &subs[0], nil
+}
+
+// CreateSubscription stores a subscription. If secret is empty a random one is
+// generated; the returned subscription is the only one including it.
+func (s *Store) CreateSubscription(ctx context.Context, url, secret string, filter Filter) (*Subscription, error) {
+	if secret == "" {
+		secret = "whsec_" + randomHex(24)
+	}
+	sub := Subscription{URL: url, Secret: secret, Filter: filter, Enabled: true}
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO webhook_subscriptions (url, secret, tickers, brokerages, actions, min_score)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, url, secret, pq.Array(filter.Tickers), pq.Array(filter.Brokerages), pq.Array(filter.Actions), filter.MinScore,
+	).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// SetSubscriptionEnabled enables or disables the subscription id. The deliveries of a
+// disabled subscription stay pending until it's enabled again.
+func (s *Store) SetSubscriptionEnabled(ctx context.Context, id string, enabled bool) (*Subscription, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, subscriptionNotFound(id)
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE webhook_subscriptions SET enabled = $2 WHERE id = $1`, id, enabled)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, subscriptionNotFound(id)
+	}
+	return s.GetSubscription(ctx, id)
+}
+
+// DeleteSubscription deletes the subscription id and its deliveries.
+func (s *Store) DeleteSubscription(ctx context.Context, id string) error {
+	if !uuidPattern.MatchString(id) {
+		return subscriptionNotFound(id)
+	}
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return subscriptionNotFound(id)
+	}
+	return nil
+}
+
+// ListDeliveries returns the last limit deliveries of the subscription id, newest
+// first, optionally only the ones with the given status.
+func (s *Store) ListDeliveries(ctx context.Context, id, status string, limit int) ([]Delivery, error) {
+	if _, err := s.GetSubscription(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, subscription_id, ticker, event_time, status, attempts, next_attempt_at,
+		       last_status_code, COALESCE(last_error, ''), created_at, delivered_at, payload
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id
+		LIMIT $3
+	`, id, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var next, delivered sql.NullTime
+		var code sql.NullInt64
+		var body []byte
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.Ticker, &d.EventTime, &d.Status, &d.Attempts, &next,
+			&code, &d.LastError, &d.CreatedAt, &delivered, &body)
+		if err != nil {
+			return nil, err
+		}
+		if next.Valid && d.Status == StatusPending {
+			d.NextAttemptAt = &next.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		if code.Valid {
+			c := int(code.Int64)
+			d.LastStatusCode = &c
+		}
+		d.Payload = body
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Enqueue queues a delivery of every event for every enabled subscription whose filter
+// matches it. An event is queued at most once per subscription. It returns how many
+// deliveries were queued.
+func (s *Store) Enqueue(ctx context.Context, events []models.StockWithScore) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+	subs, err := s.querySubscriptions(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE enabled`)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, event := range events {
+		for _, sub := range subs {
+			if !sub.Filter.Match(event) {
+				continue
+			}
+			p := payload{ID: newUUID(), Type: EventType, CreatedAt: time.Now().UTC(), Data: event}
+			body, err := json.Marshal(p)
+			if err != nil {
+				return queued, err
+			}
+			res, err := s.DB.ExecContext(ctx, `
+				INSERT INTO webhook_deliveries (id, subscription_id, ticker, event_time, payload, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (subscription_id, ticker, event_time) DO NOTHING
+			`, p.ID, sub.ID, event.Ticker, event.Time, string(body), p.CreatedAt)
+			if err != nil {
+				return queued, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				queued++
+			}
+		}
+	}
+	return queued, nil
+}
+
+// claimed is a delivery due to be sent, with what's needed to send it.
+type claimed struct {
+	ID       string
+	URL      string
+	Secret   string
+	Attempts int // before this one
+	Payload  []byte
+}
+
+// claim takes up to limit due deliveries of enabled subscriptions, moving their next
+// attempt lease into the future so other replicas don't send them at the same time.
+// The deliveries another replica is claiming are skipped, and the outer WHERE checks
+// again that they're due: under READ COMMITTED, the UPDATE of a row claimed meanwhile
+// sees its new lease and leaves it out.
+func (s *Store) claim(ctx context.Context, limit int, lease time.Duration) ([]claimed, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = now() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND s.enabled
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		) AND status = 'pending' AND next_attempt_at <= now()
+		RETURNING id, subscription_id, attempts, payload
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []claimed
+	var subIDs []string
+	for rows.Next() {
+		var c claimed
+		var subID string
+		if err := rows.Scan(&c.ID, &subID, &c.Attempts, &c.Payload); err != nil {
+			return nil, err
+		}
+		due = append(due, c)
+		subIDs = append(subIDs, subID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	targets := map[string][2]string{} // subscription id -> url, secret
+	for i := range due {
+		target, ok := targets[subIDs[i]]
+		if !ok {
+			err := s.DB.QueryRowContext(ctx, `SELECT url, secret FROM webhook_subscriptions WHERE id = $1`, subIDs[i]).
+				Scan(&target[0], &target[1])
+			if err != nil {
+				return nil, err
+			}
+			targets[subIDs[i]] = target
+		}
+		due[i].URL, due[i].Secret = target[0], target[1]
+	}
+	return due, nil
+}
+
+// markDelivered records a successful attempt.
+func (s *Store) markDelivered(ctx context.Context, id string, code int) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now()
+		WHERE id = $1
+	`, id, code)
+	return err
+}
+
+// markFailed records a failed attempt. The delivery is retried at next, or given up
+// if next is nil. code is 0 when there was no response.
+func (s *Store) markFailed(ctx context.Context, id string, code int, attemptErr error, next *time.Time) error {
+	status := StatusPending
+	if next == nil {
+		status = StatusFailed
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status_code = NULLIF($3, 0), last_error = $4,
+		    next_attempt_at = COALESCE($5, next_attempt_at)
+		WHERE id = $1
+	`, id, status, code, attemptErr.Error(), next)
+	return err
+}
+
+func (s *Store) querySubscriptions(ctx context.Context, query string, args ...any) ([]Subscription, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var sub Subscription
+		var minScore sql.NullFloat64
+		err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.Filter.Tickers), pq.Array(&sub.Filter.Brokerages),
+			pq.Array(&sub.Filter.Actions), &minScore, &sub.Enabled, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if minScore.Valid {
+			sub.Filter.MinScore = &minScore.Float64
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
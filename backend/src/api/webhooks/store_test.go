@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/migrations"
+	"vue_go_cockroachdb/src/models"
+)
+
+// TestConcurrentClaims claims the deliveries from two dispatchers at the same time on
+// the CockroachDB or PostgreSQL database of TEST_DATABASE_URL, whose webhooks are
+// deleted: every delivery must be claimed exactly once.
+func TestConcurrentClaims(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+	ctx := context.Background()
+	db, err := app.GetDBConnection(ctx, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(ctx, db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM webhook_subscriptions`); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Store{DB: db}
+	if _, err := s.CreateSubscription(ctx, "https://example.com/hook", "", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	const deliveries = 200
+	at := time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC)
+	var events []models.StockWithScore
+	for i := range deliveries {
+		e := models.StockWithScore{}
+		e.Ticker, e.Time = fmt.Sprintf("T%03d", i), at
+		events = append(events, e)
+	}
+	if queued, err := s.Enqueue(ctx, events); err != nil || queued != deliveries {
+		t.Fatalf("Enqueue() = %d, %v; want %d deliveries", queued, err, deliveries)
+	}
+
+	var mu sync.Mutex
+	claims := map[string]int{}
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				due, err := s.claim(ctx, 7, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(due) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, c := range due {
+					claims[c.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claims) != deliveries {
+		t.Errorf("claimed %d deliveries; want %d", len(claims), deliveries)
+	}
+	for id, n := range claims {
+		if n > 1 {
+			t.Errorf("delivery %s claimed %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package webhooks pushes the events loaded by the ETL to the subscribed URLs. Events
+// are queued in the "webhook_deliveries" outbox table and sent, HMAC-signed, by a
+// Dispatcher that retries failed deliveries with exponential backoff.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// Subscription is a URL subscribed to the events matching Filter (webhook_subscriptions table).
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the subscription is created
+	Filter    Filter    `json:"filter"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Filter selects the events sent to a subscription. Empty lists match any value;
+// text values are compared ignoring case.
+type Filter struct {
+	Tickers    []string `json:"tickers"`
+	Brokerages []string `json:"brokerages"`
+	Actions    []string `json:"actions"` // canonical actions, see models.CanonicalActions
+	MinScore   *float64 `json:"min_score"`
+}
+
+// Match reports whether the event s passes the filter.
+func (f Filter) Match(s models.StockWithScore) bool {
+	if f.MinScore != nil && s.RecommendationScore < *f.MinScore {
+		return false
+	}
+	return matchAny(f.Tickers, s.Ticker) && matchAny(f.Brokerages, s.Brokerage) && matchAny(f.Actions, s.Action)
+}
+
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers of the deliveries.
+const (
+	HeaderID        = "X-Webhook-Id"        // id of the delivery, the same on every retry
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix time of the attempt, in seconds
+	HeaderSignature = "X-Webhook-Signature" // see Signature
+)
+
+// Signature is the value of the X-Webhook-Signature header: "sha256=" followed by the
+// hex HMAC-SHA256, keyed with the subscription secret, of the timestamp, a dot and the
+// body. Receivers should recompute it and also reject old timestamps to avoid replays.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,383 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the configuration settings, as used in the config file.
+const (
+	KeyDBURL     = "db_url"
+	KeyPort      = "port"
+	KeyAPIURL    = "external_api_url"
+	KeyAuthToken = "external_api_auth_token"
+	KeyETLLogDir = "etl_log_dir"
+
+	KeyLogLevel  = "log_level"
+	KeyLogFormat = "log_format"
+	KeyLogOutput = "log_output"
+
+	KeyETLSchedule = "etl_schedule"
+	KeyETLLeaseTTL = "etl_lease_ttl"
+	KeyETLConflict = "etl_conflict_policy"
+	KeyCompanies   = "companies_file"
+	KeyETLMetrics  = "etl_metrics_file"
+
+	KeyAPIAuth        = "api_auth"
+	KeyAPIDailyQuota  = "api_daily_quota"
+	KeyRateLimit      = "rate_limit"
+	KeyRateLimitBurst = "rate_limit_burst"
+	KeyMaxPageSize    = "max_page_size"
+	KeyCacheEntries   = "cache_entries"
+	KeyCacheMaxAge    = "cache_max_age"
+)
+
+// Sources a configuration value can come from, in increasing order of precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Config is the typed configuration of the application. It's built by Load from,
+// in increasing order of precedence: the defaults, a JSON config file, the
+// environment variables and the command line flags.
+type Config struct {
+	DBURL     string
+	Port      string
+	APIURL    string
+	AuthToken string
+	ETLLogDir string // directory of the etl.log of the etl command, empty to log to LogOutput
+
+	LogLevel  string // minimum level of the logs: debug, info, warn or error
+	LogFormat string // json or text
+	LogOutput string // stderr, stdout or a file, rotated by size
+
+	ETLSchedule string        // cron expression of the ETL run by the server, empty to disable it
+	ETLLeaseTTL time.Duration // how long a replica holds the ETL lease without renewing it
+	ETLConflict string        // what the ETL does with stored events received with other values
+	Companies   string        // CSV file of the companies loaded by the ETL, empty to keep the table as is
+	ETLMetrics  string        // Prometheus textfile the etl command writes its metrics to, empty to skip it
+
+	APIAuth        bool // whether the HTTP API requires API keys
+	APIDailyQuota  int  // requests per UTC day of the keys without their own quota, 0 for unlimited
+	RateLimit      int  // requests per minute of each client, 0 to disable the limit
+	RateLimitBurst int  // requests a client can make at once
+	MaxPageSize    int  // maximum limit of the paginated endpoints
+
+	CacheEntries int           // answers of /recommendations and /stats kept in memory, 0 to disable the cache
+	CacheMaxAge  time.Duration // max-age of their Cache-Control, 0 to make the clients revalidate
+
+	sources map[string]string // key -> Source* the value came from
+}
+
+// Setting describes one configuration value and where it can be set.
+type Setting struct {
+	Key    string // key in the config file
+	Env    string // environment variable
+	Flag   string // command line flag
+	Usage  string
+	Secret bool // redacted when the configuration is printed
+
+	value  func(c *Config) any       // pointer to the field in Config
+	redact func(value string) string // custom redaction, for values that only contain a secret
+}
+
+// Settings lists every configuration value. Keep it in sync with Config.
+var Settings = []Setting{
+	{Key: KeyDBURL, Env: "DB_URL", Flag: "db-url", Usage: "database connection string: postgresql://... for CockroachDB/PostgreSQL, sqlite:path for a SQLite file",
+		value: func(c *Config) any { return &c.DBURL }, redact: redactURL},
+	{Key: KeyPort, Env: "PORT", Flag: "port", Usage: "port of the HTTP server",
+		value: func(c *Config) any { return &c.Port }},
+	{Key: KeyAPIURL, Env: "EXTERNAL_API_URL", Flag: "api-url", Usage: "URL of the external recommendations API",
+		value: func(c *Config) any { return &c.APIURL }},
+	{Key: KeyAuthToken, Env: "EXTERNAL_API_AUTH_TOKEN", Flag: "auth-token", Usage: "auth token of the external recommendations API", Secret: true,
+		value: func(c *Config) any { return &c.AuthToken }},
+	{Key: KeyETLLogDir, Env: "ETL_LOG_DIR", Flag: "log-dir", Usage: "directory of the etl.log file of the etl command, rotated by size; empty to log to log_output",
+		value: func(c *Config) any { return &c.ETLLogDir }},
+	{Key: KeyLogLevel, Env: "LOG_LEVEL", Flag: "log-level", Usage: "minimum level of the logs: debug, info, warn or error",
+		value: func(c *Config) any { return &c.LogLevel }},
+	{Key: KeyLogFormat, Env: "LOG_FORMAT", Flag: "log-format", Usage: "format of the logs: json (one object per line) or text",
+		value: func(c *Config) any { return &c.LogFormat }},
+	{Key: KeyLogOutput, Env: "LOG_OUTPUT", Flag: "log-output", Usage: "where the logs go: stderr, stdout or a file, rotated by size",
+		value: func(c *Config) any { return &c.LogOutput }},
+	{Key: KeyETLSchedule, Env: "ETL_SCHEDULE", Flag: "etl-schedule", Usage: "cron expression to run the ETL inside the server (e.g. \"0 * * * *\" or @hourly), empty to disable it",
+		value: func(c *Config) any { return &c.ETLSchedule }},
+	{Key: KeyETLLeaseTTL, Env: "ETL_LEASE_TTL", Flag: "etl-lease-ttl", Usage: "how long a server replica or the etl command holds the ETL lease without renewing it, at least 3s",
+		value: func(c *Config) any { return &c.ETLLeaseTTL }},
+	{Key: KeyETLConflict, Env: "ETL_CONFLICT_POLICY", Flag: "conflict-policy", Usage: "what the ETL does with stored events received with other values: ignore, overwrite or revisions",
+		value: func(c *Config) any { return &c.ETLConflict }},
+	{Key: KeyCompanies, Env: "COMPANIES_FILE", Flag: "companies-file", Usage: "CSV file (ticker,name,exchange,sector,industry) loaded into the companies table before each ETL run, empty to keep the table as is",
+		value: func(c *Config) any { return &c.Companies }},
+	{Key: KeyETLMetrics, Env: "ETL_METRICS_FILE", Flag: "metrics-file", Usage: "file the etl command writes its Prometheus metrics to at the end of the run, for the textfile collector of node_exporter; empty to skip it",
+		value: func(c *Config) any { return &c.ETLMetrics }},
+	{Key: KeyAPIAuth, Env: "API_AUTH", Flag: "api-auth", Usage: "whether the HTTP API requires an API key (Authorization: Bearer <key>)",
+		value: func(c *Config) any { return &c.APIAuth }},
+	{Key: KeyAPIDailyQuota, Env: "API_DAILY_QUOTA", Flag: "api-daily-quota", Usage: "requests per UTC day of the API keys without a quota of their own, 0 for unlimited",
+		value: func(c *Config) any { return &c.APIDailyQuota }},
+	{Key: KeyRateLimit, Env: "RATE_LIMIT", Flag: "rate-limit", Usage: "requests per minute of each API key or IP, 0 to disable the limit",
+		value: func(c *Config) any { return &c.RateLimit }},
+	{Key: KeyRateLimitBurst, Env: "RATE_LIMIT_BURST", Flag: "rate-limit-burst", Usage: "requests an API key or IP can make at once, over the rate limit",
+		value: func(c *Config) any { return &c.RateLimitBurst }},
+	{Key: KeyMaxPageSize, Env: "MAX_PAGE_SIZE", Flag: "max-page-size", Usage: "maximum value of the limit parameter of the paginated endpoints",
+		value: func(c *Config) any { return &c.MaxPageSize }},
+	{Key: KeyCacheEntries, Env: "CACHE_ENTRIES", Flag: "cache-entries", Usage: "answers of /recommendations and /stats kept in memory until the data changes, 0 to disable the cache",
+		value: func(c *Config) any { return &c.CacheEntries }},
+	{Key: KeyCacheMaxAge, Env: "CACHE_MAX_AGE", Flag: "cache-max-age", Usage: "max-age of the Cache-Control of /recommendations and /stats, 0 to make the clients revalidate with If-None-Match",
+		value: func(c *Config) any { return &c.CacheMaxAge }},
+}
+
+// Defaults returns the configuration used when nothing else is set.
+func Defaults() *Config {
+	return &Config{
+		Port:        "8080",
+		ETLLogDir:   "logs",
+		LogLevel:    "info",
+		LogFormat:   "json",
+		LogOutput:   "stderr",
+		ETLLeaseTTL: 15 * time.Minute,
+		ETLConflict: "ignore",
+
+		APIAuth:        true,
+		RateLimit:      600,
+		RateLimitBurst: 50,
+		MaxPageSize:    100,
+
+		CacheEntries: 1000,
+	}
+}
+
+// SettingByKey returns the setting with the given key.
+func SettingByKey(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Load builds the configuration. configFile is the path of an optional JSON file
+// ({"db_url": "...", "port": "8080"}), getenv reads the environment and flags holds the
+// values of the flags set on the command line, by flag name.
+// Every invalid value is reported at once, joined in the returned error.
+func Load(configFile string, getenv func(string) string, flags map[string]string) (*Config, error) {
+	c := Defaults()
+	c.sources = map[string]string{}
+	for _, s := range Settings {
+		c.sources[s.Key] = SourceDefault
+	}
+
+	var problems []error
+
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			problems = append(problems, err)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, ok := SettingByKey(key)
+			if !ok {
+				problems = append(problems, fmt.Errorf("config file %s: unknown setting %q", configFile, key))
+				continue
+			}
+			if err := c.set(s, values[key], SourceFile); err != nil {
+				problems = append(problems, fmt.Errorf("config file %s: %w", configFile, err))
+			}
+		}
+	}
+
+	for _, s := range Settings {
+		if v := getenv(s.Env); v != "" {
+			if err := c.set(s, v, SourceEnv); err != nil {
+				problems = append(problems, fmt.Errorf("env %s: %w", s.Env, err))
+			}
+		}
+	}
+
+	for _, s := range Settings {
+		if v, ok := flags[s.Flag]; ok {
+			if err := c.set(s, v, SourceFlag); err != nil {
+				problems = append(problems, fmt.Errorf("flag -%s: %w", s.Flag, err))
+			}
+		}
+	}
+
+	return c, errors.Join(problems...)
+}
+
+// Require reports every setting in keys that has no value, all at once.
+func (c *Config) Require(keys ...string) error {
+	var problems []error
+	for _, key := range keys {
+		s, ok := SettingByKey(key)
+		if !ok {
+			problems = append(problems, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+		if c.get(s) == "" {
+			problems = append(problems, fmt.Errorf("%s is required: set env %s, flag -%s or %q in the config file", s.Key, s.Env, s.Flag, s.Key))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Value returns the value of key formatted as a string, empty for unknown keys.
+func (c *Config) Value(key string) string {
+	s, ok := SettingByKey(key)
+	if !ok {
+		return ""
+	}
+	return c.get(s)
+}
+
+// Source returns where the value of key came from (one of the Source* constants).
+func (c *Config) Source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// Redacted returns the effective configuration as "key = value (source)" lines,
+// with the secrets hidden.
+func (c *Config) Redacted() string {
+	var b strings.Builder
+	width := 0
+	for _, s := range Settings {
+		width = max(width, len(s.Key))
+	}
+	for _, s := range Settings {
+		v := c.get(s)
+		switch {
+		case v == "":
+		case s.redact != nil:
+			v = s.redact(v)
+		case s.Secret:
+			v = "******"
+		}
+		fmt.Fprintf(&b, "%-*s = %s (%s)\n", width, s.Key, v, c.Source(s.Key))
+	}
+	return b.String()
+}
+
+// set parses value into the field of s.
+func (c *Config) set(s Setting, value, source string) error {
+	switch field := s.value(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", s.Key, value)
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", s.Key, value)
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. 30s, 5m)", s.Key, value)
+		}
+		*field = d
+	default:
+		return fmt.Errorf("%s: unsupported setting type %T", s.Key, field)
+	}
+	c.sources[s.Key] = source
+	return nil
+}
+
+// get returns the value of the field of s formatted as a string.
+func (c *Config) get(s Setting) string {
+	switch field := s.value(c).(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return field.String()
+	default:
+		return fmt.Sprint(field)
+	}
+}
+
+// readConfigFile reads a JSON object of settings. Numbers and booleans are accepted
+// as well as strings, e.g. {"port": 8080}.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case nil:
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// dsnPassword matches the password-like settings of a key=value connection string,
+// like password=s3cret or sslpassword = 'with spaces'.
+var dsnPassword = regexp.MustCompile(`(?i)\b(\w*password)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactURL hides the passwords of a connection string: the one of the userinfo and
+// the password-like query parameters of a URL, or the password-like settings of a
+// key=value string. A value that is neither is hidden whole.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	switch {
+	case err == nil && u.Scheme != "":
+		if q := u.Query(); len(q) > 0 {
+			masked := false
+			for key := range q {
+				if isPasswordKey(key) {
+					q[key] = []string{"xxxxx"}
+					masked = true
+				}
+			}
+			if masked {
+				u.RawQuery = q.Encode()
+			}
+		}
+		return u.Redacted()
+	case strings.Contains(value, "="):
+		return dsnPassword.ReplaceAllString(value, "$1=xxxxx")
+	default:
+		return "******"
+	}
+}
+
+// isPasswordKey reports whether the connection setting key holds a password, like
+// password or sslpassword.
+func isPasswordKey(key string) bool {
+	return strings.Contains(strings.ToLower(key), "password")
+}
@@ -3,21 +3,71 @@ package app
 import (
 	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"strings"
 
 	_ "github.com/lib/pq"
+	"modernc.org/sqlite"
 )
 
-// GetDBConnection establishes and returns a connection to the PostgreSQL database
-// using the connection string specified in EnvVarsValues.DBURL. If the connection
-// cannot be established, the function logs a fatal error and terminates the application.
+// Dialect is the SQL dialect of a database, picked by the scheme of its URL.
+type Dialect string
+
+const (
+	// Postgres is CockroachDB or PostgreSQL: postgres:// and postgresql:// URLs, and any
+	// URL without a sqlite: or file: scheme.
+	Postgres Dialect = "postgres"
+	// SQLite is an embedded SQLite file: sqlite:path, sqlite://path or file:path URLs.
+	SQLite Dialect = "sqlite"
+)
+
+// sqliteParams are added to the SQLite data source names: foreign keys on, writers
+// waiting for each other instead of failing, WAL so readers don't block the writer,
+// transactions taking the write lock when they begin (a transaction that reads and then
+// writes can't wait for a lock), and times written in a format that sorts as text.
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+
+// ParseDBURL returns the dialect of dbURL and the data source name of its driver.
+func ParseDBURL(dbURL string) (Dialect, string) {
+	for _, scheme := range []string{"sqlite://", "sqlite:", "file:"} {
+		if path, ok := strings.CutPrefix(dbURL, scheme); ok {
+			sep := "?"
+			if strings.Contains(path, "?") {
+				sep = "&"
+			}
+			return SQLite, "file:" + path + sep + sqliteParams
+		}
+	}
+	return Postgres, dbURL
+}
+
+// DialectOf returns the dialect of a database opened by GetDBConnection.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return SQLite
+	}
+	return Postgres
+}
+
+// GetDBConnection establishes and returns a connection to the database at dbURL,
+// checking that it can be reached. The scheme of dbURL picks the driver (see Dialect).
 //
 // Parameters:
 //   - ctx: context.Context for managing request-scoped values, cancellation, and timeouts.
-func GetDBConnection(ctx context.Context) *sql.DB {
-	conn, err := sql.Open("postgres", EnvVarsValues.DB_URL)
+//   - dbURL: connection string, e.g. postgresql://root@localhost:26257/defaultdb?sslmode=disable
+//     or sqlite:stocks.db
+func GetDBConnection(ctx context.Context, dbURL string) (*sql.DB, error) {
+	dialect, dsn := ParseDBURL(dbURL)
+	conn, err := sql.Open(string(dialect), dsn)
 	if err != nil {
-		log.Fatal("DB Connection Error:", err)
+		return nil, fmt.Errorf("DB Connection Error: %w", err)
+	}
+	if dialect == SQLite && strings.Contains(dsn, ":memory:") {
+		conn.SetMaxOpenConns(1) // every connection would open its own empty database
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("DB Connection Error: %w", err)
 	}
-	return conn
+	return conn, nil
 }
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"vue_go_cockroachdb/src/api/auth"
+	"vue_go_cockroachdb/src/app"
+)
+
+var apikeyCommand = command{
+	Name:    "apikey",
+	Summary: "Create, list or revoke the API keys of the HTTP API.",
+	Usage:   "create|list|revoke [flags] [id]",
+	Run:     runAPIKey,
+}
+
+func runAPIKey(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL})
+	name := fs.String("name", "", "name of the key to create, e.g. who uses it")
+	quota := fs.Int64("daily-quota", -1, "requests per UTC day of the key to create, 0 for unlimited (default: the api_daily_quota of the server)")
+	scopes := fs.String("scopes", auth.ScopeRead, "comma separated scopes of the key to create: "+strings.Join(auth.Scopes, ", "))
+
+	if len(args) == 0 {
+		fs.Usage()
+		return usageError{msg: "missing action, expected create, list or revoke"}
+	}
+	action := args[0]
+	if action == "-h" || action == "-help" || action == "--help" {
+		return parseFlags(fs, args)
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var run func(ctx context.Context, store *auth.Store) error
+	switch action {
+	case "create":
+		if strings.TrimSpace(*name) == "" {
+			return usageError{msg: "create needs -name"}
+		}
+		parsed, err := auth.ParseScopes(*scopes)
+		if err != nil {
+			return usageError{msg: err.Error()}
+		}
+		var dailyQuota *int64
+		if *quota >= 0 {
+			dailyQuota = quota
+		}
+		run = func(ctx context.Context, store *auth.Store) error {
+			key, secret, err := store.CreateKey(ctx, strings.TrimSpace(*name), parsed, dailyQuota)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "created key %s (%s) with scopes %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+			fmt.Fprintf(e.stdout, "%s\n", secret)
+			fmt.Fprintln(e.stderr, "Store the key now, it can't be shown again.")
+			return nil
+		}
+	case "list":
+		run = func(ctx context.Context, store *auth.Store) error {
+			keys, err := store.ListKeys(ctx)
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tQUOTA\tTODAY\tREQUESTS\tLAST USED\tSTATUS")
+			for _, k := range keys {
+				lastUsed, status, dailyQuota := "never", "active", "default"
+				if k.DailyQuota != nil {
+					dailyQuota = strconv.FormatInt(*k.DailyQuota, 10)
+				}
+				if k.LastUsedAt != nil {
+					lastUsed = k.LastUsedAt.Format(time.RFC3339)
+				}
+				if k.RevokedAt != nil {
+					status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s…\t%s\t%s\t%d\t%d\t%s\t%s\n",
+					k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","), dailyQuota, k.RequestsToday, k.RequestCount, lastUsed, status)
+			}
+			return tw.Flush()
+		}
+	case "revoke":
+		if fs.NArg() != 1 {
+			return usageError{msg: "revoke needs the id of the key"}
+		}
+		run = func(ctx context.Context, store *auth.Store) error {
+			key, err := store.RevokeKey(ctx, fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "revoked key %s (%s)\n", key.ID, key.Name)
+			return nil
+		}
+	default:
+		return usageError{msg: fmt.Sprintf("unknown action %q, expected create, list or revoke", action)}
+	}
+	if action != "revoke" && fs.NArg() > 0 {
+		return usageError{msg: fmt.Sprintf("unexpected arguments %v", fs.Args())}
+	}
+
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if app.DialectOf(db) == app.SQLite {
+		return errors.New("API keys need a CockroachDB or PostgreSQL database")
+	}
+
+	return run(ctx, &auth.Store{DB: db})
+}
@@ -0,0 +1,248 @@
+// Package cli implements the command line of the backend binary: one subcommand per
+// process (serve, etl, import, migrate, rescore, export, apikey) sharing flags and
+// database setup.
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/logging"
+)
+
+// programName is the name shown in the usage messages.
+const programName = "backend"
+
+// Exit codes returned by Run.
+const (
+	ExitOK     = 0
+	ExitError  = 1 // the command failed
+	ExitUsage  = 2 // invalid command line
+	ExitConfig = 3 // invalid or incomplete configuration
+)
+
+// command is a subcommand of the binary.
+type command struct {
+	Name    string
+	Summary string
+	Usage   string // arguments after the command name, shown in --help
+	Run     func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error
+}
+
+// env holds the outputs of the running command, so tests can capture them.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	logs   io.Closer // log file, if the logs go to one
+}
+
+// usageError reports an invalid command line; Run exits with ExitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string { return e.msg }
+
+func commands() []command {
+	return []command{serveCommand, etlCommand, importCommand, migrateCommand, rescoreCommand, exportCommand, apikeyCommand}
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit code.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		printUsage(stderr)
+		return ExitUsage
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		printUsage(stdout)
+		return ExitOK
+	}
+
+	var cmd *command
+	for _, c := range commands() {
+		if c.Name == args[0] {
+			cmd = &c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return ExitUsage
+	}
+
+	err := cmd.Run(ctx, e, newFlagSet(e, *cmd), args[1:])
+	e.closeLogs()
+	var usageErr usageError
+	var configErr configError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.As(err, &configErr):
+		fmt.Fprintf(stderr, "%s %s: %v\n", programName, cmd.Name, err)
+		return ExitConfig
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s %s: %v\n", programName, cmd.Name, err)
+		fmt.Fprintf(stderr, "Run '%s %s --help' for usage.\n", programName, cmd.Name)
+		return ExitUsage
+	default:
+		fmt.Fprintf(stderr, "%s %s: %v\n", programName, cmd.Name, err)
+		return ExitError
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s <command> --help' for the flags of a command.\n", programName)
+}
+
+// newFlagSet returns the flag set of a command. Parse errors are returned to Run
+// (instead of exiting) and --help prints the command usage.
+func newFlagSet(e *env, cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\nFlags:\n", programName, cmd.Name, cmd.Usage, cmd.Summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, turning invalid flags into a usageError.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// configFlags are the flags of the configuration settings used by a command, plus the
+// logging settings, -config and -print-config which every command accepts.
+type configFlags struct {
+	fs       *flag.FlagSet
+	file     string
+	print    bool
+	required []string
+}
+
+// addConfigFlags registers the flags of the required and optional settings of a command.
+// Only the required settings are validated, so each command needs only its own.
+func addConfigFlags(fs *flag.FlagSet, required []string, optional ...string) *configFlags {
+	cf := &configFlags{fs: fs, required: required}
+	fs.StringVar(&cf.file, "config", "", "JSON config file (env CONFIG_FILE)")
+	fs.BoolVar(&cf.print, "print-config", false, "print the effective configuration, with secrets redacted, and exit")
+
+	defaults := app.Defaults()
+	optional = append(optional, app.KeyLogLevel, app.KeyLogFormat, app.KeyLogOutput)
+	for _, key := range append(append([]string{}, required...), optional...) {
+		s, ok := app.SettingByKey(key)
+		if !ok {
+			panic("cli: unknown setting " + key)
+		}
+		usage := fmt.Sprintf("%s (env %s)", s.Usage, s.Env)
+		if v := defaults.Value(key); v != "" {
+			usage += fmt.Sprintf(" (default %q)", v)
+		}
+		fs.String(s.Flag, "", usage)
+	}
+	return cf
+}
+
+// load builds the configuration from the defaults, the config file, the environment and
+// the flags, checks the required settings and sets up the logs. With -print-config it
+// also prints it.
+func (cf *configFlags) load(e *env) (*app.Config, error) {
+	flags := map[string]string{}
+	cf.fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+
+	file := cf.file
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	cfg, err := app.Load(file, os.Getenv, flags)
+	if cf.print && cfg != nil {
+		fmt.Fprint(e.stdout, cfg.Redacted())
+	}
+	if err = errors.Join(err, cfg.Require(cf.required...)); err != nil {
+		return nil, configError{err: err}
+	}
+	if cf.print {
+		return cfg, nil
+	}
+	return cfg, e.setupLogs(cfg, cfg.LogOutput)
+}
+
+// setupLogs makes the default slog logger, which also gets the output of the log
+// package, write the logs of the level and format of cfg to output: stderr, stdout or
+// a file (see logging.OpenFile). The file of a previous call is closed.
+func (e *env) setupLogs(cfg *app.Config, output string) error {
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return configError{err: fmt.Errorf("%s: %w", app.KeyLogLevel, err)}
+	}
+	var w io.Writer
+	var file io.WriteCloser
+	switch output {
+	case logging.OutputStderr, "":
+		w = e.stderr
+	case logging.OutputStdout:
+		w = e.stdout
+	default:
+		if file, err = logging.OpenFile(output); err != nil {
+			return fmt.Errorf("open the log file: %w", err)
+		}
+		w = file
+	}
+	logger, err := logging.New(w, level, cfg.LogFormat)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return configError{err: fmt.Errorf("%s: %w", app.KeyLogFormat, err)}
+	}
+	e.closeLogs()
+	e.logs = file
+	slog.SetDefault(logger)
+	return nil
+}
+
+// closeLogs closes the log file, if any.
+func (e *env) closeLogs() {
+	if e.logs != nil {
+		e.logs.Close()
+		e.logs = nil
+	}
+}
+
+// configError reports an invalid configuration; Run exits with ExitConfig.
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string { return "invalid configuration:\n" + e.err.Error() }
+
+func (e configError) Unwrap() error { return e.err }
+
+// openDB opens the database shared by all commands.
+func openDB(ctx context.Context, cfg *app.Config) (*sql.DB, error) {
+	return app.GetDBConnection(ctx, cfg.DBURL)
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	// without configuration, the commands that need it must fail listing every missing setting
+	for _, key := range []string{"DB_URL", "EXTERNAL_API_URL", "EXTERNAL_API_AUTH_TOKEN", "PORT", "CONFIG_FILE", "ETL_SCHEDULE", "ETL_CONFLICT_POLICY", "API_AUTH", "API_DAILY_QUOTA", "RATE_LIMIT", "RATE_LIMIT_BURST", "MAX_PAGE_SIZE"} {
+		t.Setenv(key, "")
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		out  string // expected in stdout or stderr
+	}{
+		{nil, ExitUsage, "Usage: backend <command>"},
+		{[]string{"--help"}, ExitOK, "migrate"},
+		{[]string{"unknown"}, ExitUsage, `unknown command "unknown"`},
+		{[]string{"serve", "--help"}, ExitOK, "-port"},
+		{[]string{"serve", "--no-such-flag"}, ExitUsage, "flag provided but not defined"},
+		{[]string{"migrate"}, ExitUsage, "missing action"},
+		{[]string{"migrate", "sideways"}, ExitUsage, `unknown action "sideways"`},
+		{[]string{"export", "-format", "xml"}, ExitUsage, `unknown format "xml", expected csv, ndjson, parquet`},
+		{[]string{"import"}, ExitUsage, "missing the files to import"},
+		{[]string{"import", "-format", "xlsx", "events.xlsx"}, ExitUsage, `unknown format "xlsx"`},
+		{[]string{"import", "events.csv"}, ExitConfig, "db_url is required"},
+		{[]string{"etl"}, ExitConfig, "external_api_auth_token is required"},
+		{[]string{"etl", "-db-url", "postgresql://x"}, ExitConfig, "external_api_url is required"},
+		{[]string{"serve", "-db-url", "postgresql://x", "-etl-schedule", "every hour"}, ExitConfig, `etl_schedule: cron expression "every hour"`},
+		{[]string{"serve", "-db-url", "postgresql://x", "-etl-lease-ttl", "1ns"}, ExitConfig, "etl_lease_ttl must be at least 3s"},
+		{[]string{"etl", "-db-url", "postgresql://x", "-api-url", "http://x", "-auth-token", "t", "-etl-lease-ttl", "2s"}, ExitConfig, "etl_lease_ttl must be at least 3s"},
+		{[]string{"serve", "-db-url", "postgresql://x", "-etl-schedule", "@hourly"}, ExitConfig, "etl_schedule is set: external_api_url is required"},
+		{[]string{"etl", "-db-url", "postgresql://x", "-api-url", "http://x", "-auth-token", "t", "-conflict-policy", "merge"}, ExitConfig, `unknown conflict policy "merge"`},
+		{[]string{"rescore", "-db-url", "postgresql://x", "-log-level", "loud"}, ExitConfig, `log_level: unknown log level "loud"`},
+		{[]string{"rescore", "-db-url", "postgresql://x", "-log-format", "xml"}, ExitConfig, `log_format: unknown log format "xml"`},
+		{[]string{"apikey"}, ExitUsage, "missing action"},
+		{[]string{"apikey", "create", "-scopes", "read"}, ExitUsage, "create needs -name"},
+		{[]string{"apikey", "create", "-name", "ci", "-scopes", "read,write"}, ExitUsage, `unknown scope "write"`},
+		{[]string{"serve", "-db-url", "postgresql://x", "-api-auth", "maybe"}, ExitConfig, `api_auth: "maybe" is not a boolean`},
+		{[]string{"serve", "-db-url", "postgresql://x", "-max-page-size", "0", "-rate-limit", "-1"}, ExitConfig, "max_page_size must be positive\nrate_limit must be 0 (no limit) or positive"},
+		{[]string{"serve", "-db-url", "postgresql://x", "-cache-entries", "-1", "-cache-max-age", "-1s"}, ExitConfig, "cache_entries must be 0 (no cache) or positive\ncache_max_age can't be negative"},
+		{[]string{"serve", "-db-url", "sqlite:stocks.db"}, ExitConfig, "api_auth: a SQLite database has no API keys; set api_auth=false"},
+		{[]string{"serve", "-print-config"}, ExitConfig, "port                    = 8080 (default)"},
+		{[]string{"serve", "-demo", "-demo-fixture", "no-such-fixture.json"}, ExitError, "demo fixture: open no-such-fixture.json"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Run(context.Background(), tt.args, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("Run(%q) = %d; want %d (stderr: %s)", tt.args, code, tt.code, stderr.String())
+		}
+		if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.out) {
+			t.Errorf("Run(%q) output = %q; want it to contain %q", tt.args, out, tt.out)
+		}
+	}
+}
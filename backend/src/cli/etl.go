@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"vue_go_cockroachdb/src/api/alerts"
+	"vue_go_cockroachdb/src/api/webhooks"
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/etl"
+	"vue_go_cockroachdb/src/logging"
+	"vue_go_cockroachdb/src/scheduler"
+)
+
+var etlCommand = command{
+	Name:    "etl",
+	Summary: "Fetch the recommendations from the external API and load them into the database.",
+	Usage:   "[flags]",
+	Run:     runETL,
+}
+
+// etlLogFile is the name of the log file of the etl command in the ETL_LOG_DIR. The runs
+// are told apart by their run_id.
+const etlLogFile = "etl.log"
+
+func runETL(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL, app.KeyAPIURL, app.KeyAuthToken}, app.KeyETLLogDir, app.KeyETLConflict, app.KeyCompanies, app.KeyETLMetrics,
+		app.KeyETLLeaseTTL)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+	policy, err := etl.ParseConflictPolicy(cfg.ETLConflict)
+	if err != nil {
+		return configError{err: err}
+	}
+	if err := checkETLLeaseTTL(cfg); err != nil {
+		return configError{err: err}
+	}
+
+	if cfg.ETLLogDir != "" {
+		if err := e.setupLogs(cfg, filepath.Join(cfg.ETLLogDir, etlLogFile)); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var hooks []etl.Hook
+	if app.DialectOf(db) != app.SQLite { // no alerts nor webhooks on SQLite
+		alertEngine := &alerts.Engine{Store: &alerts.Store{DB: db}}
+		dispatcher := &webhooks.Dispatcher{Store: &webhooks.Store{DB: db}}
+		hooks = []etl.Hook{alertEngine.AfterETL, dispatcher.AfterETL}
+	}
+	// the logs of the command have the run_id of the run, as the ones of etl.Run
+	ctx, _ = logging.WithRunID(ctx)
+	var metrics *etl.Metrics
+	registry := prometheus.NewRegistry()
+	if cfg.ETLMetrics != "" {
+		metrics = etl.NewMetrics(registry)
+	}
+	// holds the lease of the server runs, so they don't load at the same time
+	locker := scheduler.NewDBLocker(db)
+	var stats etl.Stats
+	err = scheduler.RunOnce(ctx, etlJob, func(ctx context.Context) error {
+		var err error
+		stats, err = etl.Run(ctx, db, etl.Config{
+			APIURL:        cfg.APIURL,
+			AuthToken:     cfg.AuthToken,
+			Conflict:      policy,
+			CompaniesFile: cfg.Companies,
+			Metrics:       metrics,
+			Hooks:         hooks,
+		})
+		return err
+	}, locker, cfg.ETLLeaseTTL)
+	if errors.Is(err, scheduler.ErrLeaseHeld) {
+		holder, _ := locker.Holder(ctx, etlJob)
+		return fmt.Errorf("the ETL lease is held by %q, another ETL is running; try again when it finishes or its lease expires: %w", holder, err)
+	}
+	finished := []any{"pages", stats.Pages, "fetched", stats.Fetched, "loaded", stats.Loaded, "duplicates", stats.Duplicates,
+		"changed", stats.Changed, "updated", stats.Updated, "failed", stats.Failed, "company_mismatches", stats.CompanyMismatches}
+	if err != nil {
+		slog.ErrorContext(ctx, "ETL failed", append(finished, "error", err)...)
+	} else {
+		slog.InfoContext(ctx, "ETL finished", finished...)
+	}
+	if metrics != nil {
+		if err := prometheus.WriteToTextfile(cfg.ETLMetrics, registry); err != nil {
+			slog.ErrorContext(ctx, "Could not write the ETL metrics", "error", err)
+		}
+	}
+	fmt.Fprintf(e.stdout, "pages: %d, fetched: %d, loaded: %d, duplicates: %d, changed: %d, updated: %d, failed: %d, company mismatches: %d\n",
+		stats.Pages, stats.Fetched, stats.Loaded, stats.Duplicates, stats.Changed, stats.Updated, stats.Failed, stats.CompanyMismatches)
+	for _, c := range stats.Changes {
+		state := "kept"
+		if c.Applied {
+			state = "updated"
+		}
+		fmt.Fprintf(e.stdout, "  %s (%s)\n", c, state)
+	}
+	if more := stats.Changed - len(stats.Changes); more > 0 {
+		fmt.Fprintf(e.stdout, "  ... and %d more changes\n", more)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/models"
+)
+
+var exportCommand = command{
+	Name:    "export",
+	Summary: "Export the stored events as CSV, JSON Lines or Parquet.",
+	Usage:   "[flags]",
+	Run:     runExport,
+}
+
+// runExport writes the stored events by ticker, in the format of GET /stocks/export,
+// reading them in a single query as they are written.
+func runExport(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL})
+	format := fs.String("format", stocks.FormatCSV, "output format: "+strings.Join(stocks.ExportFormats, ", "))
+	output := fs.String("o", "", "output file (default: stdout)")
+	search := fs.String("search", "", "only export events whose ticker or company contains this text")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !slices.Contains(stocks.ExportFormats, *format) {
+		return usageError{msg: fmt.Sprintf("unknown format %q, expected %s", *format, strings.Join(stocks.ExportFormats, ", "))}
+	}
+
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = e.stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	repo := stocks.NewCockroachDBStockRepository(db)
+	q := stocks.StockQuery{Search: *search, SortBy: "ticker", Order: "asc"}
+	return stocks.Export(w, *format, func(each func(models.StockWithScore) error) error {
+		return repo.ExportStocks(ctx, q, each)
+	})
+}
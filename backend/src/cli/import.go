@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/etl"
+)
+
+var importCommand = command{
+	Name:    "import",
+	Summary: "Load historical recommendations from CSV or JSON Lines files.",
+	Usage:   "[flags] FILE...",
+	Run:     runImport,
+}
+
+func runImport(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL}, app.KeyETLConflict)
+	mappingFile := fs.String("mapping", "", "JSON file mapping the columns of the files to the fields of the items (default: columns named as the fields)")
+	format := fs.String("format", "", "format of the files: csv or jsonl (default: by their extension)")
+	batchSize := fs.Int("batch-size", etl.DefaultImportBatch, "records loaded per transaction")
+	restart := fs.Bool("restart", false, "import the files from their first line, even if a previous import of them stopped or finished")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if len(files) == 0 && !cf.print {
+		return usageError{msg: "missing the files to import"}
+	}
+	if *format != "" && *format != etl.ImportCSV && *format != etl.ImportJSONL {
+		return usageError{msg: fmt.Sprintf("unknown format %q, expected csv or jsonl", *format)}
+	}
+	if *batchSize <= 0 {
+		return usageError{msg: fmt.Sprintf("invalid batch size %d, expected a positive number", *batchSize)}
+	}
+
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+	policy, err := etl.ParseConflictPolicy(cfg.ETLConflict)
+	if err != nil {
+		return configError{err: err}
+	}
+	var mapping etl.ImportMapping
+	if *mappingFile != "" {
+		if mapping, err = etl.ReadImportMapping(*mappingFile); err != nil {
+			return usageError{msg: fmt.Sprintf("invalid mapping: %v", err)}
+		}
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, file := range files {
+		stats, err := etl.Import(ctx, db, file, etl.ImportConfig{
+			Mapping:   mapping,
+			Format:    *format,
+			BatchSize: *batchSize,
+			Conflict:  policy,
+			Restart:   *restart,
+		})
+		if errors.Is(err, etl.ErrAlreadyImported) {
+			fmt.Fprintf(e.stdout, "%s: already imported, use -restart to import it again\n", file)
+			continue
+		}
+		resumed := ""
+		if stats.ResumedAfter > 0 {
+			resumed = fmt.Sprintf(" (resumed after line %d)", stats.ResumedAfter)
+		}
+		fmt.Fprintf(e.stdout, "%s: lines: %d%s, read: %d, loaded: %d, duplicates: %d, changed: %d, updated: %d, failed: %d, company mismatches: %d\n",
+			file, stats.Line, resumed, stats.Fetched, stats.Loaded, stats.Duplicates, stats.Changed, stats.Updated, stats.Failed, stats.CompanyMismatches)
+		if err != nil {
+			return fmt.Errorf("import of %s stopped after line %d: %w", file, stats.Line, err)
+		}
+	}
+	return nil
+}
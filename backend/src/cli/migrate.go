@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/migrations"
+)
+
+var migrateCommand = command{
+	Name:    "migrate",
+	Summary: "Apply, revert or list the database schema migrations.",
+	Usage:   "up|down|status [flags]",
+	Run:     runMigrate,
+}
+
+func runMigrate(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL})
+	steps := fs.Int("steps", 0, "number of migrations to apply or revert (default: all for up, 1 for down)")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return usageError{msg: "missing action, expected up, down or status"}
+	}
+	action := args[0]
+	if action == "-h" || action == "-help" || action == "--help" {
+		return parseFlags(fs, args)
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{msg: fmt.Sprintf("unexpected arguments %v", fs.Args())}
+	}
+
+	var run func(ctx context.Context, e *env, db *sql.DB, steps int) error
+	switch action {
+	case "up":
+		run = migrateUp
+	case "down":
+		run = migrateDown
+	case "status":
+		run = migrateStatus
+	default:
+		return usageError{msg: fmt.Sprintf("unknown action %q, expected up, down or status", action)}
+	}
+
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return run(ctx, e, db, *steps)
+}
+
+func migrateUp(ctx context.Context, e *env, db *sql.DB, steps int) error {
+	applied, err := migrations.Up(ctx, db, steps)
+	for _, m := range applied {
+		fmt.Fprintf(e.stdout, "applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Fprintln(e.stdout, "schema is up to date")
+	}
+	return err
+}
+
+func migrateDown(ctx context.Context, e *env, db *sql.DB, steps int) error {
+	if steps <= 0 {
+		steps = 1 // reverting everything must be explicit
+	}
+
+	reverted, err := migrations.Down(ctx, db, steps)
+	for _, m := range reverted {
+		fmt.Fprintf(e.stdout, "reverted %04d_%s\n", m.Version, m.Name)
+	}
+	return err
+}
+
+func migrateStatus(ctx context.Context, e *env, db *sql.DB, _ int) error {
+	statuses, err := migrations.GetStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return tw.Flush()
+}
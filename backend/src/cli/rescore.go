@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/etl"
+)
+
+var rescoreCommand = command{
+	Name:    "rescore",
+	Summary: "Recalculate the recommendation score of every stored event.",
+	Usage:   "[flags]",
+	Run:     runRescore,
+}
+
+func runRescore(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated, err := etl.Rescore(ctx, db)
+	fmt.Fprintf(e.stdout, "rescored %d events\n", updated)
+	return err
+}
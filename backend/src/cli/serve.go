@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"vue_go_cockroachdb/src/api"
+	"vue_go_cockroachdb/src/api/admin"
+	"vue_go_cockroachdb/src/api/alerts"
+	"vue_go_cockroachdb/src/api/auth"
+	"vue_go_cockroachdb/src/api/metrics"
+	"vue_go_cockroachdb/src/api/ratelimit"
+	"vue_go_cockroachdb/src/api/search"
+	"vue_go_cockroachdb/src/api/stocks"
+	"vue_go_cockroachdb/src/api/webhooks"
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/demo"
+	"vue_go_cockroachdb/src/etl"
+	"vue_go_cockroachdb/src/migrations"
+	"vue_go_cockroachdb/src/scheduler"
+)
+
+var serveCommand = command{
+	Name:    "serve",
+	Summary: "Start the HTTP API server.",
+	Usage:   "[flags]",
+	Run:     runServe,
+}
+
+const (
+	// shutdownTimeout is how long in-flight requests have to finish on shutdown.
+	shutdownTimeout = 10 * time.Second
+	// webhookDispatchInterval is how often the pending webhook deliveries are sent.
+	webhookDispatchInterval = 15 * time.Second
+)
+
+// runServe initializes the database connection, checks that the schema is up to date,
+// sets up the stock repository and HTTP handlers, and starts the HTTP server until ctx is done.
+// When the external API is configured, the ETL can be run through the admin endpoints
+// and, with an ETL schedule, periodically.
+func runServe(ctx context.Context, e *env, fs *flag.FlagSet, args []string) error {
+	cf := addConfigFlags(fs, []string{app.KeyDBURL, app.KeyPort},
+		app.KeyAPIURL, app.KeyAuthToken, app.KeyETLSchedule, app.KeyETLLeaseTTL, app.KeyETLConflict, app.KeyCompanies,
+		app.KeyAPIAuth, app.KeyAPIDailyQuota, app.KeyRateLimit, app.KeyRateLimitBurst, app.KeyMaxPageSize,
+		app.KeyCacheEntries, app.KeyCacheMaxAge)
+	demoMode := fs.Bool("demo", false, "serve the stocks of a fixture from memory, without a database; alerts, webhooks, the ETL and API keys are disabled")
+	demoFixture := fs.String("demo-fixture", "", "JSON fixture of -demo, an array of stocks as served by GET /stocks (default: the embedded one)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *demoMode {
+		cf.required = []string{app.KeyPort}
+	}
+	cfg, err := cf.load(e)
+	if err != nil || cf.print {
+		return err
+	}
+	schedule, err := etlSchedule(cfg)
+	if err != nil {
+		return configError{err: err}
+	}
+	policy, err := etl.ParseConflictPolicy(cfg.ETLConflict)
+	if err != nil {
+		return configError{err: err}
+	}
+	if err := checkAPILimits(cfg); err != nil {
+		return configError{err: err}
+	}
+	if *demoMode {
+		return runDemo(ctx, cfg, *demoFixture)
+	}
+	// the alerts, webhooks and API keys only have CockroachDB/PostgreSQL stores, so a
+	// SQLite server can only run without authentication, if asked to explicitly
+	dialect, _ := app.ParseDBURL(cfg.DBURL)
+	sqlite := dialect == app.SQLite
+	if sqlite && cfg.APIAuth {
+		return configError{err: fmt.Errorf("%s: a SQLite database has no API keys; set %s=false to serve the API, admin endpoints included, without authentication",
+			app.KeyAPIAuth, app.KeyAPIAuth)}
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := migrations.CheckCurrent(ctx, db); err != nil {
+		return err
+	}
+
+	m := metrics.New()
+	m.RegisterDB(db, "stocks")
+	repo := m.Repository(stocks.NewCockroachDBStockRepository(db))
+	watcher := &stocks.IngestWatcher{Repo: repo}
+	handler := newStockHandler(cfg, repo, watcher)
+
+	handlers := api.Handlers{Stocks: handler, Search: &search.Handler{Searcher: handler.Search}, Metrics: m}
+	var hooks []etl.Hook
+	if sqlite {
+		slog.WarnContext(ctx, "SQLite database: alerts, webhooks and API keys are disabled")
+	} else {
+		alertStore := &alerts.Store{DB: db}
+		alertEngine := &alerts.Engine{Store: alertStore}
+		webhookStore := &webhooks.Store{DB: db}
+		dispatcher := &webhooks.Dispatcher{Store: webhookStore}
+		hooks = []etl.Hook{alertEngine.AfterETL, dispatcher.AfterETL}
+		handlers.Alerts = &alerts.Handler{Store: alertStore}
+		handlers.Webhooks = &webhooks.Handler{Store: webhookStore}
+
+		// retries the webhook deliveries that failed or were queued by other processes
+		dispatcherDone := make(chan struct{})
+		go func() {
+			defer close(dispatcherDone)
+			dispatcher.Run(ctx, webhookDispatchInterval)
+		}()
+		defer func() { <-dispatcherDone }()
+	}
+
+	adminHandler := &admin.Handler{DB: db, Conflict: policy, Hooks: hooks}
+	if cfg.APIURL != "" && cfg.AuthToken != "" {
+		progress := &etl.Progress{}
+		etlMetrics := etl.NewMetrics(m.Registry)
+		job := func(ctx context.Context) error {
+			stats, err := etl.Run(ctx, db, etl.Config{
+				APIURL:        cfg.APIURL,
+				AuthToken:     cfg.AuthToken,
+				Conflict:      policy,
+				CompaniesFile: cfg.Companies,
+				Progress:      progress,
+				Metrics:       etlMetrics,
+				Hooks:         hooks,
+			})
+			slog.InfoContext(ctx, "ETL finished", "pages", stats.Pages, "fetched", stats.Fetched, "loaded", stats.Loaded,
+				"duplicates", stats.Duplicates, "changed", stats.Changed, "updated", stats.Updated, "failed", stats.Failed,
+				"company_mismatches", stats.CompanyMismatches)
+			return err
+		}
+		runner := scheduler.NewRunner(etlJob, job, schedule, scheduler.NewDBLocker(db), cfg.ETLLeaseTTL)
+		runner.Start(ctx)
+		defer runner.Wait()
+		if schedule != nil {
+			slog.InfoContext(ctx, "ETL scheduled", "schedule", schedule.String())
+		}
+		adminHandler.ETL = runner
+		adminHandler.ETLProgress = progress
+	}
+
+	// wakes up the /events/stream clients when any process loads events
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		watcher.Run(ctx)
+	}()
+	defer func() { <-watcherDone }()
+
+	switch {
+	case cfg.APIAuth:
+		keyStore := &auth.Store{DB: db}
+		authenticator := auth.NewAuthenticator(keyStore)
+		authenticator.DailyQuota = int64(cfg.APIDailyQuota)
+		usageDone := make(chan struct{})
+		go func() {
+			defer close(usageDone)
+			authenticator.Run(ctx, auth.DefaultUsageFlushInterval)
+		}()
+		defer func() { <-usageDone }()
+		handlers.Keys = &auth.Handler{Store: keyStore, Auth: authenticator}
+		handlers.Auth = authenticator
+	case !sqlite:
+		handlers.Keys = &auth.Handler{Store: &auth.Store{DB: db}}
+		fallthrough
+	default:
+		slog.WarnContext(ctx, "API authentication is disabled: every endpoint is open")
+	}
+
+	handlers.Admin = adminHandler
+	if cfg.RateLimit > 0 {
+		handlers.RateLimit = ratelimit.New(cfg.RateLimit, cfg.RateLimitBurst)
+	}
+	return listenAndServe(ctx, cfg.Port, api.NewRouter(handlers))
+}
+
+// runDemo serves the stocks of the fixture file (the embedded one if empty) from
+// memory, until ctx is done. Only the stock and watchlist endpoints work, without
+// authentication; the watchlists are lost on exit.
+func runDemo(ctx context.Context, cfg *app.Config, fixture string) error {
+	events, err := demo.Load(fixture)
+	if err != nil {
+		return err
+	}
+	memory := stocks.NewMemoryStockRepository()
+	memory.Add(events...)
+	m := metrics.New()
+	repo := m.Repository(memory)
+	watcher := &stocks.IngestWatcher{Repo: repo}
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		watcher.Run(ctx)
+	}()
+	defer func() { <-watcherDone }()
+
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit > 0 {
+		limiter = ratelimit.New(cfg.RateLimit, cfg.RateLimitBurst)
+	}
+	handler := newStockHandler(cfg, repo, watcher)
+	slog.InfoContext(ctx, "Demo mode: serving the stock events from memory, without a database", "events", len(events))
+	router := api.NewRouter(api.Handlers{
+		Stocks:    handler,
+		Search:    &search.Handler{Searcher: handler.Search},
+		RateLimit: limiter,
+		Metrics:   m,
+	})
+	return listenAndServe(ctx, cfg.Port, router)
+}
+
+// newStockHandler returns the handler of the stocks API with the page size and cache
+// settings of cfg, and a search index of repo.
+func newStockHandler(cfg *app.Config, repo stocks.StockRepository, watcher *stocks.IngestWatcher) *stocks.Handler {
+	h := stocks.NewHandler(repo)
+	h.Watcher, h.MaxPageSize, h.CacheMaxAge = watcher, cfg.MaxPageSize, cfg.CacheMaxAge
+	h.Search = search.NewSearcher(repo)
+	if cfg.CacheEntries > 0 {
+		h.Cache = stocks.NewResponseCache(cfg.CacheEntries)
+	}
+	return h
+}
+
+// listenAndServe serves handler on port until ctx is done, then shuts the server down
+// giving the in-flight requests shutdownTimeout to finish.
+func listenAndServe(ctx context.Context, port string, handler http.Handler) error {
+	srv := &http.Server{Addr: ":" + port, Handler: handler}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("Server listening", "port", port)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// etlJob is the name of the lease of the ETL runs, of the server and the etl command.
+const etlJob = "etl"
+
+// checkETLLeaseTTL validates the ETL lease of cfg, renewed every third of it.
+func checkETLLeaseTTL(cfg *app.Config) error {
+	if cfg.ETLLeaseTTL < scheduler.MinLeaseTTL {
+		return fmt.Errorf("%s must be at least %s", app.KeyETLLeaseTTL, scheduler.MinLeaseTTL)
+	}
+	return nil
+}
+
+// etlSchedule parses the ETL schedule of cfg, nil if there's none. A schedule needs
+// the external API settings.
+func etlSchedule(cfg *app.Config) (*scheduler.Schedule, error) {
+	if err := checkETLLeaseTTL(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ETLSchedule == "" {
+		return nil, nil
+	}
+	var problems []error
+	schedule, err := scheduler.ParseSchedule(cfg.ETLSchedule)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("%s: %w", app.KeyETLSchedule, err))
+	}
+	if err := cfg.Require(app.KeyAPIURL, app.KeyAuthToken); err != nil {
+		problems = append(problems, fmt.Errorf("%s is set: %w", app.KeyETLSchedule, err))
+	}
+	return schedule, errors.Join(problems...)
+}
+
+// checkAPILimits validates the rate limit, quota, page size and cache settings of cfg.
+func checkAPILimits(cfg *app.Config) error {
+	var problems []error
+	if cfg.MaxPageSize <= 0 {
+		problems = append(problems, fmt.Errorf("%s must be positive", app.KeyMaxPageSize))
+	}
+	if cfg.RateLimit < 0 {
+		problems = append(problems, fmt.Errorf("%s must be 0 (no limit) or positive", app.KeyRateLimit))
+	}
+	if cfg.RateLimit > 0 && cfg.RateLimitBurst <= 0 {
+		problems = append(problems, fmt.Errorf("%s must be positive", app.KeyRateLimitBurst))
+	}
+	if cfg.APIDailyQuota < 0 {
+		problems = append(problems, fmt.Errorf("%s must be 0 (unlimited) or positive", app.KeyAPIDailyQuota))
+	}
+	if cfg.CacheEntries < 0 {
+		problems = append(problems, fmt.Errorf("%s must be 0 (no cache) or positive", app.KeyCacheEntries))
+	}
+	if cfg.CacheMaxAge < 0 {
+		problems = append(problems, fmt.Errorf("%s can't be negative", app.KeyCacheMaxAge))
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,56 @@
+// Package demo has the stock events served by `backend serve -demo`, which keeps them in
+// memory so the frontend can run without a database.
+package demo
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"vue_go_cockroachdb/src/etl"
+	"vue_go_cockroachdb/src/models"
+)
+
+// fixture is the default demo data: a few days of real-looking rating changes.
+//
+//go:embed stocks.json
+var fixture []byte
+
+// Load reads the events of a fixture file, a JSON array of stocks as served by
+// GET /stocks, and scores them as the ETL does. An empty path loads the default
+// fixture.
+func Load(path string) ([]models.StockWithScore, error) {
+	data, name := fixture, "stocks.json (embedded)"
+	if path != "" {
+		name = path
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("demo fixture: %w", err)
+		}
+	}
+	events, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("demo fixture %s: %w", name, err)
+	}
+	return events, nil
+}
+
+// Decode reads a JSON array of stocks and scores them as the ETL does. Every stock
+// needs a ticker and a time.
+func Decode(r io.Reader) ([]models.StockWithScore, error) {
+	var stocks []models.Stock
+	if err := json.NewDecoder(r).Decode(&stocks); err != nil {
+		return nil, err
+	}
+	events := make([]models.StockWithScore, 0, len(stocks))
+	for i, s := range stocks {
+		if s.Ticker == "" || s.Time.IsZero() {
+			return nil, fmt.Errorf("stock %d: the ticker and time are required", i)
+		}
+		events = append(events, models.StockWithScore{Stock: s, RecommendationScore: etl.CalculateStockScore(s)})
+	}
+	return events, nil
+}
@@ -0,0 +1,32 @@
+package demo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadEmbeddedFixture(t *testing.T) {
+	events, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 20 {
+		t.Fatalf("the fixture has %d events; want a few dozen", len(events))
+	}
+	scored := 0
+	for _, e := range events {
+		if e.RecommendationScore != 0 {
+			scored++
+		}
+	}
+	if scored == 0 {
+		t.Error("no event of the fixture was scored")
+	}
+}
+
+func TestDecodeRequiresTickerAndTime(t *testing.T) {
+	_, err := Decode(strings.NewReader(`[{"ticker": "AKBA", "time": "2025-06-03T13:30:00Z"}, {"ticker": "MRNA"}]`))
+	if err == nil || !strings.Contains(err.Error(), "stock 1") {
+		t.Errorf("Decode = %v; want an error about stock 1", err)
+	}
+}
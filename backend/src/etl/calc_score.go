@@ -1,17 +1,21 @@
-package main
+package etl
 
 import (
 	"strings"
 	"time"
 	"vue_go_cockroachdb/src/models"
+
+	"github.com/shopspring/decimal"
 )
 
 func CalculateStockScore(s models.Stock) float64 {
 	score := 0.0
 
 	// 1. Profit potential
-	if s.TargetFrom > 0 {
-		potential := ((s.TargetTo - s.TargetFrom) / s.TargetFrom) * 100
+	// (skipped when any of the targets is missing)
+	if s.TargetFrom.Valid && s.TargetTo.Valid && s.TargetFrom.Decimal.IsPositive() {
+		from, to := s.TargetFrom.Decimal, s.TargetTo.Decimal
+		potential := to.Sub(from).Div(from).Mul(decimal.NewFromInt(100)).InexactFloat64()
 		if potential > 0 {
 			score += potential / 4 // More weight to upside
 		} else {
@@ -37,12 +41,7 @@ func CalculateStockScore(s models.Stock) float64 {
 	}
 
 	// 4. Recent (more weight if it is from the last 3 days)
-	var daysAgo float64
-	if t, err := time.Parse(time.RFC3339, s.Time); err == nil {
-		daysAgo = time.Since(t).Hours() / 24
-	} else {
-		daysAgo = 999 // If it cannot be parsed, it is assumed to be very old
-	}
+	daysAgo := time.Since(s.Time).Hours() / 24
 	if daysAgo < 1 {
 		score += 1.5
 	} else if daysAgo < 3 {
@@ -1,7 +1,11 @@
-package main
+package etl
 
 import (
 	"testing"
+	"time"
+	"vue_go_cockroachdb/src/models"
+
+	"github.com/shopspring/decimal"
 )
 
 func TestNormalizeRating(t *testing.T) {
@@ -25,3 +29,41 @@ func TestNormalizeRating(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculateStockScore(t *testing.T) {
+	base := models.Stock{
+		Action:     models.ActionUpgraded,
+		RatingFrom: models.RatingNeutral,
+		RatingTo:   models.RatingBuy,
+		TargetFrom: models.NewPrice(decimal.RequireFromString("10.00")),
+		TargetTo:   models.NewPrice(decimal.RequireFromString("12.50")),
+	}
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected float64
+	}{
+		// 25% upside / 4 + upgraded (2) + rating change (9-5)*2
+		{"old event", time.Now().Add(-30 * 24 * time.Hour), 6.25 + 2 + 8},
+		{"today", time.Now().Add(-time.Hour), 6.25 + 2 + 8 + 1.5},
+		{"zero time is treated as very old", time.Time{}, 6.25 + 2 + 8},
+	}
+
+	for _, tt := range tests {
+		s := base
+		s.Time = tt.time
+		got := CalculateStockScore(s)
+		if got != tt.expected {
+			t.Errorf("%s: CalculateStockScore() = %v; want %v", tt.name, got, tt.expected)
+		}
+	}
+
+	// missing targets skip the profit potential
+	s := base
+	s.TargetFrom = models.Price{}
+	s.Time = time.Now().Add(-30 * 24 * time.Hour)
+	if got := CalculateStockScore(s); got != 2+8 {
+		t.Errorf("without target_from: CalculateStockScore() = %v; want %v", got, 2+8)
+	}
+}
@@ -0,0 +1,257 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+// companyColumns are the columns of a companies CSV file, named in its header in any
+// order. ticker and name are required; the others can be missing or empty.
+var companyColumns = []string{"ticker", "name", "exchange", "sector", "industry"}
+
+// ReadCompaniesCSV reads the companies of a CSV file with a header naming its
+// companyColumns. Tickers are upper-cased; a ticker listed twice is an error.
+func ReadCompaniesCSV(r io.Reader) ([]models.Company, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty file, the header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if slices.Contains(companyColumns, name) {
+			index[name] = i
+		}
+	}
+	for _, required := range companyColumns[:2] {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("the header has no %q column", required)
+		}
+	}
+
+	var companies []models.Company
+	seen := map[string]int{} // ticker -> line
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return companies, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := index[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		c := models.Company{
+			Ticker:   strings.ToUpper(field("ticker")),
+			Name:     field("name"),
+			Exchange: field("exchange"),
+			Sector:   field("sector"),
+			Industry: field("industry"),
+		}
+		switch {
+		case c.Ticker == "" && c.Name == "":
+			continue // blank line
+		case c.Ticker == "":
+			return nil, fmt.Errorf("line %d: the ticker is empty", line)
+		case c.Name == "":
+			return nil, fmt.Errorf("line %d: the name of %s is empty", line, c.Ticker)
+		}
+		if first, ok := seen[c.Ticker]; ok {
+			return nil, fmt.Errorf("line %d: %s is already on line %d", line, c.Ticker, first)
+		}
+		seen[c.Ticker] = line
+		companies = append(companies, c)
+	}
+}
+
+// CompanyLoad summarizes a LoadCompanies.
+type CompanyLoad struct {
+	Companies int // rows of the file, inserted or updated
+	// Mismatches is the number of (ticker, company) pairs of the stored events whose
+	// company isn't the canonical name of the ticker.
+	Mismatches int
+	Reflagged  int // events whose company_mismatch changed
+}
+
+// LoadCompanies loads the companies of the CSV file at path (see ReadCompaniesCSV)
+// into the companies table, inserting the new tickers and updating the known ones;
+// tickers missing from the file are kept. It then flags the stored events whose company
+// isn't the canonical name of their ticker (company_mismatch). A load that reflags
+// events bumps the data version.
+func LoadCompanies(ctx context.Context, db *sql.DB, path string) (CompanyLoad, error) {
+	var load CompanyLoad
+	f, err := os.Open(path)
+	if err != nil {
+		return load, err
+	}
+	defer f.Close()
+	companies, err := ReadCompaniesCSV(f)
+	if err != nil {
+		return load, fmt.Errorf("%s: %w", path, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return load, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	for _, c := range companies {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO companies (ticker, name, exchange, sector, industry, updated_at)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6)
+			ON CONFLICT (ticker) DO UPDATE SET
+				name = excluded.name, exchange = excluded.exchange, sector = excluded.sector,
+				industry = excluded.industry, updated_at = excluded.updated_at
+		`, c.Ticker, c.Name, c.Exchange, c.Sector, c.Industry, now)
+		if err != nil {
+			return load, fmt.Errorf("store company %s: %w", c.Ticker, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return load, err
+	}
+	load.Companies = len(companies)
+
+	// the flags of every event are reset from the names read, so they must be complete
+	names, err := readCompanies(ctx, db)
+	if err != nil {
+		return load, fmt.Errorf("read the companies to flag the events: %w", err)
+	}
+	defer func() { bumpDataVersion(ctx, db, load.Reflagged > 0) }()
+	load.Mismatches, load.Reflagged, err = flagCompanyMismatches(ctx, db, names)
+	return load, err
+}
+
+// flagCompanyMismatches sets the company_mismatch of the stored events with the
+// canonical names of companies. It returns the number of mismatched (ticker, company)
+// pairs and of events whose flag changed.
+func flagCompanyMismatches(ctx context.Context, db *sql.DB, companies companyNames) (int, int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT ticker, COALESCE(company, ''), company_mismatch FROM stocks`)
+	if err != nil {
+		return 0, 0, err
+	}
+	type pair struct {
+		ticker, company string
+		mismatch        bool
+	}
+	var wrong []pair // pairs whose flag is wrong
+	mismatches := 0
+	for rows.Next() {
+		var p pair
+		var flagged bool
+		if err := rows.Scan(&p.ticker, &p.company, &flagged); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		p.mismatch = companies.mismatch(p.ticker, p.company)
+		if p.mismatch {
+			mismatches++
+		}
+		if p.mismatch != flagged {
+			wrong = append(wrong, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	reflagged := 0
+	for _, p := range wrong {
+		res, err := db.ExecContext(ctx, `UPDATE stocks SET company_mismatch = $3 WHERE ticker = $1 AND COALESCE(company, '') = $2`,
+			p.ticker, p.company, p.mismatch)
+		if err != nil {
+			return mismatches, reflagged, err
+		}
+		n, _ := res.RowsAffected()
+		reflagged += int(n)
+		if p.mismatch {
+			slog.WarnContext(ctx, "Company name mismatch", "ticker", p.ticker, "company", companies[p.ticker], "received", p.company)
+		}
+	}
+	return mismatches, reflagged, nil
+}
+
+// companyNames maps the tickers of the companies table to their canonical name.
+type companyNames map[string]string
+
+// readCompanies returns the canonical names of the companies table.
+func readCompanies(ctx context.Context, db *sql.DB) (companyNames, error) {
+	rows, err := db.QueryContext(ctx, `SELECT ticker, name FROM companies`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := companyNames{}
+	for rows.Next() {
+		var ticker, name string
+		if err := rows.Scan(&ticker, &name); err != nil {
+			return nil, err
+		}
+		names[ticker] = name
+	}
+	return names, rows.Err()
+}
+
+// loadCompanyNames returns the canonical names of the companies table for a load of
+// events. If they can't be read the error is logged and the names of the events aren't
+// checked: none is flagged.
+func loadCompanyNames(ctx context.Context, db *sql.DB) companyNames {
+	names, err := readCompanies(ctx, db)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not load the companies, names aren't checked", "error", err)
+		return companyNames{}
+	}
+	return names
+}
+
+// mismatch reports whether company isn't the canonical name of ticker. Unknown tickers
+// never mismatch.
+func (c companyNames) mismatch(ticker, company string) bool {
+	canonical, ok := c[ticker]
+	return ok && companyKey(company) != companyKey(canonical)
+}
+
+// legalSuffixes are words of company names left out of their comparison, so
+// "Moderna, Inc." is the canonical "Moderna".
+var legalSuffixes = []string{"the", "inc", "incorporated", "corp", "corporation", "co", "company",
+	"ltd", "limited", "plc", "llc", "lp", "sa", "ag", "nv", "se"}
+
+// companyKey reduces a company name to its lowercase words, without the legalSuffixes
+// and with "and" for "&", so spellings of the same name share the key.
+func companyKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(name, "&", " and ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.'
+	})
+	var key []string
+	for _, w := range words {
+		w = strings.ReplaceAll(w, ".", "") // "S.A." and "SA"
+		if w != "" && !slices.Contains(legalSuffixes, w) {
+			key = append(key, w)
+		}
+	}
+	return strings.Join(key, " ")
+}
@@ -0,0 +1,125 @@
+package etl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/models"
+)
+
+func TestReadCompaniesCSV(t *testing.T) {
+	companies, err := ReadCompaniesCSV(strings.NewReader("\ufeffSector,Ticker,Name\n" +
+		"Health Care,akba,Akebia Therapeutics\n" +
+		",,\n" +
+		"Communication Services, MOMO , \"Hello Group, Inc.\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Company{
+		{Ticker: "AKBA", Name: "Akebia Therapeutics", Sector: "Health Care"},
+		{Ticker: "MOMO", Name: "Hello Group, Inc.", Sector: "Communication Services"},
+	}
+	if !slices.Equal(companies, want) {
+		t.Errorf("ReadCompaniesCSV() = %+v; want %+v", companies, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"ticker,exchange\nAKBA,NASDAQ\n",
+		"ticker,name\n,Akebia\n",
+		"ticker,name\nAKBA,\n",
+		"ticker,name\nAKBA,Akebia\nakba,Akebia Therapeutics\n",
+	} {
+		if _, err := ReadCompaniesCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadCompaniesCSV(%q) didn't fail", bad)
+		}
+	}
+}
+
+func TestCompanyMismatch(t *testing.T) {
+	names := companyNames{"MRNA": "Moderna", "BBVA": "Banco Bilbao Vizcaya Argentaria, S.A.", "JNJ": "Johnson & Johnson"}
+	tests := []struct {
+		ticker, company string
+		want            bool
+	}{
+		{"MRNA", "Moderna", false},
+		{"MRNA", "Moderna, Inc.", false},
+		{"MRNA", "MODERNA INC", false},
+		{"MRNA", "Moderna Therapeutics", true},
+		{"BBVA", "Banco Bilbao Vizcaya Argentaria SA", false},
+		{"JNJ", "Johnson and Johnson", false},
+		{"JNJ", "Johnson Controls", true},
+		{"ZM", "Zoom Video", false}, // unknown ticker
+	}
+	for _, tt := range tests {
+		if got := names.mismatch(tt.ticker, tt.company); got != tt.want {
+			t.Errorf("mismatch(%s, %q) = %v; want %v", tt.ticker, tt.company, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCompaniesOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	at := time.Date(2025, 6, 3, 14, 0, 0, 0, time.UTC)
+	for i, company := range []string{"Moderna, Inc.", "Moderna Therapeutics", "Zoom Video"} {
+		ticker := "MRNA"
+		if i == 2 {
+			ticker = "ZM"
+		}
+		item := models.StockWithScore{Stock: models.Stock{Ticker: ticker, Company: company, Action: models.ActionReiterated,
+			RatingFrom: "Buy", RatingTo: "Buy", Time: at.Add(time.Duration(i) * time.Hour)}}
+		if _, _, err := loadStockItem(ctx, db, item, ConflictIgnore); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "companies.csv")
+	if err := os.WriteFile(path, []byte("ticker,name,exchange\nMRNA,Moderna,NASDAQ\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var version int64
+	db.QueryRowContext(ctx, `SELECT version FROM data_version`).Scan(&version)
+
+	load, err := LoadCompanies(ctx, db, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load != (CompanyLoad{Companies: 1, Mismatches: 1, Reflagged: 1}) {
+		t.Errorf("LoadCompanies() = %+v; want 1 company, 1 mismatch, 1 reflagged event", load)
+	}
+	var flagged []string
+	rows, err := db.QueryContext(ctx, `SELECT company FROM stocks WHERE company_mismatch ORDER BY company`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var company string
+		rows.Scan(&company)
+		flagged = append(flagged, company)
+	}
+	rows.Close()
+	if !slices.Equal(flagged, []string{"Moderna Therapeutics"}) {
+		t.Errorf("flagged events %v; want Moderna Therapeutics", flagged)
+	}
+	var next int64
+	if db.QueryRowContext(ctx, `SELECT version FROM data_version`).Scan(&next); next <= version {
+		t.Errorf("data version %d after reflagging events; want more than %d", next, version)
+	}
+
+	// the file now names the ticker as the event did
+	if err := os.WriteFile(path, []byte("ticker,name\nMRNA,Moderna Therapeutics\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if load, err := LoadCompanies(ctx, db, path); err != nil || load.Mismatches != 1 || load.Reflagged != 2 {
+		t.Errorf("LoadCompanies() = %+v, %v; want 1 mismatch, 2 reflagged events", load, err)
+	}
+	var exchange *string
+	if err := db.QueryRowContext(ctx, `SELECT exchange FROM companies WHERE ticker = 'MRNA'`).Scan(&exchange); err != nil || exchange != nil {
+		t.Errorf("exchange of MRNA = %v, %v; want NULL after a load without it", exchange, err)
+	}
+}
@@ -0,0 +1,263 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/models"
+)
+
+// ConflictPolicy decides what the ETL does when the external API sends an event
+// (ticker, time) that is already stored with different values, e.g. a corrected target.
+type ConflictPolicy string
+
+const (
+	// ConflictIgnore keeps the stored version; the change is only reported.
+	ConflictIgnore ConflictPolicy = "ignore"
+	// ConflictOverwrite replaces the stored version with the new one.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRevisions replaces the stored version, copying it first to "stock_revisions".
+	ConflictRevisions ConflictPolicy = "revisions"
+)
+
+// ConflictPolicies lists the valid policies.
+var ConflictPolicies = []ConflictPolicy{ConflictIgnore, ConflictOverwrite, ConflictRevisions}
+
+// ParseConflictPolicy returns the policy named s. Empty means ConflictIgnore, the
+// behavior before policies existed.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	if s == "" {
+		return ConflictIgnore, nil
+	}
+	for _, p := range ConflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (valid: ignore, overwrite, revisions)", s)
+}
+
+// FieldChange is a field of an event whose stored value differs from the received one.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Change reports an event received with values different from the stored ones.
+type Change struct {
+	Ticker  string        `json:"ticker"`
+	Time    time.Time     `json:"time"`
+	Fields  []FieldChange `json:"fields"`
+	Applied bool          `json:"applied"` // false under ConflictIgnore
+}
+
+// String formats the change as "TICKER @ time: field old -> new, ...".
+func (c Change) String() string {
+	fields := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		fields[i] = fmt.Sprintf("%s %q -> %q", f.Field, f.Old, f.New)
+	}
+	return fmt.Sprintf("%s @ %s: %s", c.Ticker, c.Time.Format(time.RFC3339), strings.Join(fields, ", "))
+}
+
+// loadOutcome is the result of loading one event.
+type loadOutcome int
+
+const (
+	loadInserted  loadOutcome = iota // new event
+	loadUnchanged                    // already stored with the same values
+	loadChanged                      // stored with other values, kept by the policy
+	loadUpdated                      // stored with other values, replaced by the policy
+)
+
+// stockColumns are the columns of an event compared on conflicts, in the order
+// scanned by loadStockItem. The score isn't compared: it's derived from the other
+// fields and from the age of the event.
+const stockColumns = `COALESCE(company, ''), COALESCE(brokerage, ''), COALESCE(action, ''),
+	COALESCE(rating_from, ''), COALESCE(rating_to, ''), target_from, target_to,
+	COALESCE(target_currency, ''), COALESCE(action_raw, ''), COALESCE(rating_from_raw, ''),
+	COALESCE(rating_to_raw, '')`
+
+// loadStockItem inserts item into the stocks table. If a record with the same ticker and
+// time already exists, it's compared with item and policy decides whether it's replaced.
+// The changed fields are returned for loadChanged and loadUpdated.
+func loadStockItem(ctx context.Context, db *sql.DB, item models.StockWithScore, policy ConflictPolicy) (loadOutcome, []FieldChange, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+	outcome, changes, err := loadStockItemTx(ctx, tx, app.DialectOf(db), item, policy)
+	if err != nil {
+		return 0, nil, err
+	}
+	return outcome, changes, tx.Commit()
+}
+
+// loadStockItemTx is loadStockItem in the transaction tx of a database of dialect, which
+// the caller commits.
+func loadStockItemTx(ctx context.Context, tx *sql.Tx, dialect app.Dialect, item models.StockWithScore, policy ConflictPolicy) (loadOutcome, []FieldChange, error) {
+	// SQLite has no row locks, nor sequences, nor arrays: its transactions lock the
+	// whole database when they begin (see app.ParseDBURL), the trigger of the stocks
+	// table numbers the inserts and changed_fields holds a JSON array.
+	sqlite := dialect == app.SQLite
+	lock, nextSeq := "FOR UPDATE", "nextval('stocks_ingest_seq')"
+	if sqlite {
+		lock, nextSeq = "", "(SELECT MAX(ingest_seq) + 1 FROM stocks)"
+	}
+	item.Time = item.Time.UTC() // SQLite compares the times as text
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO stocks (
+			ticker, company, brokerage, action, rating_from, rating_to,
+			target_from, target_to, time, recommendation_score,
+			action_raw, rating_from_raw, rating_to_raw, target_currency, company_mismatch
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9, $10, $11, $12, $13, NULLIF($14, ''), $15)
+		ON CONFLICT (ticker, time) DO NOTHING
+	`,
+		item.Ticker,
+		item.Company,
+		item.Brokerage,
+		item.Action,
+		item.RatingFrom,
+		item.RatingTo,
+		item.TargetFrom,
+		item.TargetTo,
+		item.Time,
+		item.RecommendationScore,
+		item.ActionRaw,
+		item.RatingFromRaw,
+		item.RatingToRaw,
+		item.TargetCurrency,
+		item.CompanyMismatch,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, nil, err
+	} else if n > 0 {
+		return loadInserted, nil, nil
+	}
+
+	var stored models.Stock
+	err = tx.QueryRowContext(ctx, `SELECT `+stockColumns+` FROM stocks WHERE ticker = $1 AND time = $2 `+lock,
+		item.Ticker, item.Time).Scan(
+		&stored.Company, &stored.Brokerage, &stored.Action, &stored.RatingFrom, &stored.RatingTo,
+		&stored.TargetFrom, &stored.TargetTo, &stored.TargetCurrency,
+		&stored.ActionRaw, &stored.RatingFromRaw, &stored.RatingToRaw,
+	)
+	if err != nil {
+		return 0, nil, fmt.Errorf("read stored event: %w", err)
+	}
+
+	changes := diffStock(stored, item.Stock)
+	switch {
+	case len(changes) == 0:
+		return loadUnchanged, nil, nil
+	case policy == ConflictIgnore:
+		return loadChanged, changes, nil
+	}
+
+	if policy == ConflictRevisions {
+		fields := make([]string, len(changes))
+		for i, c := range changes {
+			fields[i] = c.Field
+		}
+		var changedFields any = pq.Array(fields)
+		if sqlite {
+			encoded, _ := json.Marshal(fields)
+			changedFields = string(encoded)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_revisions (
+				ticker, time, revision, company, brokerage, action, rating_from, rating_to,
+				target_from, target_to, recommendation_score,
+				action_raw, rating_from_raw, rating_to_raw, target_currency, changed_fields
+			)
+			SELECT ticker, time,
+				(SELECT COALESCE(MAX(revision), 0) + 1 FROM stock_revisions WHERE ticker = $1 AND time = $2),
+				company, brokerage, action, rating_from, rating_to,
+				target_from, target_to, recommendation_score,
+				action_raw, rating_from_raw, rating_to_raw, target_currency, $3
+			FROM stocks WHERE ticker = $1 AND time = $2
+		`, item.Ticker, item.Time, changedFields)
+		if err != nil {
+			return 0, nil, fmt.Errorf("store revision: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE stocks SET
+			company = $3, brokerage = $4, action = $5, rating_from = $6, rating_to = $7,
+			target_from = $8, target_to = $9, recommendation_score = $10,
+			action_raw = $11, rating_from_raw = $12, rating_to_raw = $13, target_currency = NULLIF($14, ''),
+			company_mismatch = $15,
+			ingest_seq = %s -- pushed again to /events/stream
+		WHERE ticker = $1 AND time = $2
+	`, nextSeq),
+		item.Ticker,
+		item.Time,
+		item.Company,
+		item.Brokerage,
+		item.Action,
+		item.RatingFrom,
+		item.RatingTo,
+		item.TargetFrom,
+		item.TargetTo,
+		item.RecommendationScore,
+		item.ActionRaw,
+		item.RatingFromRaw,
+		item.RatingToRaw,
+		item.TargetCurrency,
+		item.CompanyMismatch,
+	)
+	if err != nil {
+		return 0, nil, fmt.Errorf("update event: %w", err)
+	}
+	return loadUpdated, changes, nil
+}
+
+// diffStock returns the fields of received that differ from stored. Targets are
+// compared at the precision of the stocks table.
+func diffStock(stored, received models.Stock) []FieldChange {
+	var changes []FieldChange
+	text := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	target := func(field string, old, new models.Price) {
+		if old.Valid != new.Valid || (old.Valid && !old.Decimal.Round(4).Equal(new.Decimal.Round(4))) {
+			changes = append(changes, FieldChange{Field: field, Old: formatTarget(old), New: formatTarget(new)})
+		}
+	}
+
+	text("company", stored.Company, received.Company)
+	text("brokerage", stored.Brokerage, received.Brokerage)
+	text("action", stored.Action, received.Action)
+	text("rating_from", stored.RatingFrom, received.RatingFrom)
+	text("rating_to", stored.RatingTo, received.RatingTo)
+	target("target_from", stored.TargetFrom, received.TargetFrom)
+	target("target_to", stored.TargetTo, received.TargetTo)
+	text("target_currency", stored.TargetCurrency, received.TargetCurrency)
+	text("action_raw", stored.ActionRaw, received.ActionRaw)
+	text("rating_from_raw", stored.RatingFromRaw, received.RatingFromRaw)
+	text("rating_to_raw", stored.RatingToRaw, received.RatingToRaw)
+	return changes
+}
+
+func formatTarget(d models.Price) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Decimal.Round(4).String()
+}
@@ -0,0 +1,155 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/migrations"
+	"vue_go_cockroachdb/src/models"
+)
+
+func TestDiffStock(t *testing.T) {
+	target := func(s string) models.Price {
+		return models.Price{Decimal: decimal.RequireFromString(s), Valid: true}
+	}
+	stored := models.Stock{
+		Company:    "Akebia",
+		Brokerage:  "HC Wainwright",
+		Action:     models.ActionReiterated,
+		RatingFrom: "Buy",
+		RatingTo:   "Buy",
+		TargetFrom: target("4.0000"),
+		TargetTo:   target("4.1235"),
+	}
+
+	tests := []struct {
+		name     string
+		received func(s *models.Stock)
+		expected []FieldChange
+	}{
+		{"same values", func(s *models.Stock) {}, nil},
+		{"same target at the stored precision", func(s *models.Stock) { s.TargetTo = target("4.12349") }, nil},
+		{"corrected target", func(s *models.Stock) { s.TargetTo = target("4.5") },
+			[]FieldChange{{"target_to", "4.1235", "4.5"}}},
+		{"removed target", func(s *models.Stock) { s.TargetFrom = models.Price{} },
+			[]FieldChange{{"target_from", "4", ""}}},
+		{"fixed brokerage and rating", func(s *models.Stock) { s.Brokerage = "H.C. Wainwright"; s.RatingTo = "Neutral" },
+			[]FieldChange{{"brokerage", "HC Wainwright", "H.C. Wainwright"}, {"rating_to", "Buy", "Neutral"}}},
+	}
+
+	for _, tt := range tests {
+		received := stored
+		tt.received(&received)
+		if got := diffStock(stored, received); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: diffStock() = %v; want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ConflictPolicy
+		err      bool
+	}{
+		{"", ConflictIgnore, false},
+		{"ignore", ConflictIgnore, false},
+		{"overwrite", ConflictOverwrite, false},
+		{"revisions", ConflictRevisions, false},
+		{"Overwrite", "", true},
+		{"merge", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseConflictPolicy(tt.input)
+		if got != tt.expected || (err != nil) != tt.err {
+			t.Errorf("ParseConflictPolicy(%q) = %q, %v; want %q (error: %v)", tt.input, got, err, tt.expected, tt.err)
+		}
+	}
+}
+
+// openSQLite returns a migrated SQLite database in a temporary file.
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	db, err := app.GetDBConnection(ctx, "sqlite:"+filepath.Join(t.TempDir(), "stocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(ctx, db, 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLoadStockItemOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	item := models.StockWithScore{Stock: models.Stock{
+		Ticker:     "AKBA",
+		Company:    "Akebia",
+		Brokerage:  "HC Wainwright",
+		Action:     models.ActionReiterated,
+		RatingFrom: "Buy",
+		RatingTo:   "Buy",
+		TargetTo:   models.Price{Decimal: decimal.RequireFromString("4"), Valid: true},
+		Time:       time.Date(2025, 6, 3, 14, 0, 0, 0, time.FixedZone("EDT", -4*3600)),
+	}, RecommendationScore: 3}
+	inUTC, corrected := item, item
+	inUTC.Time = item.Time.UTC()
+	corrected.TargetTo.Decimal = decimal.RequireFromString("4.5")
+
+	tests := []struct {
+		name     string
+		item     models.StockWithScore
+		policy   ConflictPolicy
+		expected loadOutcome
+		changes  int
+	}{
+		{"new event", item, ConflictIgnore, loadInserted, 0},
+		{"same event in UTC", inUTC, ConflictIgnore, loadUnchanged, 0},
+		{"corrected target, ignored", corrected, ConflictIgnore, loadChanged, 1},
+		{"corrected target, with revision", corrected, ConflictRevisions, loadUpdated, 1},
+		{"corrected again", item, ConflictOverwrite, loadUpdated, 1},
+	}
+	for _, tt := range tests {
+		outcome, changes, err := loadStockItem(ctx, db, tt.item, tt.policy)
+		if err != nil || outcome != tt.expected || len(changes) != tt.changes {
+			t.Fatalf("%s: loadStockItem() = %d, %v, %v; want %d with %d changes", tt.name, outcome, changes, err, tt.expected, tt.changes)
+		}
+	}
+
+	var target, changedFields string
+	var seq int64
+	if err := db.QueryRowContext(ctx, `SELECT target_to, ingest_seq FROM stocks`).Scan(&target, &seq); err != nil {
+		t.Fatal(err)
+	}
+	if target != "4" || seq != 3 {
+		t.Errorf("stored target %s and ingest_seq %d; want 4 and 3 (inserted, then updated twice)", target, seq)
+	}
+	if err := db.QueryRowContext(ctx, `SELECT target_to || ' ' || changed_fields FROM stock_revisions`).Scan(&changedFields); err != nil {
+		t.Fatal(err)
+	}
+	if changedFields != `4 ["target_to"]` {
+		t.Errorf("revision = %s; want the target 4 and the changed fields [\"target_to\"]", changedFields)
+	}
+}
+
+func TestStatsKeepTheFirstChanges(t *testing.T) {
+	var s Stats
+	for i := 0; i < maxChanges+5; i++ {
+		s.addChange(Change{Ticker: "AKBA", Applied: i%2 == 0})
+	}
+	if s.Changed != maxChanges+5 || s.Updated != maxChanges/2+3 || len(s.Changes) != maxChanges {
+		t.Errorf("after %d changes: changed %d, updated %d, %d kept; want all counted and %d kept",
+			maxChanges+5, s.Changed, s.Updated, len(s.Changes), maxChanges)
+	}
+}
@@ -0,0 +1,277 @@
+// Package etl implements an ETL (Extract, Transform, Load) process for stock data.
+// It fetches stock recommendation data from an external API, transforms
+// the data into the required format, and loads it into a CockroachDB database.
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+	"vue_go_cockroachdb/src/logging"
+	"vue_go_cockroachdb/src/models"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	failedPhaseTransform = "TRANSFORM"
+	failedPhaseLoad      = "LOAD" // insert in ETL terminology
+)
+
+// Config holds the settings of an ETL run.
+type Config struct {
+	APIURL    string
+	AuthToken string
+
+	// Conflict decides what happens to events received again with other values.
+	// Empty means ConflictIgnore.
+	Conflict ConflictPolicy
+
+	// CompaniesFile, if set, is a CSV file loaded into the companies table before the
+	// run (see LoadCompanies).
+	CompaniesFile string
+
+	// Progress, if not nil, is reset and updated during the run.
+	Progress *Progress
+
+	// Metrics, if not nil, are updated during the run.
+	Metrics *Metrics
+
+	// Hooks are called at the end of the run, in order, with the events it inserted.
+	Hooks []Hook
+}
+
+// Hook is called at the end of a run with the events it inserted, also when the run
+// stopped early. Its errors are logged and don't fail the run. Events that the run
+// updates under ConflictOverwrite or ConflictRevisions aren't passed: alert rules and
+// webhooks only see new events, and an event fires them once even if it changes later.
+type Hook func(ctx context.Context, inserted []models.StockWithScore) error
+
+// Run executes the ETL process: it fetches paginated stock data from the external API,
+// transforms each item, and inserts it into the database. Items that fail in the
+// transform or load phases are stored in the "failed_items" table and don't stop the run.
+// Events already stored with other values are handled by cfg.Conflict and listed in
+// the Changes of the returned Stats. Events whose company isn't the canonical name of
+// their ticker in the companies table are flagged (company_mismatch). A run that
+// inserts or updates events bumps the data version (see BumpDataVersion).
+func Run(ctx context.Context, db *sql.DB, cfg Config) (stats Stats, err error) {
+	stats = Stats{StartedAt: time.Now().UTC()}
+	ctx, stats.RunID = logging.WithRunID(ctx)
+	defer func() { cfg.Metrics.runFinished(stats.StartedAt, err) }()
+	report := func(fn func(s *Stats)) {
+		fn(&stats)
+		cfg.Progress.update(func(s *Stats) { *s = stats })
+	}
+	report(func(*Stats) {})
+
+	policy := cfg.Conflict
+	if policy == "" {
+		policy = ConflictIgnore
+	}
+
+	var inserted []models.StockWithScore
+	defer func() {
+		for _, hook := range cfg.Hooks {
+			if err := hook(ctx, inserted); err != nil {
+				slog.ErrorContext(ctx, "ETL hook failed", "error", err)
+			}
+		}
+	}()
+	defer func() { bumpDataVersion(ctx, db, stats.Loaded+stats.Updated > 0) }()
+
+	if cfg.CompaniesFile != "" {
+		load, err := LoadCompanies(ctx, db, cfg.CompaniesFile)
+		if err != nil {
+			return stats, fmt.Errorf("load companies: %w", err)
+		}
+		slog.InfoContext(ctx, "Companies loaded", "companies", load.Companies, "mismatches", load.Mismatches)
+	}
+
+	normalizer := loadNormalizer(ctx, db)
+	companies := loadCompanyNames(ctx, db)
+	client := resty.New()
+
+	nextPage := ""
+	for {
+		resp, err := client.R().
+			SetContext(ctx).
+			SetHeader("Authorization", cfg.AuthToken).
+			SetHeader("Content-Type", "application/json").
+			SetQueryParam("next_page", nextPage).
+			SetResult(&APIResponse{}).
+			Get(cfg.APIURL)
+
+		if err != nil {
+			return stats, fmt.Errorf("API request failed: %w", err)
+		}
+		if resp.IsError() {
+			return stats, fmt.Errorf("API request failed with status %s", resp.Status())
+		}
+
+		apiResp := resp.Result().(*APIResponse)
+		report(func(s *Stats) {
+			s.Pages++
+			s.Fetched += len(apiResp.Items)
+		})
+		cfg.Metrics.page()
+
+		for _, raw := range apiResp.Items {
+			item, err := transform(raw, normalizer)
+			if err != nil {
+				slog.WarnContext(ctx, "Skipping item due to error", "ticker", raw.Ticker, "error", err)
+				if err := insertFailedItem(ctx, db, raw, err, failedPhaseTransform, itemSource{}); err != nil {
+					slog.ErrorContext(ctx, "Failed to insert failed item", "error", err)
+				}
+				report(func(s *Stats) { s.Failed++ })
+				cfg.Metrics.itemFailed(failedPhaseTransform)
+				continue
+			}
+			cfg.Metrics.itemTransformed()
+			if item.CompanyMismatch = companies.mismatch(item.Ticker, item.Company); item.CompanyMismatch {
+				report(func(s *Stats) { s.CompanyMismatches++ })
+			}
+			outcome, fields, err := loadStockItem(ctx, db, item, policy)
+			if err != nil {
+				slog.ErrorContext(ctx, "Insert error", "ticker", item.Ticker, "error", err)
+				if err := insertFailedItem(ctx, db, raw, err, failedPhaseLoad, itemSource{}); err != nil {
+					slog.ErrorContext(ctx, "Failed to insert good item", "error", err)
+				}
+				report(func(s *Stats) { s.Failed++ })
+				cfg.Metrics.itemFailed(failedPhaseLoad)
+				continue
+			}
+			report(func(s *Stats) {
+				switch outcome {
+				case loadInserted:
+					s.Loaded++
+					inserted = append(inserted, item)
+				case loadUnchanged:
+					s.Duplicates++
+				case loadChanged, loadUpdated:
+					change := Change{Ticker: item.Ticker, Time: item.Time, Fields: fields, Applied: outcome == loadUpdated}
+					slog.InfoContext(ctx, "Event changed", "change", change.String())
+					s.addChange(change)
+				}
+			})
+		}
+
+		if apiResp.NextPage == "" {
+			return stats, nil
+		}
+		nextPage = apiResp.NextPage
+	}
+}
+
+// loadNormalizer returns a Normalizer with the aliases stored in the database. Aliases
+// that can't be loaded are logged and skipped.
+func loadNormalizer(ctx context.Context, db *sql.DB) *Normalizer {
+	normalizer := NewNormalizer()
+	invalidAliases, err := loadAliases(ctx, db, normalizer)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not load normalization aliases, using defaults only", "error", err)
+	}
+	for _, err := range invalidAliases {
+		slog.WarnContext(ctx, "Ignoring invalid normalization alias", "error", err)
+	}
+	return normalizer
+}
+
+// transform converts a raw API item into a StockItem struct,
+// parsing prices (see parsePrice) and timestamps as needed. Ratings and action are mapped
+// to their canonical values with n, keeping the raw values for auditing.
+func transform(raw APIRawItem, n *Normalizer) (models.StockWithScore, error) {
+	if raw.Ticker == "" {
+		return models.StockWithScore{}, fmt.Errorf("ticker is required but was empty")
+	}
+	if raw.Time == "" {
+		return models.StockWithScore{}, fmt.Errorf("time is required but was empty for ticker '%s'", raw.Ticker)
+	}
+
+	// NOTE: there are registers that have an empty rating_from or rating_to the decision is to ignore them
+	// because they are could be considered as "not rated" or "no recommendation" and bias the results.
+	ratingFrom, ok := n.Rating(raw.RatingFrom)
+	if !ok {
+		return models.StockWithScore{}, fmt.Errorf("invalid rating_from value '%s' for ticker '%s'", raw.RatingFrom, raw.Ticker)
+	}
+	ratingTo, ok := n.Rating(raw.RatingTo)
+	if !ok {
+		return models.StockWithScore{}, fmt.Errorf("invalid rating_to value '%s' for ticker '%s'", raw.RatingTo, raw.Ticker)
+	}
+
+	eventTime, err := time.Parse(time.RFC3339Nano, raw.Time)
+	if err != nil {
+		return models.StockWithScore{}, fmt.Errorf("invalid time value '%s' for ticker '%s': %v", raw.Time, raw.Ticker, err)
+	}
+
+	targetFrom, hasTargetFrom, err := parsePrice(raw.TargetFrom)
+	if err != nil {
+		return models.StockWithScore{}, fmt.Errorf("invalid target_from value '%s' for ticker '%s': %v", raw.TargetFrom, raw.Ticker, err)
+	}
+	targetTo, hasTargetTo, err := parsePrice(raw.TargetTo)
+	if err != nil {
+		return models.StockWithScore{}, fmt.Errorf("invalid target_to value '%s' for ticker '%s': %v", raw.TargetTo, raw.Ticker, err)
+	}
+	if targetFrom.Currency != "" && targetTo.Currency != "" && targetFrom.Currency != targetTo.Currency {
+		return models.StockWithScore{}, fmt.Errorf("target_from currency %s differs from target_to currency %s for ticker '%s'", targetFrom.Currency, targetTo.Currency, raw.Ticker)
+	}
+	currency := targetFrom.Currency
+	if currency == "" {
+		currency = targetTo.Currency
+	}
+
+	stockStruct := models.Stock{
+		Ticker:     raw.Ticker,
+		Company:    raw.Company,
+		Brokerage:  raw.Brokerage,
+		Action:     n.Action(raw.Action),
+		RatingFrom: ratingFrom,
+		RatingTo:   ratingTo,
+		TargetFrom: models.Price{Decimal: targetFrom.Amount, Valid: hasTargetFrom},
+		TargetTo:   models.Price{Decimal: targetTo.Amount, Valid: hasTargetTo},
+		Time:       eventTime.UTC(),
+
+		TargetCurrency: currency,
+
+		ActionRaw:     raw.Action,
+		RatingFromRaw: raw.RatingFrom,
+		RatingToRaw:   raw.RatingTo,
+	}
+
+	score := CalculateStockScore(stockStruct)
+
+	// assign the score to a new struct that includes the stock and the score
+	var stockStructWithScore models.StockWithScore
+	stockStructWithScore.Stock = stockStruct
+	stockStructWithScore.RecommendationScore = score
+	return stockStructWithScore, nil
+}
+
+// itemSource is the line of an imported file an item comes from; the zero value is an
+// item of the external API.
+type itemSource struct {
+	File string
+	Line int
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertFailedItem inserts a the raw json of the failed item into the "failed_items" table in the db
+// failed_at_phase indicates the phase of the ETL process where the failure occurred, can be "transform" or "insert".
+// raw is usually an APIRawItem, which RetryFailedItems can transform again.
+func insertFailedItem(ctx context.Context, db execer, raw any, parseErr error, failed_at_phase string, source itemSource) error {
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+        INSERT INTO failed_items (raw_json, error_message, failed_at_phase, source_file, source_line)
+        VALUES ($1, $2,$3, NULLIF($4, ''), NULLIF($5, 0))
+    `, string(rawJSON), parseErr.Error(), failed_at_phase, source.File, source.Line)
+	return err
+}
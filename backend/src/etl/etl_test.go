@@ -0,0 +1,32 @@
+package etl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransformParsesTime(t *testing.T) {
+	raw := APIRawItem{
+		Ticker:     "MOMO",
+		Action:     "reiterated by",
+		RatingFrom: "Buy",
+		RatingTo:   "Buy",
+		TargetFrom: "$13.00",
+		TargetTo:   "$13.00",
+		Time:       "2025-03-14T00:30:05.974622332-05:00",
+	}
+
+	item, err := transform(raw, NewNormalizer())
+	if err != nil {
+		t.Fatalf("transform returned unexpected error: %v", err)
+	}
+	want := time.Date(2025, 3, 14, 5, 30, 5, 974622332, time.UTC)
+	if !item.Time.Equal(want) || item.Time.Location() != time.UTC {
+		t.Errorf("transform time = %v; want %v", item.Time, want)
+	}
+
+	raw.Time = "14/03/2025"
+	if _, err := transform(raw, NewNormalizer()); err == nil {
+		t.Error("transform accepted an invalid time")
+	}
+}
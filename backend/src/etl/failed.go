@@ -0,0 +1,155 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/logging"
+	"vue_go_cockroachdb/src/models"
+)
+
+// FailedItem is an item that failed in the transform or load phase (failed_items table).
+type FailedItem struct {
+	ID        int64           `json:"id,string"` // a unique_rowid(), too big for JavaScript numbers
+	RawJSON   json.RawMessage `json:"raw_json"`
+	Error     string          `json:"error_message"`
+	Phase     string          `json:"failed_at_phase"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	// SourceFile and SourceLine locate the items of the import command in their file.
+	SourceFile string `json:"source_file,omitempty"`
+	SourceLine int    `json:"source_line,omitempty"`
+}
+
+// ListFailedItems returns up to limit failed items, newest first.
+func ListFailedItems(ctx context.Context, db *sql.DB, limit int) ([]FailedItem, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, raw_json, error_message, failed_at_phase, created_at,
+		       COALESCE(source_file, ''), COALESCE(source_line, 0)
+		FROM failed_items
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []FailedItem{}
+	for rows.Next() {
+		var f FailedItem
+		var raw []byte
+		if err := rows.Scan(&f.ID, &raw, &f.Error, &f.Phase, &f.CreatedAt, &f.SourceFile, &f.SourceLine); err != nil {
+			return nil, err
+		}
+		f.RawJSON = raw
+		items = append(items, f)
+	}
+	return items, rows.Err()
+}
+
+// RetryFailedItems transforms and loads again the failed items ids, or every failed
+// item if ids is empty, with the current normalization aliases and cfg.Conflict. Items
+// that load are removed from failed_items; the others keep their row with the new
+// error. cfg.Hooks are called with the inserted events. In the returned Stats, Fetched
+// is the number of items retried.
+func RetryFailedItems(ctx context.Context, db *sql.DB, cfg Config, ids []int64) (Stats, error) {
+	stats := Stats{StartedAt: time.Now().UTC()}
+	ctx, stats.RunID = logging.WithRunID(ctx)
+	policy := cfg.Conflict
+	if policy == "" {
+		policy = ConflictIgnore
+	}
+
+	where := "TRUE"
+	var args []any
+	if len(ids) > 0 {
+		// a list of parameters, as SQLite has no arrays
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			args = append(args, id)
+		}
+		where = "id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, raw_json FROM failed_items WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return stats, err
+	}
+	type failed struct {
+		id  int64
+		raw []byte
+	}
+	var items []failed
+	for rows.Next() {
+		var f failed
+		if err := rows.Scan(&f.id, &f.raw); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		items = append(items, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	var inserted []models.StockWithScore
+	defer func() {
+		for _, hook := range cfg.Hooks {
+			if err := hook(ctx, inserted); err != nil {
+				slog.ErrorContext(ctx, "ETL hook failed", "error", err)
+			}
+		}
+	}()
+	defer func() { bumpDataVersion(ctx, db, stats.Loaded+stats.Updated > 0) }()
+
+	normalizer := loadNormalizer(ctx, db)
+	companies := loadCompanyNames(ctx, db)
+	for _, f := range items {
+		stats.Fetched++
+
+		var raw APIRawItem
+		err := json.Unmarshal(f.raw, &raw)
+		phase := failedPhaseTransform
+		var item models.StockWithScore
+		if err == nil {
+			item, err = transform(raw, normalizer)
+		}
+		var outcome loadOutcome
+		var fields []FieldChange
+		if err == nil {
+			phase = failedPhaseLoad
+			if item.CompanyMismatch = companies.mismatch(item.Ticker, item.Company); item.CompanyMismatch {
+				stats.CompanyMismatches++
+			}
+			outcome, fields, err = loadStockItem(ctx, db, item, policy)
+		}
+		if err != nil {
+			stats.Failed++
+			if _, dbErr := db.ExecContext(ctx, `UPDATE failed_items SET error_message = $2, failed_at_phase = $3 WHERE id = $1`,
+				f.id, err.Error(), phase); dbErr != nil {
+				return stats, fmt.Errorf("update failed item %d: %w", f.id, dbErr)
+			}
+			continue
+		}
+
+		switch outcome {
+		case loadInserted:
+			stats.Loaded++
+			inserted = append(inserted, item)
+		case loadUnchanged:
+			stats.Duplicates++
+		case loadChanged, loadUpdated:
+			stats.addChange(Change{Ticker: item.Ticker, Time: item.Time, Fields: fields, Applied: outcome == loadUpdated})
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM failed_items WHERE id = $1`, f.id); err != nil {
+			return stats, fmt.Errorf("delete failed item %d: %w", f.id, err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,58 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRetryFailedItemsOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	items := []APIRawItem{
+		{Ticker: "AKBA", Company: "Akebia", Brokerage: "HC Wainwright", Action: "reiterated by",
+			RatingFrom: "Buy", RatingTo: "Buy", TargetFrom: "$4.00", TargetTo: "$4.00", Time: "2025-06-03T14:00:00Z"},
+		{Ticker: "MOMO", Company: "Hello Group", Action: "upgraded by", Time: "yesterday"},
+		{Ticker: "CECO", Company: "CECO Environmental", Brokerage: "Needham", Action: "target raised by",
+			RatingFrom: "Buy", RatingTo: "Buy", TargetFrom: "$30.00", TargetTo: "$33.00", Time: "2025-06-03T15:00:00Z"},
+	}
+	for _, raw := range items {
+		if err := insertFailedItem(ctx, db, raw, errors.New("timeout"), failedPhaseLoad, itemSource{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := ListFailedItems(ctx, db, 10)
+	if err != nil || len(failed) != 3 {
+		t.Fatalf("ListFailedItems() = %v, %v; want 3 items", failed, err)
+	}
+	ids := make([]int64, 0, 2)
+	for _, f := range failed {
+		if f.CreatedAt.IsZero() {
+			t.Errorf("failed item %d has no creation time", f.ID)
+		}
+		if f.ID != failed[0].ID { // every item but the newest, CECO
+			ids = append(ids, f.ID)
+		}
+	}
+
+	stats, err := RetryFailedItems(ctx, db, Config{}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Fetched != 2 || stats.Loaded != 1 || stats.Failed != 1 {
+		t.Errorf("RetryFailedItems() = fetched %d, loaded %d, failed %d; want 2, 1, 1", stats.Fetched, stats.Loaded, stats.Failed)
+	}
+
+	remaining, err := ListFailedItems(ctx, db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var phases []string
+	for _, f := range remaining {
+		phases = append(phases, f.Phase)
+	}
+	if len(remaining) != 2 || phases[0] != failedPhaseLoad || phases[1] != failedPhaseTransform {
+		t.Errorf("remaining failed items in phases %v; want CECO (load) and MOMO (transform)", phases)
+	}
+}
@@ -0,0 +1,596 @@
+package etl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/logging"
+	"vue_go_cockroachdb/src/models"
+)
+
+// Formats of the files of Import.
+const (
+	ImportCSV   = "csv"
+	ImportJSONL = "jsonl"
+)
+
+// DefaultImportBatch is the number of records an Import loads per transaction when its
+// config doesn't set one.
+const DefaultImportBatch = 500
+
+// importFields are the fields of APIRawItem, which an ImportMapping maps to columns.
+var importFields = []string{"ticker", "company", "brokerage", "action", "rating_from", "rating_to", "target_from", "target_to", "time"}
+
+// ImportMapping maps the columns of an imported file to the fields of the items of the
+// external API, so its records go through the same transform as the ETL.
+//
+// Example mapping file:
+//
+//	{
+//	  "columns": {"ticker": "Symbol", "brokerage": "Firm", "rating_to": "To Grade", "time": "Date"},
+//	  "time_layout": "2006-01-02",
+//	  "delimiter": ";"
+//	}
+type ImportMapping struct {
+	// Columns maps fields of APIRawItem (ticker, company, brokerage, action, rating_from,
+	// rating_to, target_from, target_to and time) to the column of the file with them, a
+	// CSV header or a JSON key. The fields missing from it are read from the column of
+	// their name.
+	Columns map[string]string `json:"columns"`
+	// TimeLayout is the Go layout of the times of the file, e.g. "2006-01-02"; times
+	// without a zone are UTC. Empty means RFC 3339, as the external API sends them.
+	TimeLayout string `json:"time_layout"`
+	// Delimiter separates the fields of a CSV file, a comma if empty.
+	Delimiter string `json:"delimiter"`
+}
+
+// ReadImportMapping reads an ImportMapping from a JSON file.
+func ReadImportMapping(path string) (ImportMapping, error) {
+	var m ImportMapping
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m ImportMapping) validate() error {
+	for field, column := range m.Columns {
+		if !slices.Contains(importFields, field) {
+			return fmt.Errorf("unknown field %q in the columns, expected one of %s", field, strings.Join(importFields, ", "))
+		}
+		if strings.TrimSpace(column) == "" {
+			return fmt.Errorf("the column of %s is empty", field)
+		}
+	}
+	if m.Delimiter != "" && utf8.RuneCountInString(m.Delimiter) != 1 {
+		return fmt.Errorf("the delimiter %q isn't a single character", m.Delimiter)
+	}
+	return nil
+}
+
+// column returns the column of field.
+func (m ImportMapping) column(field string) string {
+	if column, ok := m.Columns[field]; ok {
+		return column
+	}
+	return field
+}
+
+// item returns the item of a record, given its values by column. A time that doesn't
+// match the TimeLayout is an error, as a failed transform.
+func (m ImportMapping) item(values map[string]string) (APIRawItem, error) {
+	get := func(field string) string { return strings.TrimSpace(values[m.column(field)]) }
+	raw := APIRawItem{
+		Ticker:     get("ticker"),
+		Company:    get("company"),
+		Brokerage:  get("brokerage"),
+		Action:     get("action"),
+		RatingFrom: get("rating_from"),
+		RatingTo:   get("rating_to"),
+		TargetFrom: get("target_from"),
+		TargetTo:   get("target_to"),
+		Time:       get("time"),
+	}
+	if m.TimeLayout != "" && raw.Time != "" {
+		t, err := time.Parse(m.TimeLayout, raw.Time)
+		if err != nil {
+			return raw, fmt.Errorf("invalid time value '%s' for ticker '%s': %v", raw.Time, raw.Ticker, err)
+		}
+		raw.Time = t.UTC().Format(time.RFC3339Nano)
+	}
+	return raw, nil
+}
+
+// ImportFormatOf returns the format of a file by its extension: .csv, or .jsonl and
+// .ndjson for JSON Lines.
+func ImportFormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ImportCSV, nil
+	case ".jsonl", ".ndjson":
+		return ImportJSONL, nil
+	}
+	return "", fmt.Errorf("unknown format of %s, expected a .csv, .jsonl or .ndjson file", path)
+}
+
+// ImportConfig holds the settings of an Import.
+type ImportConfig struct {
+	Mapping ImportMapping
+	// Format is ImportCSV or ImportJSONL; empty picks it by the extension of the file
+	// (see ImportFormatOf).
+	Format string
+	// BatchSize is the number of records loaded per transaction; 0 means
+	// DefaultImportBatch.
+	BatchSize int
+	// Conflict decides what happens to events already stored with other values. Empty
+	// means ConflictIgnore.
+	Conflict ConflictPolicy
+	// Restart imports the file from its first line even if an import of it stopped
+	// before its end or finished.
+	Restart bool
+}
+
+// ImportStats summarizes an Import. Fetched is the number of records read, without the
+// ones skipped to resume, and Pages the number of batches loaded.
+type ImportStats struct {
+	Stats
+	ResumedAfter int `json:"resumed_after"` // line the import resumed after, 0 for the start
+	Line         int `json:"line"`          // last line loaded
+}
+
+var (
+	// ErrAlreadyImported is returned by Import for a file it already imported whole.
+	ErrAlreadyImported = errors.New("already imported")
+	// ErrImportConflict is returned by Import when another import of the same file,
+	// running at the same time, stored its progress.
+	ErrImportConflict = errors.New("another import of the file is running")
+)
+
+// Import loads the historical events of the CSV or JSON Lines file at path. Its
+// records are mapped to items of the external API with cfg.Mapping, go through the
+// same transform and scoring as the ETL and are loaded, cfg.BatchSize at a time, with
+// cfg.Conflict. Records that fail are sent to failed_items with the file and their line.
+//
+// The progress of the import is stored with each batch in the import_progress table,
+// so an import that stops resumes after its last loaded batch, unless the file changed
+// (its size or first MiB) or cfg.Restart is set; a file already imported whole returns
+// ErrAlreadyImported. The batches lock the progress of the import and check that it
+// didn't move, so a second import of the file running at the same time fails with
+// ErrImportConflict. Like RetryFailedItems, Import doesn't call the hooks of the ETL:
+// historical events don't trigger alerts nor webhooks.
+func Import(ctx context.Context, db *sql.DB, path string, cfg ImportConfig) (ImportStats, error) {
+	stats := ImportStats{Stats: Stats{StartedAt: time.Now().UTC()}}
+	ctx, stats.RunID = logging.WithRunID(ctx)
+	if err := cfg.Mapping.validate(); err != nil {
+		return stats, err
+	}
+	format := cfg.Format
+	if format == "" {
+		var err error
+		if format, err = ImportFormatOf(path); err != nil {
+			return stats, err
+		}
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatch
+	}
+	policy := cfg.Conflict
+	if policy == "" {
+		policy = ConflictIgnore
+	}
+
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return stats, err
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	fingerprint, err := fileFingerprint(f)
+	if err != nil {
+		return stats, err
+	}
+	if stats.ResumedAfter, err = startImport(ctx, db, source, fingerprint, cfg.Restart); err != nil {
+		return stats, err
+	}
+	stats.Line = stats.ResumedAfter
+
+	var next func() (int, map[string]string, error)
+	switch format {
+	case ImportCSV:
+		next, err = csvRecords(f, cfg.Mapping)
+	case ImportJSONL:
+		next = jsonlRecords(f)
+	default:
+		err = fmt.Errorf("unknown import format %q, expected csv or jsonl", format)
+	}
+	if err != nil {
+		return stats, fmt.Errorf("%s: %w", source, err)
+	}
+
+	defer func() { bumpDataVersion(ctx, db, stats.Loaded+stats.Updated > 0) }()
+	if stats.ResumedAfter > 0 {
+		slog.InfoContext(ctx, "Resuming the import", "file", source, "after_line", stats.ResumedAfter)
+	}
+	l := &importLoader{db: db, dialect: app.DialectOf(db), source: source, mapping: cfg.Mapping, policy: policy,
+		normalizer: loadNormalizer(ctx, db), companies: loadCompanyNames(ctx, db), line: stats.ResumedAfter}
+	var batch []importRecord
+	for {
+		line, values, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", source, err)
+		}
+		if line <= stats.ResumedAfter {
+			continue
+		}
+		stats.Fetched++
+		batch = append(batch, l.transform(line, values))
+		if len(batch) == batchSize {
+			if err := l.load(ctx, batch, &stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := l.load(ctx, batch, &stats); err != nil {
+		return stats, err
+	}
+	return stats, l.inTx(ctx, l.line, func(tx *sql.Tx) (int, int, error) {
+		_, err := tx.ExecContext(ctx, `UPDATE import_progress SET done = true WHERE source = $1`, source)
+		return 0, 0, err
+	})
+}
+
+// fileFingerprint identifies the content of f by its size and the hash of its first
+// MiB, cheap even for large files. f is left at its start.
+func fileFingerprint(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, 1<<20); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%s", info.Size(), hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// startImport records the start of the import of source and returns the line to resume
+// after: the last one loaded by a previous import of the same content that stopped.
+func startImport(ctx context.Context, db *sql.DB, source, fingerprint string, restart bool) (int, error) {
+	var stored string
+	var line int
+	var done bool
+	err := db.QueryRowContext(ctx, `SELECT fingerprint, line, done FROM import_progress WHERE source = $1`, source).
+		Scan(&stored, &line, &done)
+	switch {
+	case err == nil && !restart && stored != fingerprint:
+		return 0, fmt.Errorf("%s changed since its import stopped at line %d, restart the import to load it again", source, line)
+	case err == nil && !restart && done:
+		return 0, fmt.Errorf("%s: %w", source, ErrAlreadyImported)
+	case err == nil && !restart:
+		return line, nil
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO import_progress (source, fingerprint, line, loaded, failed, done, updated_at)
+		VALUES ($1, $2, 0, 0, 0, false, $3)
+		ON CONFLICT (source) DO UPDATE SET
+			fingerprint = excluded.fingerprint, line = 0, loaded = 0, failed = 0, done = false,
+			updated_at = excluded.updated_at
+	`, source, fingerprint, time.Now().UTC())
+	return 0, err
+}
+
+// csvRecords returns a function reading the records of a CSV file with a header, by
+// column, and their line; io.EOF ends them. The columns of the ticker and time, and
+// every column named by the mapping, must be in the header.
+func csvRecords(r io.Reader, m ImportMapping) (func() (int, map[string]string, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // missing fields are empty
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+	if m.Delimiter != "" {
+		cr.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	}
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty file, the header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	for _, field := range importFields {
+		_, mapped := m.Columns[field]
+		if (mapped || field == "ticker" || field == "time") && !slices.Contains(header, m.column(field)) {
+			return nil, fmt.Errorf("the header has no %q column for the %s", m.column(field), field)
+		}
+	}
+
+	return func() (int, map[string]string, error) {
+		for {
+			record, err := cr.Read()
+			if err != nil {
+				return 0, nil, err
+			}
+			line, _ := cr.FieldPos(0)
+			if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+				continue // blank line
+			}
+			values := make(map[string]string, len(header))
+			for i, value := range record {
+				if i < len(header) {
+					values[header[i]] = value
+				}
+			}
+			return line, values, nil
+		}
+	}, nil
+}
+
+// jsonlRecords returns a function reading the objects of a JSON Lines file, by key, and
+// their line; io.EOF ends them. Numbers and booleans are read as their text, null as
+// empty. A line that isn't an object of such values returns its text under the key
+// "", for the record to fail.
+func jsonlRecords(r io.Reader) func() (int, map[string]string, error) {
+	br := bufio.NewReader(r)
+	line := 0
+	return func() (int, map[string]string, error) {
+		for {
+			text, err := br.ReadBytes('\n')
+			if len(text) == 0 && err != nil {
+				return 0, nil, err
+			}
+			line++
+			text = bytes.TrimSpace(text)
+			if len(text) == 0 {
+				continue
+			}
+			var object map[string]any
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.UseNumber()
+			if err := dec.Decode(&object); err != nil || object == nil {
+				return line, map[string]string{"": string(text)}, nil
+			}
+			values := make(map[string]string, len(object))
+			for key, v := range object {
+				switch v := v.(type) {
+				case nil:
+					values[key] = ""
+				case string:
+					values[key] = v
+				case json.Number:
+					values[key] = v.String()
+				case bool:
+					values[key] = strconv.FormatBool(v)
+				default:
+					return line, map[string]string{"": string(text)}, nil
+				}
+			}
+			return line, values, nil
+		}
+	}
+}
+
+// importRecord is a record of an imported file, transformed.
+type importRecord struct {
+	line int
+	raw  any // the APIRawItem, or the text of a line that isn't a record
+	item models.StockWithScore
+	err  error // of the transform
+}
+
+// importLoader transforms and loads the records of an imported file.
+type importLoader struct {
+	db         *sql.DB
+	dialect    app.Dialect
+	source     string
+	mapping    ImportMapping
+	policy     ConflictPolicy
+	normalizer *Normalizer
+	companies  companyNames
+	line       int // last line of the progress stored by this import
+}
+
+func (l *importLoader) transform(line int, values map[string]string) importRecord {
+	if text, ok := values[""]; ok && len(values) == 1 {
+		return importRecord{line: line, raw: text, err: errors.New("the line isn't a JSON object of strings and numbers")}
+	}
+	rec := importRecord{line: line}
+	raw, err := l.mapping.item(values)
+	rec.raw = raw
+	if err == nil {
+		rec.item, err = transform(raw, l.normalizer)
+	}
+	if err == nil {
+		rec.item.CompanyMismatch = l.companies.mismatch(rec.item.Ticker, rec.item.Company)
+	}
+	rec.err = err
+	return rec
+}
+
+// load loads a batch of records and stores the progress of the import in one
+// transaction, sending the records that fail to failed_items. If the transaction
+// fails, the records are loaded one at a time (see loadEach), so only the ones that
+// fail are sent.
+func (l *importLoader) load(ctx context.Context, batch []importRecord, stats *ImportStats) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	last := batch[len(batch)-1].line
+	s := stats.Stats
+	err := l.loadTx(ctx, batch, &s)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrImportConflict) {
+			return err
+		}
+		slog.WarnContext(ctx, "Loading the batch one record at a time", "file", l.source, "line", last, "error", err)
+		s = stats.Stats
+		if err := l.loadEach(ctx, batch, &s); err != nil {
+			return err
+		}
+	}
+	s.Pages++
+	stats.Stats, stats.Line = s, last
+	slog.InfoContext(ctx, "Batch imported", "file", l.source, "line", last, "loaded", s.Loaded, "failed", s.Failed)
+	return nil
+}
+
+func (l *importLoader) loadTx(ctx context.Context, batch []importRecord, s *Stats) error {
+	return l.inTx(ctx, batch[len(batch)-1].line, func(tx *sql.Tx) (int, int, error) {
+		loaded, failed := s.Loaded, s.Failed
+		for _, rec := range batch {
+			if rec.err != nil {
+				if err := insertFailedItem(ctx, tx, rec.raw, rec.err, failedPhaseTransform, itemSource{l.source, rec.line}); err != nil {
+					return 0, 0, err
+				}
+				s.Failed++
+				continue
+			}
+			outcome, fields, err := loadStockItemTx(ctx, tx, l.dialect, rec.item, l.policy)
+			if err != nil {
+				return 0, 0, fmt.Errorf("line %d: %w", rec.line, err)
+			}
+			countLoad(s, rec.item, outcome, fields)
+		}
+		return s.Loaded - loaded, s.Failed - failed, nil
+	})
+}
+
+// loadEach loads the records of batch one at a time, each in a transaction storing the
+// progress up to its line, so an import that stops midway doesn't send the failed
+// records again when it resumes.
+func (l *importLoader) loadEach(ctx context.Context, batch []importRecord, s *Stats) error {
+	for _, rec := range batch {
+		phase, err := failedPhaseTransform, rec.err
+		if err == nil {
+			var outcome loadOutcome
+			var fields []FieldChange
+			phase = failedPhaseLoad
+			err = l.inTx(ctx, rec.line, func(tx *sql.Tx) (int, int, error) {
+				var err error
+				if outcome, fields, err = loadStockItemTx(ctx, tx, l.dialect, rec.item, l.policy); err != nil || outcome != loadInserted {
+					return 0, 0, err
+				}
+				return 1, 0, nil
+			})
+			if err == nil {
+				countLoad(s, rec.item, outcome, fields)
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrImportConflict) {
+			return err
+		}
+		err = l.inTx(ctx, rec.line, func(tx *sql.Tx) (int, int, error) {
+			return 0, 1, insertFailedItem(ctx, tx, rec.raw, err, phase, itemSource{l.source, rec.line})
+		})
+		if err != nil {
+			return fmt.Errorf("store the failed item of line %d: %w", rec.line, err)
+		}
+		s.Failed++
+	}
+	return nil
+}
+
+// inTx runs load in a transaction that also moves the progress of the import to line,
+// adding the records load returns as loaded and failed. The transaction first locks
+// the progress of the import and checks that it's still at the line this import last
+// stored: otherwise another import of the file is running, and it fails with
+// ErrImportConflict.
+func (l *importLoader) inTx(ctx context.Context, line int, load func(tx *sql.Tx) (loaded, failed int, err error)) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lock := " FOR UPDATE"
+	if l.dialect == app.SQLite {
+		lock = "" // its transactions lock the whole database
+	}
+	var stored int
+	if err := tx.QueryRowContext(ctx, `SELECT line FROM import_progress WHERE source = $1`+lock, l.source).Scan(&stored); err != nil {
+		return fmt.Errorf("lock the progress of the import: %w", err)
+	}
+	if stored != l.line {
+		return fmt.Errorf("%s is at line %d instead of %d: %w", l.source, stored, l.line, ErrImportConflict)
+	}
+
+	loaded, failed, err := load(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE import_progress SET line = $2, loaded = loaded + $3, failed = failed + $4, updated_at = $5
+		WHERE source = $1`, l.source, line, loaded, failed, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	l.line = line
+	return nil
+}
+
+// countLoad adds a loaded item to s.
+func countLoad(s *Stats, item models.StockWithScore, outcome loadOutcome, fields []FieldChange) {
+	if item.CompanyMismatch {
+		s.CompanyMismatches++
+	}
+	switch outcome {
+	case loadInserted:
+		s.Loaded++
+	case loadUnchanged:
+		s.Duplicates++
+	case loadChanged, loadUpdated:
+		s.addChange(Change{Ticker: item.Ticker, Time: item.Time, Fields: fields, Applied: outcome == loadUpdated})
+	}
+}
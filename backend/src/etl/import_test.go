@@ -0,0 +1,195 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vue_go_cockroachdb/src/app"
+)
+
+func writeImportFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportMapping(t *testing.T) {
+	m := ImportMapping{Columns: map[string]string{"ticker": "Symbol", "time": "Date"}, TimeLayout: "02/01/2006"}
+	raw, err := m.item(map[string]string{"Symbol": " AKBA ", "Date": "03/06/2025", "brokerage": "HC Wainwright"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Ticker != "AKBA" || raw.Brokerage != "HC Wainwright" || raw.Time != "2025-06-03T00:00:00Z" {
+		t.Errorf("item() = %+v; want the mapped and default columns, with the time in RFC 3339", raw)
+	}
+	if _, err := m.item(map[string]string{"Symbol": "AKBA", "Date": "2025-06-03"}); err == nil {
+		t.Error("item() of a time not matching the layout succeeded; want an error")
+	}
+
+	for _, bad := range []ImportMapping{
+		{Columns: map[string]string{"symbol": "Symbol"}},
+		{Columns: map[string]string{"ticker": " "}},
+		{Delimiter: ";;"},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded; want an error", bad)
+		}
+	}
+}
+
+func TestImportCSVOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	path := writeImportFile(t, "history.csv", "\ufeffSymbol;Name;Firm;action;From;To;Old target;New target;Date\n"+
+		"AKBA;Akebia;HC Wainwright;reiterated by;Buy;Buy;$4.00;$4.00;2025-06-03\n"+
+		"MOMO;Hello Group;Benchmark;upgraded by;Hold;Buy;;;yesterday\n"+
+		"\n"+
+		"CECO;CECO Environmental;Needham;target raised by;Buy;Buy;$30.00;$33.00;2025-06-02\n"+
+		"AKBA;Akebia;HC Wainwright;reiterated by;Buy;Buy;$4.00;$4.00;2025-06-03\n")
+	cfg := ImportConfig{
+		Mapping: ImportMapping{
+			Columns: map[string]string{"ticker": "Symbol", "company": "Name", "brokerage": "Firm", "rating_from": "From",
+				"rating_to": "To", "target_from": "Old target", "target_to": "New target", "time": "Date"},
+			TimeLayout: "2006-01-02",
+			Delimiter:  ";",
+		},
+		BatchSize: 2,
+	}
+
+	stats, err := Import(ctx, db, path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Fetched != 4 || stats.Loaded != 2 || stats.Duplicates != 1 || stats.Failed != 1 || stats.Pages != 2 || stats.Line != 6 {
+		t.Errorf("Import() = %+v; want 4 read, 2 loaded, 1 duplicate and 1 failed in 2 batches, up to line 6", stats)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM stocks WHERE recommendation_score > 0`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("stored %d scored events (%v); want 2", count, err)
+	}
+
+	failed, err := ListFailedItems(ctx, db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Phase != failedPhaseTransform || failed[0].SourceLine != 3 ||
+		filepath.Base(failed[0].SourceFile) != "history.csv" || !strings.Contains(failed[0].Error, "yesterday") {
+		t.Errorf("failed items = %+v; want MOMO in the transform, from line 3 of history.csv", failed)
+	}
+
+	if _, err := Import(ctx, db, path, cfg); !errors.Is(err, ErrAlreadyImported) {
+		t.Errorf("second Import() = %v; want ErrAlreadyImported", err)
+	}
+	cfg.Restart = true
+	if stats, err = Import(ctx, db, path, cfg); err != nil || stats.Duplicates != 3 || stats.Loaded != 0 {
+		t.Errorf("restarted Import() = %+v, %v; want 3 duplicates", stats, err)
+	}
+
+	delete(cfg.Mapping.Columns, "ticker")
+	if _, err := Import(ctx, db, path, cfg); err == nil || !strings.Contains(err.Error(), `no "ticker" column`) {
+		t.Errorf("Import() without the ticker column = %v; want an error", err)
+	}
+}
+
+func TestImportResumeOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	lines := `{"ticker": "AKBA", "company": "Akebia", "brokerage": "HC Wainwright", "action": "reiterated by", "rating_from": "Buy", "rating_to": "Buy", "target_from": 4, "target_to": 4.5, "time": "2025-06-03T14:00:00Z"}
+["not", "an", "object"]
+{"ticker": "CECO", "company": "CECO Environmental", "brokerage": "Needham", "action": "target raised by", "rating_from": "Buy", "rating_to": "Buy", "target_from": null, "target_to": "$33.00", "time": "2025-06-02T14:00:00Z"}
+`
+	path := writeImportFile(t, "history.jsonl", lines)
+
+	stats, err := Import(ctx, db, path, ImportConfig{BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Fetched != 3 || stats.Loaded != 2 || stats.Failed != 1 || stats.Line != 3 {
+		t.Errorf("Import() = %+v; want 3 read, 2 loaded and 1 failed, up to line 3", stats)
+	}
+	var target string
+	if err := db.QueryRowContext(ctx, `SELECT CAST(target_to AS TEXT) FROM stocks WHERE ticker = 'AKBA'`).Scan(&target); err != nil || target != "4.5" {
+		t.Errorf("target_to of AKBA = %q, %v; want 4.5 from a JSON number", target, err)
+	}
+
+	// as if the import had stopped after the first batch
+	if _, err := db.ExecContext(ctx, `UPDATE import_progress SET line = 1, done = false`); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = Import(ctx, db, path, ImportConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ResumedAfter != 1 || stats.Fetched != 2 || stats.Duplicates != 1 || stats.Failed != 1 {
+		t.Errorf("resumed Import() = %+v; want 2 records read after line 1", stats)
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE import_progress SET done = false`); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(lines+lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(ctx, db, path, ImportConfig{}); err == nil || !strings.Contains(err.Error(), "changed since its import stopped") {
+		t.Errorf("Import() of a changed file = %v; want an error", err)
+	}
+}
+
+func TestImportEachRecordOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	for _, trigger := range []string{
+		`CREATE TRIGGER reject_bad BEFORE INSERT ON stocks WHEN NEW.ticker IN ('BAD', 'WORSE') BEGIN SELECT RAISE(ABORT, 'rejected'); END`,
+		`CREATE TRIGGER fail_line_3 BEFORE INSERT ON failed_items WHEN NEW.source_line = 3 BEGIN SELECT RAISE(ABORT, 'disk full'); END`,
+	} {
+		if _, err := db.ExecContext(ctx, trigger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lines string
+	for _, ticker := range []string{"AKBA", "BAD", "WORSE", "CECO"} {
+		lines += `{"ticker": "` + ticker + `", "company": "` + ticker + ` Inc", "brokerage": "Needham", "action": "upgraded by", "rating_from": "Hold", "rating_to": "Buy", "time": "2025-06-03T14:00:00Z"}` + "\n"
+	}
+	path := writeImportFile(t, "history.jsonl", lines)
+
+	if _, err := Import(ctx, db, path, ImportConfig{}); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("Import() = %v; want the error storing the failed item of line 3", err)
+	}
+	var source string
+	var line, loaded, failed int
+	if err := db.QueryRowContext(ctx, `SELECT source, line, loaded, failed FROM import_progress`).Scan(&source, &line, &loaded, &failed); err != nil {
+		t.Fatal(err)
+	}
+	if line != 2 || loaded != 1 || failed != 1 {
+		t.Errorf("progress = line %d, %d loaded, %d failed; want the records loaded one at a time up to line 2", line, loaded, failed)
+	}
+
+	if _, err := db.ExecContext(ctx, `DROP TRIGGER fail_line_3`); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := Import(ctx, db, path, ImportConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ResumedAfter != 2 || stats.Loaded != 1 || stats.Failed != 1 {
+		t.Errorf("resumed Import() = %+v; want CECO loaded and WORSE failed after line 2", stats)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM failed_items`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("stored %d failed items (%v); want BAD and WORSE once", count, err)
+	}
+
+	// another import of the file that stored its progress at line 2 before this one finished
+	l := &importLoader{db: db, dialect: app.DialectOf(db), source: source, line: 2}
+	if err := l.inTx(ctx, 3, func(*sql.Tx) (int, int, error) { return 0, 0, nil }); !errors.Is(err, ErrImportConflict) {
+		t.Errorf("inTx() after another import = %v; want ErrImportConflict", err)
+	}
+}
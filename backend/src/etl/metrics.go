@@ -0,0 +1,89 @@
+package etl
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the Prometheus metrics of the ETL runs: the pages fetched, the items
+// transformed, the items sent to failed_items by phase and the duration of the runs.
+// A nil *Metrics records nothing, so Run doesn't need to check.
+type Metrics struct {
+	pages       prometheus.Counter
+	transformed prometheus.Counter
+	failed      *prometheus.CounterVec
+	runs        *prometheus.CounterVec
+	duration    prometheus.Histogram
+	lastRun     prometheus.Gauge
+}
+
+// NewMetrics returns the metrics of the ETL, registered in reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		pages: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "etl_pages_fetched_total",
+			Help: "Pages fetched from the external API.",
+		}),
+		transformed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "etl_items_transformed_total",
+			Help: "Items of the external API transformed into events.",
+		}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_failed_items_total",
+			Help: "Items sent to failed_items, by the phase they failed in.",
+		}, []string{"phase"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_runs_total",
+			Help: "ETL runs finished, by result: success or error.",
+		}, []string{"result"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "etl_run_duration_seconds",
+			Help:    "Duration of the ETL runs.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 3600},
+		}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_last_run_timestamp_seconds",
+			Help: "Unix time the last ETL run finished.",
+		}),
+	}
+	// the phases start at 0, so a rate over them works before the first failure
+	for _, phase := range []string{failedPhaseTransform, failedPhaseLoad} {
+		m.failed.WithLabelValues(strings.ToLower(phase))
+	}
+	reg.MustRegister(m.pages, m.transformed, m.failed, m.runs, m.duration, m.lastRun)
+	return m
+}
+
+func (m *Metrics) page() {
+	if m != nil {
+		m.pages.Inc()
+	}
+}
+
+func (m *Metrics) itemTransformed() {
+	if m != nil {
+		m.transformed.Inc()
+	}
+}
+
+func (m *Metrics) itemFailed(phase string) {
+	if m != nil {
+		m.failed.WithLabelValues(strings.ToLower(phase)).Inc()
+	}
+}
+
+// runFinished records a run started at start, which returned err.
+func (m *Metrics) runFinished(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.runs.WithLabelValues(result).Inc()
+	m.duration.Observe(time.Since(start).Seconds())
+	m.lastRun.SetToCurrentTime()
+}
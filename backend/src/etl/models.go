@@ -1,6 +1,4 @@
-package main
-
-import "vue_go_cockroachdb/src/models"
+package etl
 
 // APIResponse models the response from the external API containing
 // a list of action recommendations and a pagination token.
@@ -45,32 +43,3 @@ type APIRawItem struct {
 	TargetTo   string `json:"target_to"`   // New target price (e.g., "$13.00").
 	Time       string `json:"time"`        // Recommendation date and time in RFC3339 format.
 }
-
-// Verify if the response contains a valid rating in order to be inserted into the database.
-func isValidRating(rating string) bool {
-	return rating == models.RatingNeutral ||
-		rating == models.RatingUnchanged ||
-		rating == models.RatingEqualWeight ||
-		rating == models.RatingOutperform ||
-		rating == models.RatingMarketPerform ||
-		rating == models.RatingInLine ||
-		rating == models.RatingHold ||
-		rating == models.RatingBuy ||
-		rating == models.RatingOverweight ||
-		rating == models.RatingPositive ||
-		rating == models.RatingMarketOutperform ||
-		rating == models.RatingSectorOutperform ||
-		rating == models.RatingStrongBuy ||
-		rating == models.RatingSectorPerform ||
-		rating == models.RatingUnderweight ||
-		rating == models.RatingSell ||
-		rating == models.RatingSpeculativeBuy ||
-		rating == models.RatingSectorWeight ||
-		rating == models.RatingOutperformer ||
-		rating == models.RatingUnderperform ||
-		rating == models.RatingPeerPerform ||
-		rating == models.RatingSectorUnderperform ||
-		rating == models.RatingAccumulate ||
-		rating == models.RatingTopPick ||
-		rating == models.RatingReduce
-}
@@ -0,0 +1,141 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"vue_go_cockroachdb/src/models"
+)
+
+// Kinds of alias stored in the "normalization_aliases" table.
+const (
+	aliasKindRating = "rating"
+	aliasKindAction = "action"
+)
+
+// defaultRatingAliases maps spellings seen in the external API to a canonical rating.
+// Differences only in case, spaces or punctuation ("Strong Buy", "strong-buy") don't need
+// an entry here, they are already matched by aliasKey.
+var defaultRatingAliases = map[string]string{
+	"Mkt Perform":     models.RatingMarketPerform,
+	"Mkt Outperform":  models.RatingMarketOutperform,
+	"Market Weight":   models.RatingEqualWeight,
+	"Sector Weighted": models.RatingSectorWeight,
+	"Conviction Buy":  models.RatingStrongBuy,
+	"Peer-Perform":    models.RatingPeerPerform,
+}
+
+// defaultActionAliases maps the actions returned by the external API to a canonical action.
+var defaultActionAliases = map[string]string{
+	"upgraded by":       models.ActionUpgraded,
+	"downgraded by":     models.ActionDowngraded,
+	"initiated by":      models.ActionInitiated,
+	"reiterated by":     models.ActionReiterated,
+	"target raised by":  models.ActionTargetRaised,
+	"target lowered by": models.ActionTargetLowered,
+	"target set by":     models.ActionTargetSet,
+}
+
+// Normalizer maps the free text ratings and actions of the external API to the
+// canonical values defined in the models package.
+type Normalizer struct {
+	ratings map[string]string // aliasKey(alias) -> canonical rating
+	actions map[string]string // aliasKey(alias) -> canonical action
+}
+
+// NewNormalizer returns a Normalizer that knows the canonical values and the default aliases.
+func NewNormalizer() *Normalizer {
+	n := &Normalizer{ratings: map[string]string{}, actions: map[string]string{}}
+	for _, r := range models.CanonicalRatings {
+		n.ratings[aliasKey(r)] = r
+	}
+	for alias, canonical := range defaultRatingAliases {
+		n.ratings[aliasKey(alias)] = canonical
+	}
+	for _, a := range models.CanonicalActions {
+		n.actions[aliasKey(a)] = a
+	}
+	for alias, canonical := range defaultActionAliases {
+		n.actions[aliasKey(alias)] = canonical
+	}
+	return n
+}
+
+// AddAlias registers (or overrides) an alias. The canonical value must belong to the
+// canonical set of its kind, otherwise an error is returned and nothing is changed.
+func (n *Normalizer) AddAlias(kind, alias, canonical string) error {
+	switch kind {
+	case aliasKindRating:
+		if !slices.Contains(models.CanonicalRatings, canonical) {
+			return fmt.Errorf("'%s' is not a canonical rating", canonical)
+		}
+		n.ratings[aliasKey(alias)] = canonical
+	case aliasKindAction:
+		if !slices.Contains(models.CanonicalActions, canonical) {
+			return fmt.Errorf("'%s' is not a canonical action", canonical)
+		}
+		n.actions[aliasKey(alias)] = canonical
+	default:
+		return fmt.Errorf("unknown alias kind '%s'", kind)
+	}
+	return nil
+}
+
+// Rating returns the canonical rating for raw, and false if it cannot be mapped.
+func (n *Normalizer) Rating(raw string) (string, bool) {
+	canonical, ok := n.ratings[aliasKey(raw)]
+	return canonical, ok
+}
+
+// Action returns the canonical action for raw. Unknown actions are matched by keyword
+// (e.g. "upgraded to" contains "upgraded") and fall back to models.ActionOther.
+func (n *Normalizer) Action(raw string) string {
+	if canonical, ok := n.actions[aliasKey(raw)]; ok {
+		return canonical
+	}
+	lower := strings.ToLower(raw)
+	for _, a := range models.CanonicalActions {
+		if a != models.ActionOther && strings.Contains(lower, a) {
+			return a
+		}
+	}
+	return models.ActionOther
+}
+
+// aliasKey reduces a value to its lowercase letters and digits, so that
+// "Strong-Buy", "Strong Buy" and "strong_buy" share the same key.
+func aliasKey(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// loadAliases reads the aliases stored in the "normalization_aliases" table into n.
+// Rows pointing to a non canonical value are logged by the caller through the returned
+// slice of errors and skipped, so a bad row never stops the ETL.
+func loadAliases(ctx context.Context, db *sql.DB, n *Normalizer) ([]error, error) {
+	rows, err := db.QueryContext(ctx, `SELECT kind, alias, canonical FROM normalization_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invalid []error
+	for rows.Next() {
+		var kind, alias, canonical string
+		if err := rows.Scan(&kind, &alias, &canonical); err != nil {
+			return invalid, err
+		}
+		if err := n.AddAlias(kind, alias, canonical); err != nil {
+			invalid = append(invalid, fmt.Errorf("alias '%s' (%s): %w", alias, kind, err))
+		}
+	}
+	return invalid, rows.Err()
+}
@@ -0,0 +1,74 @@
+package etl
+
+import "testing"
+
+func TestNormalizerRating(t *testing.T) {
+	n := NewNormalizer()
+
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"Buy", "Buy", true},
+		{"Strong-Buy", "Strong-Buy", true},
+		{"Strong Buy", "Strong-Buy", true},
+		{"strong_buy", "Strong-Buy", true},
+		{"Mkt Perform", "Market Perform", true},
+		{"In Line", "In-Line", true},
+		{" equal-weight ", "Equal Weight", true},
+		{"unknown", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := n.Rating(tt.input)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Rating(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestNormalizerAction(t *testing.T) {
+	n := NewNormalizer()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"upgraded by", "upgraded"},
+		{"Upgraded By", "upgraded"},
+		{"target lowered by", "target lowered"},
+		{"downgraded to", "downgraded"},
+		{"coverage dropped by", "other"},
+		{"", "other"},
+	}
+
+	for _, tt := range tests {
+		got := n.Action(tt.input)
+		if got != tt.expected {
+			t.Errorf("Action(%q) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizerAddAlias(t *testing.T) {
+	n := NewNormalizer()
+
+	if err := n.AddAlias(aliasKindRating, "Market Outperformer", "Market Outperform"); err != nil {
+		t.Fatalf("AddAlias returned unexpected error: %v", err)
+	}
+	if got, _ := n.Rating("market outperformer"); got != "Market Outperform" {
+		t.Errorf("Rating after AddAlias = %q; want %q", got, "Market Outperform")
+	}
+
+	if err := n.AddAlias(aliasKindRating, "Great", "Awesome"); err == nil {
+		t.Error("AddAlias accepted a non canonical rating")
+	}
+	if err := n.AddAlias(aliasKindAction, "dropped by", "dropped"); err == nil {
+		t.Error("AddAlias accepted a non canonical action")
+	}
+	if err := n.AddAlias("brokerage", "GS", "Goldman Sachs"); err == nil {
+		t.Error("AddAlias accepted an unknown kind")
+	}
+}
@@ -0,0 +1,278 @@
+package etl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Price is a target price parsed from the external API.
+type Price struct {
+	Amount   decimal.Decimal
+	Currency string // ISO 4217 code, empty when the value has no currency symbol or code
+}
+
+// blankPrices are values that mean "no target" and are stored as NULL.
+var blankPrices = map[string]bool{
+	"":     true,
+	"-":    true,
+	"--":   true,
+	"—":    true,
+	"n/a":  true,
+	"na":   true,
+	"none": true,
+	"null": true,
+}
+
+// currencySymbols maps currency symbols to their ISO 4217 code.
+// Longer symbols go first so "US$" or "C$" are not read as "$".
+var currencySymbols = []struct {
+	Symbol string
+	Code   string
+}{
+	{"US$", "USD"},
+	{"HK$", "HKD"},
+	{"CA$", "CAD"},
+	{"AU$", "AUD"},
+	{"C$", "CAD"},
+	{"A$", "AUD"},
+	{"R$", "BRL"},
+	{"$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"¥", "JPY"},
+	{"₹", "INR"},
+	{"₩", "KRW"},
+}
+
+// currencyCodes are the ISO 4217 codes accepted before or after the amount (e.g. "USD 12.50").
+var currencyCodes = []string{
+	"USD", "EUR", "GBP", "JPY", "CAD", "AUD", "CHF", "HKD",
+	"BRL", "INR", "CNY", "KRW", "SEK", "NOK", "DKK", "MXN",
+}
+
+// decimalCommaCurrencies are the currencies whose amounts are usually written with a
+// decimal comma ("12,50 €"). They decide the ambiguous amounts of normalizeSeparators.
+var decimalCommaCurrencies = map[string]bool{
+	"EUR": true, "BRL": true, "SEK": true, "NOK": true, "DKK": true,
+}
+
+// magnitudeSuffixes are the abbreviations accepted after the amount (e.g. "12.5M").
+var magnitudeSuffixes = map[byte]decimal.Decimal{
+	'K': decimal.New(1, 3),
+	'M': decimal.New(1, 6),
+	'B': decimal.New(1, 9),
+	'T': decimal.New(1, 12),
+}
+
+// parsePrice parses a target price such as "$13.00", "€12,50", "1.234,56 EUR", "12.5M"
+// or "($4.20)". It returns ok=false without error for blank values like "" or "N/A",
+// which must be stored as NULL.
+func parsePrice(raw string) (price Price, ok bool, err error) {
+	s := strings.TrimSpace(raw)
+	if blankPrices[strings.ToLower(s)] {
+		return Price{}, false, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = strings.TrimSpace(s[1:])
+	}
+
+	currency, s, err := stripCurrency(s)
+	if err != nil {
+		return Price{}, false, err
+	}
+	// the sign can also come after the symbol, e.g. "$-4.20"
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = strings.TrimSpace(s[1:])
+	}
+
+	multiplier := decimal.NewFromInt(1)
+	if n := len(s); n > 0 {
+		if m, found := magnitudeSuffixes[upper(s[n-1])]; found {
+			multiplier = m
+			s = strings.TrimSpace(s[:n-1])
+		}
+	}
+
+	number, err := normalizeSeparators(s, currency)
+	if err != nil {
+		return Price{}, false, err
+	}
+	amount, err := decimal.NewFromString(number)
+	if err != nil {
+		return Price{}, false, err
+	}
+
+	amount = amount.Mul(multiplier)
+	if negative {
+		amount = amount.Neg()
+	}
+	return Price{Amount: amount, Currency: currency}, true, nil
+}
+
+// stripCurrency removes a currency symbol or code placed before and/or after the amount
+// and returns its ISO 4217 code.
+func stripCurrency(s string) (string, string, error) {
+	var found []string
+
+	for _, c := range currencySymbols {
+		if strings.HasPrefix(s, c.Symbol) {
+			found = append(found, c.Code)
+			s = strings.TrimSpace(strings.TrimPrefix(s, c.Symbol))
+			break
+		}
+	}
+	for _, code := range currencyCodes {
+		if len(s) >= len(code) && strings.EqualFold(s[:len(code)], code) {
+			found = append(found, code)
+			s = strings.TrimSpace(s[len(code):])
+			break
+		}
+	}
+	for _, code := range currencyCodes {
+		if len(s) >= len(code) && strings.EqualFold(s[len(s)-len(code):], code) {
+			found = append(found, code)
+			s = strings.TrimSpace(s[:len(s)-len(code)])
+			break
+		}
+	}
+	for _, c := range currencySymbols {
+		if strings.HasSuffix(s, c.Symbol) {
+			found = append(found, c.Code)
+			s = strings.TrimSpace(strings.TrimSuffix(s, c.Symbol))
+			break
+		}
+	}
+
+	currency := ""
+	for _, code := range found {
+		// "$12 USD" is fine, "$12 EUR" is not
+		if currency != "" && code != currency {
+			return "", "", fmt.Errorf("conflicting currencies %s and %s", currency, code)
+		}
+		currency = code
+	}
+	return currency, s, nil
+}
+
+// normalizeSeparators turns an amount written with any common locale convention
+// ("1,234.56", "1.234,56", "1 234,56", "1'234.56", "12,50") into "1234.56".
+// When only one kind of separator is present, a single one is the decimal point unless
+// it's followed by exactly three digits: "1,234" and "1.234" are ambiguous, so they're
+// read with the convention of currency ("$1,234" is 1234, "1.234 €" is 1234, "$4.125"
+// is 4.125) and rejected without one.
+func normalizeSeparators(s, currency string) (string, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", "\u2019", "").Replace(s)
+	if s == "" {
+		return "", fmt.Errorf("no amount")
+	}
+
+	lastDot := strings.LastIndex(s, ".")
+	lastComma := strings.LastIndex(s, ",")
+	thousands := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			thousands = "."
+			s = strings.ReplaceAll(s[:lastComma], ".", "\x00") + "." + s[lastComma+1:]
+		} else {
+			thousands = ","
+		}
+	case lastComma >= 0:
+		if strings.Count(s, ",") > 1 {
+			thousands = ","
+			break
+		}
+		grouping, err := groupingSeparator(s, lastComma, currency, decimalCommaCurrencies[currency])
+		if err != nil {
+			return "", err
+		}
+		if grouping {
+			thousands = ","
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case lastDot >= 0:
+		if strings.Count(s, ".") == 1 {
+			grouping, err := groupingSeparator(s, lastDot, currency, !decimalCommaCurrencies[currency])
+			if err != nil {
+				return "", err
+			}
+			if !grouping {
+				break
+			}
+		}
+		thousands = "."
+		s = strings.ReplaceAll(s, ".", "\x00")
+	}
+	if thousands != "" {
+		if thousands == "," {
+			s = strings.ReplaceAll(s, ",", "\x00")
+		}
+		var err error
+		if s, err = removeGrouping(s); err != nil {
+			return "", err
+		}
+	}
+
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.':
+		default:
+			return "", fmt.Errorf("unexpected character %q in amount", r)
+		}
+	}
+	if digits == 0 || strings.Count(s, ".") > 1 {
+		return "", fmt.Errorf("malformed amount")
+	}
+	return s, nil
+}
+
+// groupingSeparator tells whether the only separator of s, at i, groups thousands. It
+// does unless it's followed by other than three digits, or currency writes it as the
+// decimal point (decimalPoint); without a currency, that case is ambiguous.
+func groupingSeparator(s string, i int, currency string, decimalPoint bool) (bool, error) {
+	if len(s)-i-1 != 3 {
+		return false, nil
+	}
+	if currency == "" {
+		return false, fmt.Errorf("ambiguous amount %q: %q can be a thousands separator or the decimal point", s, s[i])
+	}
+	return !decimalPoint, nil
+}
+
+// removeGrouping removes the thousands separators (marked as NUL by normalizeSeparators)
+// checking that every group after the first one has exactly three digits.
+func removeGrouping(s string) (string, error) {
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	groups := strings.Split(integer, "\x00")
+	for i, g := range groups {
+		if (i == 0 && (len(g) == 0 || len(g) > 3)) || (i > 0 && len(g) != 3) {
+			return "", fmt.Errorf("malformed thousands separators")
+		}
+	}
+	s = strings.Join(groups, "")
+	if hasFraction {
+		s += "." + fraction
+	}
+	return s, nil
+}
+
+func upper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+	return b
+}
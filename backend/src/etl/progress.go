@@ -0,0 +1,67 @@
+package etl
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats summarizes an ETL run.
+type Stats struct {
+	RunID      string    `json:"run_id"` // logged as run_id by the logs of the run
+	StartedAt  time.Time `json:"started_at"`
+	Pages      int       `json:"pages"`      // pages fetched from the external API
+	Fetched    int       `json:"fetched"`    // items received
+	Loaded     int       `json:"loaded"`     // new events inserted
+	Duplicates int       `json:"duplicates"` // events already stored with the same values
+	Updated    int       `json:"updated"`    // stored events replaced by a changed version
+	Failed     int       `json:"failed"`     // items sent to failed_items
+
+	// CompanyMismatches is the number of items whose company isn't the canonical name
+	// of their ticker in the companies table.
+	CompanyMismatches int `json:"company_mismatches"`
+
+	// Changed is the number of events received with values different from the stored
+	// ones, whether the conflict policy applied them (Updated) or not.
+	Changed int `json:"changed"`
+	// Changes lists the first maxChanges of them, so the stats of a long run or import
+	// stay small.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// maxChanges is the most Changes kept by Stats.
+const maxChanges = 100
+
+// addChange counts c, keeping it if there are less than maxChanges.
+func (s *Stats) addChange(c Change) {
+	s.Changed++
+	if c.Applied {
+		s.Updated++
+	}
+	if len(s.Changes) < maxChanges {
+		s.Changes = append(s.Changes, c)
+	}
+}
+
+// Progress exposes the Stats of a running ETL. It's safe for concurrent use, so the
+// HTTP server can report it while the run is in progress.
+type Progress struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Snapshot returns a copy of the current stats.
+func (p *Progress) Snapshot() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// update applies fn to the stats. A nil Progress is a no-op, so Run doesn't need to check.
+func (p *Progress) update(fn func(s *Stats)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(&p.stats)
+}
@@ -0,0 +1,62 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"vue_go_cockroachdb/src/models"
+)
+
+// rescoreBatchSize is the number of rows read and updated per batch by Rescore.
+const rescoreBatchSize = 500
+
+// Rescore recalculates the recommendation_score of every row in the stocks table.
+// The score depends on how recent an event is, so it must be refreshed periodically
+// and whenever the scoring rules change. It returns the number of updated rows.
+func Rescore(ctx context.Context, db *sql.DB) (int, error) {
+	updated := 0
+	defer func() { bumpDataVersion(ctx, db, updated > 0) }()
+	lastTicker, lastTime := "", time.Time{}
+	for {
+		// keyset pagination over the primary key, so rows are never read twice
+		rows, err := db.QueryContext(ctx, `
+			SELECT ticker, action, rating_from, rating_to, target_from, target_to, time
+			FROM stocks
+			WHERE (ticker, time) > ($1, $2)
+			ORDER BY ticker, time
+			LIMIT $3
+		`, lastTicker, lastTime, rescoreBatchSize)
+		if err != nil {
+			return updated, err
+		}
+
+		var batch []models.Stock
+		for rows.Next() {
+			var s models.Stock
+			if err := rows.Scan(&s.Ticker, &s.Action, &s.RatingFrom, &s.RatingTo, &s.TargetFrom, &s.TargetTo, &s.Time); err != nil {
+				rows.Close()
+				return updated, err
+			}
+			batch = append(batch, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, err
+		}
+		if len(batch) == 0 {
+			return updated, nil
+		}
+
+		for _, s := range batch {
+			_, err := db.ExecContext(ctx, `UPDATE stocks SET recommendation_score = $1 WHERE ticker = $2 AND time = $3`,
+				CalculateStockScore(s), s.Ticker, s.Time)
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+
+		last := batch[len(batch)-1]
+		lastTicker, lastTime = last.Ticker, last.Time
+	}
+}
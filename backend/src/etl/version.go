@@ -0,0 +1,27 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// BumpDataVersion moves the version of the stored data (data_version table), so the
+// caches of the API drop the answers computed before. The ETL calls it after it
+// changes the stocks.
+func BumpDataVersion(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `UPDATE data_version SET version = version + 1, updated_at = $1`, time.Now().UTC())
+	return err
+}
+
+// bumpDataVersion calls BumpDataVersion if changed, logging its error: a stale cache
+// doesn't fail the load.
+func bumpDataVersion(ctx context.Context, db *sql.DB, changed bool) {
+	if !changed {
+		return
+	}
+	if err := BumpDataVersion(context.WithoutCancel(ctx), db); err != nil {
+		slog.ErrorContext(ctx, "Failed to bump the data version", "error", err)
+	}
+}
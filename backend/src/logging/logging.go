@@ -0,0 +1,162 @@
+// Package logging configures the log/slog logger of the binary: JSON (or text) records
+// of a minimum level, written to stderr, stdout or a file rotated by size. The records
+// logged with a context carry the attributes added to it with With, like the id of the
+// HTTP request (request_id) or of the ETL run (run_id), so the lines of a request or a
+// run can be correlated.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Formats of the records.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Outputs that aren't files.
+const (
+	OutputStderr = "stderr"
+	OutputStdout = "stdout"
+)
+
+// Rotation of the log files: a file is rotated when it reaches maxFileSize MB, and
+// the rotated files are compressed and kept for maxFileAge days, up to maxFileBackups.
+const (
+	maxFileSize    = 100
+	maxFileBackups = 10
+	maxFileAge     = 30
+)
+
+// RunIDKey is the attribute of the id of a job run, see WithRunID.
+const RunIDKey = "run_id"
+
+// ParseLevel returns the level named s: debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	switch strings.ToLower(s) {
+	case "debug":
+		level = slog.LevelDebug
+	case "info", "":
+		level = slog.LevelInfo
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return level, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// New returns a logger writing the records of level and above to w, as JSON or text,
+// with the attributes of their context.
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case FormatJSON, "":
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// OpenFile returns a writer appending to the file at path, rotated by size. The file
+// and its directory are created if missing.
+func OpenFile(path string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxFileSize,
+		MaxBackups: maxFileBackups,
+		MaxAge:     maxFileAge,
+		Compress:   true,
+	}, nil
+}
+
+type attrsKey struct{}
+
+// With returns ctx adding the attributes of args, as in slog.Logger.With, to the
+// records logged with it.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append([]slog.Attr{}, attrsOf(ctx)...)
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func attrsOf(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// WithRunID returns ctx logging the id of a job run as run_id, and the id: the one
+// already in ctx, so a job started by the scheduler logs the id of its run, or a new
+// one.
+func WithRunID(ctx context.Context) (context.Context, string) {
+	for _, a := range attrsOf(ctx) {
+		if a.Key == RunIDKey {
+			return ctx, a.Value.String()
+		}
+	}
+	id := NewID()
+	return With(ctx, RunIDKey, id), id
+}
+
+// NewID returns a random id of 16 hex digits.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds the attributes of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := attrsOf(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerContext(t *testing.T) {
+	var buf bytes.Buffer
+	level, err := ParseLevel("WARN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, err := New(&buf, level, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := With(context.Background(), "request_id", "host/abc-000001")
+	ctx, runID := WithRunID(ctx)
+	if again, id := WithRunID(ctx); id != runID || again != ctx {
+		t.Errorf("WithRunID of a context with run %s = %s; want the same run", runID, id)
+	}
+	logger.InfoContext(ctx, "Hidden")
+	logger.With("job", "etl").WarnContext(ctx, "Lost the lease", "error", "timeout")
+	logger.Warn("Without context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %q; want the 2 warnings", lines)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"level": "WARN", "msg": "Lost the lease", "job": "etl", "error": "timeout",
+		"request_id": "host/abc-000001", RunIDKey: runID}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v; want %v in %s", key, record[key], value, lines[0])
+		}
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("record without context %s has the attributes of another context", lines[1])
+	}
+}
+
+func TestLoggerSettings(t *testing.T) {
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error(`ParseLevel("verbose") succeeded; want an error`)
+	}
+	if _, err := New(&bytes.Buffer{}, slog.LevelInfo, "xml"); err == nil {
+		t.Error(`New(format "xml") succeeded; want an error`)
+	}
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelDebug, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.DebugContext(With(context.Background(), "request_id", "r1"), "Request", "status", 200)
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG msg=Request status=200 request_id=r1") {
+		t.Errorf("text record = %q", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "logs", "etl.log")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile(%s) = %v; want the file created with its directory", path, err)
+	}
+	if _, err := f.Write([]byte("line\n")); err != nil {
+		t.Error(err)
+	}
+	f.Close()
+	if _, err := OpenFile(filepath.Join(path, "under-a-file.log")); err == nil {
+		t.Error("OpenFile() under a file succeeded; want an error")
+	}
+}
@@ -0,0 +1,354 @@
+// Package migrations applies the versioned database schema embedded in the binary.
+//
+// Each migration is a pair of files named NNNN_description.up.sql and
+// NNNN_description.down.sql, in the sql directory for CockroachDB and PostgreSQL and in
+// the sqlite directory for SQLite, which are numbered apart. Applied versions are
+// recorded in the "schema_migrations" table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"vue_go_cockroachdb/src/app"
+	"vue_go_cockroachdb/src/scheduler"
+)
+
+//go:embed sql/*.sql sqlite/*.sql
+var files embed.FS
+
+// dirs are the directories of the migrations of each dialect.
+var dirs = map[app.Dialect]string{app.Postgres: "sql", app.SQLite: "sqlite"}
+
+// ErrSchemaBehind is returned by CheckCurrent when there are pending migrations.
+var ErrSchemaBehind = errors.New("database schema is behind, run `migrate up`")
+
+// Migration is a numbered schema change with its up and down SQL.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// All returns the embedded migrations of dialect sorted by version.
+func All(dialect app.Dialect) ([]Migration, error) {
+	dir := dirs[dialect]
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		number, description, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+
+		content, err := files.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: description}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var all []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: both up and down files are required", m.Version, m.Name)
+		}
+		all = append(all, *m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// GetStatus returns every embedded migration along with whether it has been applied.
+func GetStatus(ctx context.Context, db *sql.DB) ([]Status, error) {
+	all, err := All(app.DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(all))
+	for i, m := range all {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = Status{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// CheckCurrent returns ErrSchemaBehind if any embedded migration is not applied yet.
+func CheckCurrent(ctx context.Context, db *sql.DB) error {
+	statuses, err := GetStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if !s.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w (%d pending migrations)", ErrSchemaBehind, pending)
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order, at most steps of them (all if steps <= 0).
+// It returns the migrations that were applied. It holds the migration lock (see
+// withLock) while it runs.
+func Up(ctx context.Context, db *sql.DB, steps int) (done []Migration, err error) {
+	err = withLock(ctx, db, func(ctx context.Context) error {
+		done, err = up(ctx, db, steps)
+		return err
+	})
+	return done, err
+}
+
+func up(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	statuses, err := GetStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, s := range statuses {
+		if s.Applied {
+			continue
+		}
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if err := execScript(ctx, db, s.Up); err != nil {
+			return done, fmt.Errorf("migration %04d_%s up: %w", s.Version, s.Name, err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, s.Version, s.Name); err != nil {
+			return done, err
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last applied migrations, at most steps of them (all if steps <= 0).
+// It returns the migrations that were reverted. It holds the migration lock (see
+// withLock) while it runs.
+func Down(ctx context.Context, db *sql.DB, steps int) (done []Migration, err error) {
+	err = withLock(ctx, db, func(ctx context.Context) error {
+		done, err = down(ctx, db, steps)
+		return err
+	})
+	return done, err
+}
+
+func down(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	statuses, err := GetStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if !s.Applied {
+			continue
+		}
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if err := execScript(ctx, db, s.Down); err != nil {
+			return done, fmt.Errorf("migration %04d_%s down: %w", s.Version, s.Name, err)
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, s.Version); err != nil {
+			return done, err
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// Lease of the migration lock, renewed every third of lockTTL while it's held.
+const (
+	lockTable = "schema_migrations_lock"
+	lockName  = "migrations"
+	lockTTL   = time.Minute
+	lockRetry = 2 * time.Second
+)
+
+// withLock runs f holding the migration lock, so two processes don't apply migrations
+// at the same time, waiting while another process holds it. The lock is a lease row of
+// the "schema_migrations_lock" table, as the job leases of the scheduler: CockroachDB
+// has no advisory locks, and the row expires if the process holding it dies.
+func withLock(ctx context.Context, db *sql.DB, f func(ctx context.Context) error) error {
+	create := `
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`
+	if app.DialectOf(db) == app.SQLite {
+		create = strings.Replace(create, "TIMESTAMPTZ", "TIMESTAMP", 1)
+	}
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return err
+	}
+
+	locker := scheduler.NewDBLocker(db)
+	locker.Table = lockTable
+	for {
+		err := scheduler.RunOnce(ctx, lockName, f, locker, lockTTL)
+		if !errors.Is(err, scheduler.ErrLeaseHeld) {
+			return err
+		}
+		holder, _ := locker.Holder(ctx, lockName)
+		slog.InfoContext(ctx, "Waiting for another process to finish its migrations", "holder", holder)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for the migration lock held by %q: %w", holder, ctx.Err())
+		case <-time.After(lockRetry):
+		}
+	}
+}
+
+// appliedVersions creates the "schema_migrations" table if needed and returns
+// the applied versions with the time they were applied.
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	create := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT8 PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`
+	if app.DialectOf(db) == app.SQLite {
+		create = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+		)`
+	}
+	_, err := db.ExecContext(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// execScript runs the statements of a migration one by one. CockroachDB doesn't allow
+// using a column in the same transaction that adds it, so migrations don't run in a
+// single transaction and must be written to be safe to re-run if they fail halfway:
+// with IF [NOT] EXISTS, or with a condition on the statements that can't use it (see
+// splitStatements).
+func execScript(ctx context.Context, db *sql.DB, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if stmt.cond != "" {
+			var run bool
+			if err := db.QueryRowContext(ctx, stmt.cond).Scan(&run); err != nil {
+				return fmt.Errorf("condition: %w\n%s", err, stmt.cond)
+			}
+			if !run {
+				continue
+			}
+		}
+		if _, err := db.ExecContext(ctx, stmt.sql); err != nil {
+			return fmt.Errorf("%w\n%s", err, stmt.sql)
+		}
+	}
+	return nil
+}
+
+// statement is a statement of a migration script.
+type statement struct {
+	sql  string
+	cond string // query returning whether to run it, empty to always run it
+}
+
+// condPrefix starts the comment line of the condition of the next statement.
+const condPrefix = "-- if:"
+
+// splitStatements splits a script on the semicolons that end a line and drops the
+// comment-only lines. It's enough for the migrations of this package, which don't
+// contain functions or string literals with ";\n". A "-- if: <query>" line makes the
+// next statement conditional: it only runs if the query returns true.
+func splitStatements(script string) []statement {
+	var stmts []statement
+	var current strings.Builder
+	cond := ""
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if c, ok := strings.CutPrefix(trimmed, condPrefix); ok {
+			cond = strings.TrimSpace(c)
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, statement{sql: strings.TrimSpace(current.String()), cond: cond})
+			current.Reset()
+			cond = ""
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, statement{sql: rest, cond: cond})
+	}
+	return stmts
+}
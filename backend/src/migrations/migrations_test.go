@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"vue_go_cockroachdb/src/app"
+)
+
+func TestAllMigrationsAreNumberedInOrder(t *testing.T) {
+	for _, dialect := range []app.Dialect{app.Postgres, app.SQLite} {
+		all, err := All(dialect)
+		if err != nil {
+			t.Fatalf("All(%s) returned unexpected error: %v", dialect, err)
+		}
+		if len(all) == 0 {
+			t.Fatalf("no embedded %s migrations", dialect)
+		}
+		for i, m := range all {
+			if m.Version != i+1 {
+				t.Errorf("%s migration %d has version %d; versions must start at 1 without gaps", dialect, i, m.Version)
+			}
+			if m.Name == "" || m.Up == "" || m.Down == "" {
+				t.Errorf("%s migration %04d is incomplete: %+v", dialect, m.Version, m)
+			}
+		}
+	}
+}
+
+func TestSQLiteUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := app.GetDBConnection(ctx, "sqlite:"+filepath.Join(t.TempDir(), "stocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	all, _ := All(app.SQLite)
+	if applied, err := Up(ctx, db, 0); err != nil || len(applied) != len(all) {
+		t.Fatalf("Up = %d migrations, %v; want %d", len(applied), err, len(all))
+	}
+	if err := CheckCurrent(ctx, db); err != nil {
+		t.Errorf("CheckCurrent after Up: %v", err)
+	}
+	if reverted, err := Down(ctx, db, 0); err != nil || len(reverted) != len(all) {
+		t.Fatalf("Down = %d migrations, %v; want %d", len(reverted), err, len(all))
+	}
+	if err := CheckCurrent(ctx, db); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("CheckCurrent after Down: %v; want ErrSchemaBehind", err)
+	}
+}
+
+func TestUpWaitsForTheLock(t *testing.T) {
+	ctx := context.Background()
+	db, err := app.GetDBConnection(ctx, "sqlite:"+filepath.Join(t.TempDir(), "stocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go withLock(ctx, db, func(context.Context) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if applied, err := Up(waitCtx, db, 0); !errors.Is(err, context.DeadlineExceeded) || len(applied) != 0 {
+		t.Errorf("Up while the lock is held = %d migrations, %v; want to wait until the deadline", len(applied), err)
+	}
+
+	close(release)
+	if applied, err := Up(ctx, db, 1); err != nil || len(applied) != 1 {
+		t.Errorf("Up after the lock is released = %d migrations, %v; want 1", len(applied), err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (
+    id INT8 -- inline comments stay
+);
+
+-- if: SELECT EXISTS (SELECT 1 FROM a)
+UPDATE a SET id = 1;
+DROP TABLE a`
+
+	want := []statement{
+		{sql: "CREATE TABLE a (\n    id INT8 -- inline comments stay\n);"},
+		{sql: "UPDATE a SET id = 1;", cond: "SELECT EXISTS (SELECT 1 FROM a)"},
+		{sql: "DROP TABLE a"},
+	}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitStatements() = %+v; want %+v", got, want)
+	}
+}
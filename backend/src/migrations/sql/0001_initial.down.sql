@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS failed_items;
+DROP TABLE IF EXISTS stocks;
@@ -1,6 +1,5 @@
--- This SQL script creates the necessary tables for app, must be executed once.
--- Before running this script, ensure that the database is created and the connection is established.
--- The script is idempotent, meaning it can be run multiple times without causing errors.
+-- Initial schema, as it was created by the former hand-run db/create_db.sql.
+-- It uses IF NOT EXISTS so databases created by that script can adopt the migrations.
 CREATE TABLE IF NOT EXISTS stocks (
     ticker TEXT NOT NULL,
     company TEXT,
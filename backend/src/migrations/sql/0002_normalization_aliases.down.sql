@@ -0,0 +1,14 @@
+-- The values received from the API are restored from the _raw columns, and the
+-- canonical ones dropped: before the normalization the ETL stored the action and the
+-- ratings as received, and the rows loaded since hold normalized ratings too.
+UPDATE stocks
+SET action = COALESCE(action_raw, action),
+    rating_from = COALESCE(rating_from_raw, rating_from),
+    rating_to = COALESCE(rating_to_raw, rating_to)
+WHERE action_raw IS NOT NULL OR rating_from_raw IS NOT NULL OR rating_to_raw IS NOT NULL;
+
+ALTER TABLE stocks DROP COLUMN IF EXISTS rating_to_raw;
+ALTER TABLE stocks DROP COLUMN IF EXISTS rating_from_raw;
+ALTER TABLE stocks DROP COLUMN IF EXISTS action_raw;
+
+DROP TABLE IF EXISTS normalization_aliases;
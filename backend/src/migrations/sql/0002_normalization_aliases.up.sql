@@ -0,0 +1,35 @@
+-- Aliases used by the ETL to map the ratings and actions of the external API to their
+-- canonical values (see models.CanonicalRatings and models.CanonicalActions). Rows here
+-- override the defaults defined in the code.
+--   kind: 'rating' or 'action'
+--   e.g. INSERT INTO normalization_aliases VALUES ('rating', 'Mkt Perform', 'Market Perform');
+CREATE TABLE IF NOT EXISTS normalization_aliases (
+    kind TEXT NOT NULL,
+    alias TEXT NOT NULL,
+    canonical TEXT NOT NULL,
+    PRIMARY KEY (kind, alias)
+);
+
+-- Raw values as received from the external API, stored next to the canonical ones
+-- (action, rating_from, rating_to) to audit the normalization.
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS action_raw TEXT;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS rating_from_raw TEXT;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS rating_to_raw TEXT;
+
+-- Backfill rows loaded before the normalization existed: their ratings were already
+-- canonical, only the action needs to be mapped.
+UPDATE stocks
+SET action_raw = action,
+    rating_from_raw = rating_from,
+    rating_to_raw = rating_to,
+    action = CASE
+        WHEN action ILIKE '%upgraded%' THEN 'upgraded'
+        WHEN action ILIKE '%downgraded%' THEN 'downgraded'
+        WHEN action ILIKE '%initiated%' THEN 'initiated'
+        WHEN action ILIKE '%reiterated%' THEN 'reiterated'
+        WHEN action ILIKE '%target raised%' THEN 'target raised'
+        WHEN action ILIKE '%target lowered%' THEN 'target lowered'
+        WHEN action ILIKE '%target set%' THEN 'target set'
+        ELSE 'other'
+    END
+WHERE action_raw IS NULL;
@@ -0,0 +1,33 @@
+-- Reverts the typed columns, resumable as the up migration.
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'numeric')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_from_float FLOAT;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to' AND data_type = 'numeric')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_to_float FLOAT;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time' AND data_type = 'timestamp with time zone')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS time_naive TIMESTAMP;
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'numeric')
+UPDATE stocks
+SET target_from_float = target_from::FLOAT,
+    target_to_float = target_to::FLOAT,
+    time_naive = time AT TIME ZONE 'UTC'
+WHERE time_naive IS NULL;
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_naive')
+ALTER TABLE stocks ALTER COLUMN time_naive SET NOT NULL;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_naive')
+ALTER TABLE stocks DROP CONSTRAINT stocks_pkey, ADD CONSTRAINT stocks_pkey PRIMARY KEY (ticker, time_naive);
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'numeric')
+ALTER TABLE stocks DROP COLUMN target_from;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to' AND data_type = 'numeric')
+ALTER TABLE stocks DROP COLUMN target_to;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time' AND data_type = 'timestamp with time zone')
+ALTER TABLE stocks DROP COLUMN time;
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from_float')
+ALTER TABLE stocks RENAME COLUMN target_from_float TO target_from;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to_float')
+ALTER TABLE stocks RENAME COLUMN target_to_float TO target_to;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_naive')
+ALTER TABLE stocks RENAME COLUMN time_naive TO time;
@@ -0,0 +1,41 @@
+-- In-place data migration of the typed columns:
+--   target_from, target_to: FLOAT     -> DECIMAL(18, 4), rounded to 4 decimals
+--   time:                   TIMESTAMP -> TIMESTAMPTZ, the stored values are interpreted as UTC
+-- `time` is part of the primary key, so every column is rebuilt (add, backfill, swap)
+-- instead of using ALTER COLUMN TYPE. Each step only runs while the columns it uses
+-- still have their former type or name, so a run that failed halfway can be resumed,
+-- and databases that already ran the former hand-run db/migrate_typed_columns.sql skip
+-- every step.
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'double precision')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_from_dec DECIMAL(18, 4);
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to' AND data_type = 'double precision')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_to_dec DECIMAL(18, 4);
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time' AND data_type = 'timestamp without time zone')
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS time_tz TIMESTAMPTZ;
+
+-- the old columns are dropped in order after the backfill, target_from first
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'double precision')
+UPDATE stocks
+SET target_from_dec = ROUND(target_from::DECIMAL, 4),
+    target_to_dec = ROUND(target_to::DECIMAL, 4),
+    time_tz = time::TIMESTAMP AT TIME ZONE 'UTC'
+WHERE time_tz IS NULL;
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_tz')
+ALTER TABLE stocks ALTER COLUMN time_tz SET NOT NULL;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_tz')
+ALTER TABLE stocks DROP CONSTRAINT stocks_pkey, ADD CONSTRAINT stocks_pkey PRIMARY KEY (ticker, time_tz);
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from' AND data_type = 'double precision')
+ALTER TABLE stocks DROP COLUMN target_from;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to' AND data_type = 'double precision')
+ALTER TABLE stocks DROP COLUMN target_to;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time' AND data_type = 'timestamp without time zone')
+ALTER TABLE stocks DROP COLUMN time;
+
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_from_dec')
+ALTER TABLE stocks RENAME COLUMN target_from_dec TO target_from;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'target_to_dec')
+ALTER TABLE stocks RENAME COLUMN target_to_dec TO target_to;
+-- if: SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'stocks' AND column_name = 'time_tz')
+ALTER TABLE stocks RENAME COLUMN time_tz TO time;
@@ -0,0 +1 @@
+ALTER TABLE stocks DROP COLUMN IF EXISTS target_currency;
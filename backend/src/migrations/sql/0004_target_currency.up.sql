@@ -0,0 +1,6 @@
+-- Currency (ISO 4217 code) of target_from and target_to. Both targets are nullable:
+-- the ETL stores blank values such as "" or "N/A" as NULL.
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_currency TEXT;
+
+-- Rows loaded before the currency was recorded were all parsed from "$" prices.
+UPDATE stocks SET target_currency = 'USD' WHERE target_currency IS NULL AND target_from IS NOT NULL;
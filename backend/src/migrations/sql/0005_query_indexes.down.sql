@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS stocks_time_idx;
+DROP INDEX IF EXISTS stocks_recommendation_score_idx;
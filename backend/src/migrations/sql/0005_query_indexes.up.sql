@@ -0,0 +1,5 @@
+-- GetTopRecommendedStocks: WHERE recommendation_score >= $1 ORDER BY recommendation_score DESC, time DESC
+CREATE INDEX IF NOT EXISTS stocks_recommendation_score_idx ON stocks (recommendation_score DESC, time DESC);
+
+-- GetStocks default order: ORDER BY time DESC
+CREATE INDEX IF NOT EXISTS stocks_time_idx ON stocks (time DESC);
@@ -0,0 +1,6 @@
+-- One row per scheduled job while a replica runs it; see scheduler.DBLocker.
+CREATE TABLE IF NOT EXISTS job_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,23 @@
+-- Former versions of the events replaced by the ETL under the "revisions" conflict
+-- policy. revision numbers the versions of an event from 1, the oldest; the current
+-- version stays in stocks. changed_fields lists the fields that the next version changed.
+CREATE TABLE IF NOT EXISTS stock_revisions (
+    ticker TEXT NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    revision INT8 NOT NULL,
+    company TEXT,
+    brokerage TEXT,
+    action TEXT,
+    rating_from TEXT,
+    rating_to TEXT,
+    target_from DECIMAL(18, 4),
+    target_to DECIMAL(18, 4),
+    recommendation_score FLOAT,
+    action_raw TEXT,
+    rating_from_raw TEXT,
+    rating_to_raw TEXT,
+    target_currency TEXT,
+    changed_fields TEXT[] NOT NULL,
+    replaced_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticker, time, revision)
+);
@@ -0,0 +1,14 @@
+-- User-defined lists of tickers, used to scope /stocks, /recommendations and /stats.
+-- The ids are UUIDs so they survive the round trip through JavaScript numbers.
+CREATE TABLE IF NOT EXISTS watchlists (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS watchlist_tickers (
+    watchlist_id UUID NOT NULL REFERENCES watchlists (id) ON DELETE CASCADE,
+    ticker TEXT NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (watchlist_id, ticker)
+);
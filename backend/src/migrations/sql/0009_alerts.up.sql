@@ -0,0 +1,23 @@
+-- Alert rules evaluated against the events inserted by each ETL run; see the
+-- alerts package for the expression syntax.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    expression TEXT NOT NULL,
+    enabled BOOL NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Matches of the rules. event is the matched event as served by the API; an event
+-- fires each rule at most once.
+CREATE TABLE IF NOT EXISTS alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id UUID NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+    ticker TEXT NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    event JSONB NOT NULL,
+    fired_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (rule_id, ticker, time)
+);
+
+CREATE INDEX IF NOT EXISTS alerts_fired_at_idx ON alerts (fired_at DESC);
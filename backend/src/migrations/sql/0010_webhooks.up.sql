@@ -0,0 +1,34 @@
+-- URLs subscribed to the events loaded by the ETL. Empty filter arrays match any value.
+-- secret is stored as is because it's needed to sign the deliveries.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    tickers TEXT[] NOT NULL DEFAULT '{}',
+    brokerages TEXT[] NOT NULL DEFAULT '{}',
+    actions TEXT[] NOT NULL DEFAULT '{}',
+    min_score FLOAT,
+    enabled BOOL NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Outbox of the deliveries: one row per event and subscription, sent and retried by
+-- webhooks.Dispatcher. status: 'pending', 'delivered' or 'failed'.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    ticker TEXT NOT NULL,
+    event_time TIMESTAMPTZ NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT8 NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_status_code INT8,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ,
+    UNIQUE (subscription_id, ticker, event_time)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_log_idx ON webhook_deliveries (subscription_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS stocks_ingest_seq_idx;
+ALTER TABLE stocks DROP COLUMN IF EXISTS ingest_seq;
+DROP SEQUENCE IF EXISTS stocks_ingest_seq;
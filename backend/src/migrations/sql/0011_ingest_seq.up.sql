@@ -0,0 +1,10 @@
+-- Ingest sequence of the events: every insert, and every update by the ETL conflict
+-- policy, takes the next value. /events/stream polls it to push the new events, using
+-- it as the SSE event id. Events stored before this migration have no sequence.
+CREATE SEQUENCE IF NOT EXISTS stocks_ingest_seq;
+
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS ingest_seq INT8;
+
+ALTER TABLE stocks ALTER COLUMN ingest_seq SET DEFAULT nextval('stocks_ingest_seq');
+
+CREATE INDEX IF NOT EXISTS stocks_ingest_seq_idx ON stocks (ingest_seq);
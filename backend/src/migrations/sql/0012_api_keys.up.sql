@@ -0,0 +1,14 @@
+-- API keys of the HTTP API. Only the SHA-256 of a key is stored; prefix is its first
+-- characters, shown to tell the keys apart. scopes: 'read', 'etl' and 'admin'.
+-- request_count and last_used_at are updated in batches by auth.Authenticator.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    request_count INT8 NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,10 @@
+-- Daily quota of each key, NULL for the default of the server (api_daily_quota).
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS daily_quota INT8;
+
+-- Requests per key and UTC day, updated in batches with the counters of api_keys.
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    key_id UUID NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    requests INT8 NOT NULL DEFAULT 0,
+    PRIMARY KEY (key_id, day)
+);
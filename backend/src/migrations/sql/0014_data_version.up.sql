@@ -0,0 +1,10 @@
+-- Version of the stored data, a single row bumped whenever the ETL (a run, a rescore or
+-- a retry of failed items) or a watchlist change alters what the API answers. The API
+-- caches /recommendations and /stats until it moves.
+CREATE TABLE IF NOT EXISTS data_version (
+    id INT8 PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    version INT8 NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO data_version (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
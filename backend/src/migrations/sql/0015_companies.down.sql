@@ -0,0 +1,2 @@
+ALTER TABLE stocks DROP COLUMN IF EXISTS company_mismatch;
+DROP TABLE IF EXISTS companies;
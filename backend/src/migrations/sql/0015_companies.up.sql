@@ -0,0 +1,13 @@
+-- Canonical metadata of the issuer of each ticker, loaded from a CSV file by the ETL
+-- (COMPANIES_FILE). The events keep the company name the external API sent, and
+-- company_mismatch flags the ones whose name isn't the canonical one of their ticker.
+CREATE TABLE IF NOT EXISTS companies (
+    ticker TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    exchange TEXT,
+    sector TEXT,
+    industry TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS company_mismatch BOOL NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS import_progress;
+ALTER TABLE failed_items DROP COLUMN IF EXISTS source_line;
+ALTER TABLE failed_items DROP COLUMN IF EXISTS source_file;
@@ -0,0 +1,16 @@
+-- The file and line of the items of the import command that fail (NULL for the items
+-- of the external API), and the progress of the imports so an interrupted one resumes
+-- after the last loaded batch. fingerprint identifies the content of the file, so a
+-- different file at the same path isn't resumed.
+ALTER TABLE failed_items ADD COLUMN IF NOT EXISTS source_file TEXT;
+ALTER TABLE failed_items ADD COLUMN IF NOT EXISTS source_line INT8;
+
+CREATE TABLE IF NOT EXISTS import_progress (
+    source TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    line INT8 NOT NULL DEFAULT 0,
+    loaded INT8 NOT NULL DEFAULT 0,
+    failed INT8 NOT NULL DEFAULT 0,
+    done BOOL NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS watchlist_tickers;
+DROP TABLE IF EXISTS watchlists;
+DROP TABLE IF EXISTS stock_revisions;
+DROP TABLE IF EXISTS job_leases;
+DROP TABLE IF EXISTS normalization_aliases;
+DROP TABLE IF EXISTS failed_items;
+DROP TRIGGER IF EXISTS stocks_ingest_seq;
+DROP TABLE IF EXISTS stocks;
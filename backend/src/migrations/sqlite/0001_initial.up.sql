@@ -0,0 +1,88 @@
+-- Schema of the SQLite databases (sqlite: URLs), equivalent to the migrations of the
+-- sql directory up to 0013 for the tables SQLite supports: the stocks and their ETL,
+-- and the watchlists. The alerts, webhooks and API keys need CockroachDB or PostgreSQL.
+-- Times are stored as text in a format that sorts by time ("2006-01-02 15:04:05.999999999-07:00"
+-- in UTC), and the UUIDs as lowercase text.
+CREATE TABLE IF NOT EXISTS stocks (
+    ticker TEXT NOT NULL,
+    company TEXT,
+    brokerage TEXT,
+    action TEXT,
+    rating_from TEXT,
+    rating_to TEXT,
+    target_from NUMERIC,
+    target_to NUMERIC,
+    time TIMESTAMP NOT NULL,
+    recommendation_score REAL,
+    action_raw TEXT,
+    rating_from_raw TEXT,
+    rating_to_raw TEXT,
+    target_currency TEXT,
+    ingest_seq INTEGER,
+    PRIMARY KEY (ticker, time)
+);
+
+CREATE INDEX IF NOT EXISTS stocks_recommendation_score_idx ON stocks (recommendation_score DESC, time DESC);
+CREATE INDEX IF NOT EXISTS stocks_time_idx ON stocks (time DESC);
+CREATE INDEX IF NOT EXISTS stocks_ingest_seq_idx ON stocks (ingest_seq);
+
+-- SQLite has no sequences: every inserted event takes the next ingest sequence here,
+-- and the ETL takes it in the UPDATE of the events it replaces.
+CREATE TRIGGER IF NOT EXISTS stocks_ingest_seq AFTER INSERT ON stocks WHEN NEW.ingest_seq IS NULL BEGIN UPDATE stocks SET ingest_seq = (SELECT COALESCE(MAX(ingest_seq), 0) + 1 FROM stocks) WHERE rowid = NEW.rowid; END;
+
+CREATE TABLE IF NOT EXISTS failed_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    raw_json TEXT NOT NULL,
+    error_message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    failed_at_phase TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS normalization_aliases (
+    kind TEXT NOT NULL,
+    alias TEXT NOT NULL,
+    canonical TEXT NOT NULL,
+    PRIMARY KEY (kind, alias)
+);
+
+CREATE TABLE IF NOT EXISTS job_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- changed_fields is a JSON array of the field names.
+CREATE TABLE IF NOT EXISTS stock_revisions (
+    ticker TEXT NOT NULL,
+    time TIMESTAMP NOT NULL,
+    revision INTEGER NOT NULL,
+    company TEXT,
+    brokerage TEXT,
+    action TEXT,
+    rating_from TEXT,
+    rating_to TEXT,
+    target_from NUMERIC,
+    target_to NUMERIC,
+    recommendation_score REAL,
+    action_raw TEXT,
+    rating_from_raw TEXT,
+    rating_to_raw TEXT,
+    target_currency TEXT,
+    changed_fields TEXT NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (ticker, time, revision)
+);
+
+-- A random (version 4) UUID as the default id, compared ignoring the case as UUIDs are.
+CREATE TABLE IF NOT EXISTS watchlists (
+    id TEXT PRIMARY KEY COLLATE NOCASE DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS watchlist_tickers (
+    watchlist_id TEXT NOT NULL COLLATE NOCASE REFERENCES watchlists (id) ON DELETE CASCADE,
+    ticker TEXT NOT NULL,
+    added_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (watchlist_id, ticker)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE stocks DROP COLUMN company_mismatch;
+DROP TABLE IF EXISTS companies;
@@ -0,0 +1,12 @@
+-- Companies and the name mismatch flag of the events, as in 0015_companies of the sql
+-- directory.
+CREATE TABLE IF NOT EXISTS companies (
+    ticker TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    exchange TEXT,
+    sector TEXT,
+    industry TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+ALTER TABLE stocks ADD COLUMN company_mismatch BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,14 @@
+-- Sources of the failed items and progress of the imports, as in 0016_import_sources
+-- of the sql directory.
+ALTER TABLE failed_items ADD COLUMN source_file TEXT;
+ALTER TABLE failed_items ADD COLUMN source_line INTEGER;
+
+CREATE TABLE IF NOT EXISTS import_progress (
+    source TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    line INTEGER NOT NULL DEFAULT 0,
+    loaded INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    done BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
@@ -0,0 +1,11 @@
+package models
+
+// Company is the canonical metadata of the issuer of a ticker, as stored in the
+// companies table (see etl.LoadCompanies).
+type Company struct {
+	Ticker   string `json:"ticker"`
+	Name     string `json:"name"`
+	Exchange string `json:"exchange,omitempty"`
+	Sector   string `json:"sector,omitempty"`
+	Industry string `json:"industry,omitempty"`
+}
@@ -1,23 +1,48 @@
 package models
 
+import (
+	"time"
+)
+
 // not stored in the database, but used to represent a stock recommendation
 // for internal processing and transformation.
 type Stock struct {
-	Ticker     string  `json:"ticker"`
-	Company    string  `json:"company"`
-	Brokerage  string  `json:"brokerage"`
-	Action     string  `json:"action"`
-	RatingFrom string  `json:"rating_from"`
-	RatingTo   string  `json:"rating_to"`
-	TargetFrom float64 `json:"target_from"`
-	TargetTo   float64 `json:"target_to"`
-	Time       string  `json:"time"`
+	Ticker     string    `json:"ticker"`
+	Company    string    `json:"company"`
+	Brokerage  string    `json:"brokerage"`
+	Action     string    `json:"action"`
+	RatingFrom string    `json:"rating_from"`
+	RatingTo   string    `json:"rating_to"`
+	TargetFrom Price     `json:"target_from"` // null when the API sent no target
+	TargetTo   Price     `json:"target_to"`   // null when the API sent no target
+	Time       time.Time `json:"time"`
+
+	// ISO 4217 code of TargetFrom and TargetTo, empty when unknown.
+	TargetCurrency string `json:"target_currency,omitempty"`
+
+	// Values exactly as received from the external API, stored next to the
+	// canonical ones above so the normalization can be audited.
+	ActionRaw     string `json:"action_raw,omitempty"`
+	RatingFromRaw string `json:"rating_from_raw,omitempty"`
+	RatingToRaw   string `json:"rating_to_raw,omitempty"`
+
+	// Canonical metadata of the ticker, nil when the companies table doesn't have it.
+	CompanyInfo *Company `json:"company_info,omitempty"`
+	// Whether Company isn't the canonical name of the ticker (see etl.LoadCompanies).
+	CompanyMismatch bool `json:"company_mismatch,omitempty"`
 }
 
 // Represents a stock recommendation with its details in the database (stocks table).
 type StockWithScore struct {
 	Stock
-	RecommendationScore float64 `json:"recommendation_score,omitempty"`
+	RecommendationScore float64 `json:"recommendation_score"`
+}
+
+// StockEvent is a stored event with its position in the ingest sequence, as pushed
+// by /events/stream.
+type StockEvent struct {
+	Seq int64 `json:"seq"`
+	StockWithScore
 }
 
 // Constants for stock ratings to avoid magic strings in the code.
@@ -51,6 +76,36 @@ const (
 	RatingReduce             = "Reduce"
 )
 
+// CanonicalRatings is the set of ratings accepted in the `rating_from` and `rating_to` columns.
+// Any other spelling must be mapped to one of these through an alias (see etl normalization).
+var CanonicalRatings = []string{
+	RatingNeutral,
+	RatingUnchanged,
+	RatingEqualWeight,
+	RatingOutperform,
+	RatingMarketPerform,
+	RatingInLine,
+	RatingHold,
+	RatingBuy,
+	RatingOverweight,
+	RatingPositive,
+	RatingMarketOutperform,
+	RatingSectorOutperform,
+	RatingStrongBuy,
+	RatingSectorPerform,
+	RatingUnderweight,
+	RatingSell,
+	RatingSpeculativeBuy,
+	RatingSectorWeight,
+	RatingOutperformer,
+	RatingUnderperform,
+	RatingPeerPerform,
+	RatingSectorUnderperform,
+	RatingAccumulate,
+	RatingTopPick,
+	RatingReduce,
+}
+
 // Constants for stock actions to avoid magic strings in the code.
 // These are the expected values for the `action` field in the Stock model.
 // Note: This values can be verified using: `SELECT DISTINCT action FROM stocks;` against our db
@@ -62,4 +117,17 @@ const (
 	ActionTargetRaised  = "target raised"
 	ActionTargetLowered = "target lowered"
 	ActionTargetSet     = "target set"
+	ActionOther         = "other" // action that could not be mapped, see `action_raw`
 )
+
+// CanonicalActions is the set of values stored in the `action` column.
+var CanonicalActions = []string{
+	ActionUpgraded,
+	ActionDowngraded,
+	ActionInitiated,
+	ActionReiterated,
+	ActionTargetRaised,
+	ActionTargetLowered,
+	ActionTargetSet,
+	ActionOther,
+}
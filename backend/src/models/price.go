@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql/driver"
+
+	"github.com/shopspring/decimal"
+)
+
+// Price is an exact decimal amount, like a price target, or null. Its JSON is a number
+// (e.g. `13.5`, not the `"13.5"` of decimal.Decimal) as expected by the frontend models,
+// without changing the encoding of decimal.Decimal for the rest of the program.
+type Price decimal.NullDecimal
+
+// NewPrice returns the valid Price d.
+func NewPrice(d decimal.Decimal) Price {
+	return Price{Decimal: d, Valid: true}
+}
+
+// MarshalJSON returns the amount as a JSON number, or null.
+func (p Price) MarshalJSON() ([]byte, error) {
+	if !p.Valid {
+		return []byte("null"), nil
+	}
+	return []byte(p.Decimal.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number, a quoted number or null.
+func (p *Price) UnmarshalJSON(data []byte) error {
+	return (*decimal.NullDecimal)(p).UnmarshalJSON(data)
+}
+
+// Scan implements sql.Scanner.
+func (p *Price) Scan(value any) error {
+	return (*decimal.NullDecimal)(p).Scan(value)
+}
+
+// Value implements driver.Valuer.
+func (p Price) Value() (driver.Value, error) {
+	return decimal.NullDecimal(p).Value()
+}
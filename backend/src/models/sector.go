@@ -0,0 +1,34 @@
+package models
+
+// Rollup aggregates the events of a group of tickers in a time window.
+type Rollup struct {
+	Events       int     `json:"events"`
+	Tickers      int     `json:"tickers,omitempty"` // missing in the rollup of a ticker
+	AverageScore float64 `json:"average_score"`
+	Upgrades     int     `json:"upgrades"`
+	Downgrades   int     `json:"downgrades"`
+	// Balance is Upgrades minus Downgrades: positive when the brokerages are rotating
+	// into the group.
+	Balance int `json:"balance"`
+}
+
+// SectorRollup is the Rollup of a sector of the companies table, as served by /sectors.
+type SectorRollup struct {
+	Sector string `json:"sector"`
+	Rollup
+	TopTickers []TickerRollup   `json:"top_tickers"` // by average score
+	Industries []IndustryRollup `json:"industries"`  // by balance
+}
+
+// IndustryRollup is the Rollup of an industry of a sector.
+type IndustryRollup struct {
+	Industry string `json:"industry"`
+	Rollup
+}
+
+// TickerRollup is the Rollup of a ticker, with its canonical company name.
+type TickerRollup struct {
+	Ticker  string `json:"ticker"`
+	Company string `json:"company"`
+	Rollup
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StockStats summarizes the stored events, as served by /stats.
+type StockStats struct {
+	Events       int            `json:"events"`
+	Tickers      int            `json:"tickers"`
+	Brokerages   int            `json:"brokerages"`
+	AverageScore float64        `json:"average_score"`
+	MaxScore     float64        `json:"max_score"`
+	LatestEvent  *time.Time     `json:"latest_event,omitempty"` // nil when there are no events
+	ByAction     map[string]int `json:"by_action"`              // events per canonical action
+	ByRating     map[string]int `json:"by_rating"`              // events per rating_to
+}
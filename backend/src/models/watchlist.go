@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Watchlist is a user-defined list of tickers (watchlists and watchlist_tickers tables).
+type Watchlist struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Tickers   []string  `json:"tickers"` // sorted
+	CreatedAt time.Time `json:"created_at"`
+}
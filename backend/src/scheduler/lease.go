@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"vue_go_cockroachdb/src/app"
+)
+
+// Locker grants time-limited leases on a job name, so only one holder runs it at a time.
+type Locker interface {
+	// Acquire takes or renews the lease on name for ttl. It returns false, without
+	// error, if another holder has a lease that hasn't expired.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	// Release gives the lease up, if it's still held.
+	Release(ctx context.Context, name string) error
+	// Holder returns the current holder of the lease on name, empty if nobody holds it.
+	Holder(ctx context.Context, name string) (string, error)
+}
+
+// DBLocker implements Locker with a lease row per job in the "job_leases" table.
+// CockroachDB has no advisory locks, and an expiring row also frees the job when
+// the replica holding it dies.
+type DBLocker struct {
+	DB *sql.DB
+	ID string // identifies this replica in the lease rows
+	// Table holds the lease rows instead of job_leases, with its name, holder and
+	// expires_at columns.
+	Table string
+}
+
+// NewDBLocker returns a DBLocker identified by the hostname, the pid and a random suffix.
+func NewDBLocker(db *sql.DB) *DBLocker {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return &DBLocker{DB: db, ID: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))}
+}
+
+func (l *DBLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	query, args := `
+		INSERT INTO %[1]s (name, holder, expires_at)
+		VALUES ($1, $2, now() + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (name) DO UPDATE
+			SET holder = excluded.holder, expires_at = excluded.expires_at
+			WHERE %[1]s.expires_at < now() OR %[1]s.holder = excluded.holder
+		RETURNING holder
+	`, []any{name, l.ID, ttl.Milliseconds()}
+	if app.DialectOf(l.DB) == app.SQLite {
+		// SQLite has no now() nor intervals: the times come from the clock of this
+		// process, which the other holders of a local file share.
+		now := time.Now().UTC()
+		query, args = `
+			INSERT INTO %[1]s (name, holder, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE
+				SET holder = excluded.holder, expires_at = excluded.expires_at
+				WHERE %[1]s.expires_at < $4 OR %[1]s.holder = excluded.holder
+			RETURNING holder
+		`, []any{name, l.ID, now.Add(ttl), now}
+	}
+	row := l.DB.QueryRowContext(ctx, fmt.Sprintf(query, l.table()), args...)
+
+	var holder string
+	if err := row.Scan(&holder); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil // the conflicting row belongs to another live holder
+		}
+		return false, err
+	}
+	return holder == l.ID, nil
+}
+
+func (l *DBLocker) Release(ctx context.Context, name string) error {
+	_, err := l.DB.ExecContext(ctx, `DELETE FROM `+l.table()+` WHERE name = $1 AND holder = $2`, name, l.ID)
+	return err
+}
+
+func (l *DBLocker) Holder(ctx context.Context, name string) (string, error) {
+	query, args := `SELECT holder FROM %s WHERE name = $1 AND expires_at >= now()`, []any{name}
+	if app.DialectOf(l.DB) == app.SQLite {
+		query, args = `SELECT holder FROM %s WHERE name = $1 AND expires_at >= $2`, []any{name, time.Now().UTC()}
+	}
+	var holder string
+	err := l.DB.QueryRowContext(ctx, fmt.Sprintf(query, l.table()), args...).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return holder, err
+}
+
+func (l *DBLocker) table() string {
+	if l.Table == "" {
+		return "job_leases"
+	}
+	return l.Table
+}
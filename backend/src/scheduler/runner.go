@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"vue_go_cockroachdb/src/logging"
+)
+
+var (
+	// ErrAlreadyRunning is returned by Trigger when this replica is running the job.
+	ErrAlreadyRunning = errors.New("job is already running")
+	// ErrLeaseHeld is returned by Trigger when another replica holds the job lease.
+	ErrLeaseHeld = errors.New("job is running in another replica")
+)
+
+// Triggers of a run, reported in Status.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// MinLeaseTTL is the shortest lease of a job: it's renewed every third of its ttl.
+const MinLeaseTTL = 3 * time.Second
+
+// Job is the work done by a Runner. It must stop when ctx is done.
+type Job func(ctx context.Context) error
+
+// Status describes the current or last run of a job.
+type Status struct {
+	Name        string     `json:"name"`
+	Schedule    string     `json:"schedule,omitempty"`
+	Running     bool       `json:"running"`
+	Trigger     string     `json:"trigger,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	Runs        int        `json:"runs"`
+	LeaseHolder string     `json:"lease_holder,omitempty"` // replica running the job right now, if any
+}
+
+// Runner runs a Job on a Schedule and on demand, holding a lease from a Locker while
+// the job runs so that only one replica runs it at a time.
+type Runner struct {
+	name     string
+	job      Job
+	schedule *Schedule // nil to only run on demand
+	locker   Locker
+	leaseTTL time.Duration
+
+	ctx context.Context // parent of the runs, set by Start
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewRunner returns a Runner for job. The lease is renewed every leaseTTL/3 while
+// the job runs; if it can't be renewed the job is canceled.
+func NewRunner(name string, job Job, schedule *Schedule, locker Locker, leaseTTL time.Duration) *Runner {
+	r := &Runner{
+		name:     name,
+		job:      job,
+		schedule: schedule,
+		locker:   locker,
+		leaseTTL: leaseTTL,
+		ctx:      context.Background(),
+		status:   Status{Name: name},
+	}
+	if schedule != nil {
+		r.status.Schedule = schedule.String()
+	}
+	return r
+}
+
+// Start runs the schedule loop in the background until ctx is done. Runs started by
+// Start or Trigger are canceled when ctx is done; use Wait to wait for them.
+func (r *Runner) Start(ctx context.Context) {
+	r.ctx = ctx
+	if r.schedule == nil {
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			next := r.schedule.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+			r.mu.Lock()
+			r.status.NextRun = &next
+			r.mu.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if err := r.trigger(TriggerSchedule); err != nil {
+				slog.WarnContext(ctx, "Scheduled run skipped", "job", r.name, "error", err)
+			}
+		}
+	}()
+}
+
+// Wait blocks until the schedule loop and the running job have finished.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Trigger starts a run now, in the background. It returns ErrAlreadyRunning or
+// ErrLeaseHeld if the job is already running here or in another replica.
+func (r *Runner) Trigger() error {
+	return r.trigger(TriggerManual)
+}
+
+// Status returns the state of the job, including which replica holds the lease.
+func (r *Runner) Status(ctx context.Context) Status {
+	r.mu.Lock()
+	status := r.status
+	r.mu.Unlock()
+
+	holder, err := r.locker.Holder(ctx, r.name)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not read the lease", "job", r.name, "error", err)
+	}
+	status.LeaseHolder = holder
+	return status
+}
+
+func (r *Runner) trigger(trigger string) error {
+	r.mu.Lock()
+	if r.status.Running {
+		r.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	r.status.Running = true // reserved while the lease is acquired
+	r.mu.Unlock()
+
+	acquired, err := r.locker.Acquire(r.ctx, r.name, r.leaseTTL)
+	if err != nil || !acquired {
+		r.mu.Lock()
+		r.status.Running = false
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return ErrLeaseHeld
+	}
+
+	startedAt := time.Now().UTC()
+	r.mu.Lock()
+	r.status.Trigger = trigger
+	r.status.StartedAt = &startedAt
+	r.status.FinishedAt = nil
+	r.status.LastError = ""
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.run(trigger)
+	return nil
+}
+
+// run executes the job started by trigger while renewing the lease, then records the
+// result.
+func (r *Runner) run(trigger string) {
+	defer r.wg.Done()
+
+	// the job logs the id of the run, as the logs below
+	ctx, _ := logging.WithRunID(r.ctx)
+	slog.InfoContext(ctx, "Run started", "job", r.name, "trigger", trigger)
+
+	err := runLeased(ctx, r.locker, r.name, r.leaseTTL, r.job)
+
+	finishedAt := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Running = false
+	r.status.FinishedAt = &finishedAt
+	r.status.Runs++
+	if err != nil {
+		r.status.LastError = err.Error()
+		slog.ErrorContext(ctx, "Run failed", "job", r.name, "error", err)
+	}
+}
+
+// RunOnce runs job now, in this goroutine, holding the lease on name from locker as a
+// Runner does, so it doesn't run at the same time as the Runners of name. It returns
+// ErrLeaseHeld if another holder has the lease.
+func RunOnce(ctx context.Context, name string, job Job, locker Locker, leaseTTL time.Duration) error {
+	acquired, err := locker.Acquire(ctx, name, leaseTTL)
+	if err != nil {
+		return fmt.Errorf("acquire the %s lease: %w", name, err)
+	}
+	if !acquired {
+		return ErrLeaseHeld
+	}
+	return runLeased(ctx, locker, name, leaseTTL, job)
+}
+
+// runLeased runs job while renewing the lease on name, already held, every ttl/3, and
+// then releases it. If the lease can't be renewed the job is canceled.
+func runLeased(ctx context.Context, locker Locker, name string, ttl time.Duration, job Job) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ok, err := locker.Acquire(ctx, name, ttl); err != nil || !ok {
+					slog.ErrorContext(ctx, "Lost the lease, canceling the run", "job", name, "error", err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := job(ctx)
+	cancel()
+	<-renewDone
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer releaseCancel()
+	if err := locker.Release(releaseCtx, name); err != nil {
+		slog.ErrorContext(ctx, "Could not release the lease", "job", name, "error", err)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLocker is a Locker shared by several fake replicas in memory.
+type memoryLocker struct {
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+// replicaLocker is the view of memoryLocker of one replica.
+type replicaLocker struct {
+	*memoryLocker
+	id string
+}
+
+func (l replicaLocker) Acquire(_ context.Context, name string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holder, ok := l.holders[name]; ok && holder != l.id {
+		return false, nil
+	}
+	l.holders[name] = l.id
+	return true, nil
+}
+
+func (l replicaLocker) Release(_ context.Context, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holders[name] == l.id {
+		delete(l.holders, name)
+	}
+	return nil
+}
+
+func (l replicaLocker) Holder(_ context.Context, name string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holders[name], nil
+}
+
+func TestRunnerTrigger(t *testing.T) {
+	shared := &memoryLocker{holders: map[string]string{}}
+	release := make(chan struct{})
+	job := func(ctx context.Context) error {
+		<-release
+		return errors.New("boom")
+	}
+
+	first := NewRunner("etl", job, nil, replicaLocker{shared, "a"}, time.Minute)
+	second := NewRunner("etl", job, nil, replicaLocker{shared, "b"}, time.Minute)
+	first.Start(context.Background())
+	second.Start(context.Background())
+
+	if err := first.Trigger(); err != nil {
+		t.Fatalf("Trigger returned unexpected error: %v", err)
+	}
+	if err := first.Trigger(); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second Trigger on the same replica = %v; want ErrAlreadyRunning", err)
+	}
+	if err := second.Trigger(); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("Trigger on another replica = %v; want ErrLeaseHeld", err)
+	}
+
+	status := second.Status(context.Background())
+	if status.Running || status.LeaseHolder != "a" {
+		t.Errorf("status of the idle replica = %+v; want not running and lease held by a", status)
+	}
+
+	close(release)
+	first.Wait()
+
+	status = first.Status(context.Background())
+	if status.Running || status.Runs != 1 || status.LastError != "boom" || status.FinishedAt == nil || status.LeaseHolder != "" {
+		t.Errorf("status after the run = %+v", status)
+	}
+
+	// the lease is free again
+	if err := second.Trigger(); err != nil {
+		t.Errorf("Trigger after the lease was released returned %v", err)
+	}
+	second.Wait()
+}
+
+func TestRunOnce(t *testing.T) {
+	shared := &memoryLocker{holders: map[string]string{}}
+	cron := replicaLocker{shared, "cron"}
+	ran := false
+	job := func(ctx context.Context) error {
+		ran = true
+		if holder, _ := cron.Holder(context.Background(), "etl"); holder != "cron" {
+			t.Errorf("lease held by %q while the job runs; want cron", holder)
+		}
+		return errors.New("boom")
+	}
+	if err := RunOnce(context.Background(), "etl", job, cron, time.Minute); err == nil || err.Error() != "boom" || !ran {
+		t.Errorf("RunOnce() = %v; want the error of the job", err)
+	}
+	if holder, _ := cron.Holder(context.Background(), "etl"); holder != "" {
+		t.Errorf("lease held by %q after the run; want it released", holder)
+	}
+
+	replica := NewRunner("etl", func(ctx context.Context) error { <-ctx.Done(); return nil }, nil, replicaLocker{shared, "a"}, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	replica.Start(ctx)
+	if err := replica.Trigger(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunOnce(context.Background(), "etl", job, cron, time.Minute); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("RunOnce() while a replica runs the job = %v; want ErrLeaseHeld", err)
+	}
+	cancel()
+	replica.Wait()
+}
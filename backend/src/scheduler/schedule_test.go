@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Friday 2025-03-14 10:07 UTC
+	from := time.Date(2025, 3, 14, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 3, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"30 6 * * 1-5", time.Date(2025, 3, 17, 6, 30, 0, 0, time.UTC)}, // next weekday is Monday
+		{"0 0 1 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 3, 16, 12, 0, 0, 0, time.UTC)}, // 7 is Sunday
+		{"0 0 13 * 6", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},  // day 13 OR Saturday
+		{"0 0 */2 * 1", time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)}, // odd day AND Monday
+		{"0 0 * * */2", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)}, // Saturday is day 6
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"5,35 8-9 * * *", time.Date(2025, 3, 15, 8, 5, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) returned unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.expected) {
+			t.Errorf("ParseSchedule(%q).Next(%v) = %v; want %v", tt.expr, from, got, tt.expected)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *", "@yearly"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted an invalid expression", expr)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+/**
+ * Canonical metadata of a ticker, from the companies table of the backend.
+ */
+export interface Company {
+  ticker: string;
+  name: string;
+  exchange?: string;
+  sector?: string;
+  industry?: string;
+}
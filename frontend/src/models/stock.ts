@@ -1,3 +1,5 @@
+import type { Company } from '@/models/company';
+
 /**
  * Represents a stock recommendation or analysis entry.
  *
@@ -9,7 +11,10 @@ export interface Stock {
   action: string;
   rating_from: string;
   rating_to: string;
-  target_from: number;
-  target_to: number;
+  target_from: number | null;
+  target_to: number | null;
+  target_currency?: string;
   time: string;
+  company_info?: Company;
+  company_mismatch?: boolean;
 }
@@ -0,0 +1,89 @@
+import { defineStore } from 'pinia';
+import { ref } from 'vue';
+import { apiFetch } from '@/utils/api';
+
+export interface ETLStatus {
+  name: string;
+  schedule?: string;
+  running: boolean;
+  trigger?: string;
+  started_at?: string;
+  finished_at?: string;
+  last_error?: string;
+  next_run?: string;
+  runs: number;
+  lease_holder?: string;
+  stats: {
+    pages: number;
+    fetched: number;
+    loaded: number;
+    duplicates: number;
+    failed: number;
+  };
+}
+
+// How often the ETL status is polled while a run is in progress.
+const POLL_INTERVAL_MS = 2000;
+
+export const useETLStore = defineStore('etl', () => {
+  // State
+  const status = ref<ETLStatus | null>(null);
+  const running = ref(false);
+  const error = ref<string | null>(null);
+
+  const fetchStatus = async (): Promise<ETLStatus> => {
+    const response = await apiFetch(
+      `/admin/etl/status`,
+    );
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+    status.value = await response.json();
+    return status.value!;
+  };
+
+  // Actions
+  /**
+   * Starts an ETL run in the backend and waits until it finishes, polling its status.
+   * If a run is already in progress (409), it waits for that one instead.
+   */
+  const runETL = async () => {
+    running.value = true;
+    error.value = null;
+
+    try {
+      const response = await apiFetch(
+        `/admin/etl/run`,
+        { method: 'POST' },
+      );
+      if (!response.ok && response.status !== 409) {
+        throw new Error(`HTTP error! status: ${response.status}`);
+      }
+
+      let current = await fetchStatus();
+      while (current.running || current.lease_holder) {
+        await new Promise((resolve) => setTimeout(resolve, POLL_INTERVAL_MS));
+        current = await fetchStatus();
+      }
+      if (current.last_error) {
+        error.value = `ETL failed: ${current.last_error}`;
+      }
+    } catch (err) {
+      error.value = err instanceof Error ? err.message : 'Error running ETL';
+      console.error('Error running ETL:', err);
+    } finally {
+      running.value = false;
+    }
+  };
+
+  return {
+    // State
+    status,
+    running,
+    error,
+
+    // Actions
+    fetchStatus,
+    runETL,
+  };
+});
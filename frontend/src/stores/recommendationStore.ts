@@ -1,6 +1,7 @@
 import type { Recommendation } from '@/models/recommendation';
 import { defineStore } from 'pinia';
 import { computed, ref } from 'vue';
+import { apiFetch } from '@/utils/api';
 
 export const useRecommendationStore = defineStore('recommendation', () => {
   // State
@@ -45,8 +46,8 @@ export const useRecommendationStore = defineStore('recommendation', () => {
     error.value = null;
 
     try {
-      const response = await fetch(
-        `${import.meta.env.VITE_API_BASE_URL}/recommendations?limit=${limit.value}&minimum_score=${minimumScore.value}`,
+      const response = await apiFetch(
+        `/recommendations?limit=${limit.value}&minimum_score=${minimumScore.value}`,
       );
 
       if (!response.ok) {
@@ -1,6 +1,7 @@
 import type { Stock } from '@/models/stock';
 import { defineStore } from 'pinia';
 import { ref, computed } from 'vue';
+import { apiFetch } from '@/utils/api';
 
 export interface StockResponse {
   items: Stock[];
@@ -77,9 +78,9 @@ export const useStockStore = defineStore('stock', () => {
     error.value = null;
 
     try {
-      const response = await fetch(
+      const response = await apiFetch(
         // &sort=${sortField.value}&direction=${sortDirection.value}
-        `${import.meta.env.VITE_API_BASE_URL}/stocks?page=${page}&limit=${limit.value}&search=${encodeURIComponent(search)}`,
+        `/stocks?page=${page}&limit=${limit.value}&search=${encodeURIComponent(search)}`,
       );
 
       if (!response.ok) {
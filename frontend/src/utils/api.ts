@@ -0,0 +1,15 @@
+/**
+ * fetch for the backend API: prefixes the path with VITE_API_BASE_URL and, when
+ * VITE_API_KEY is set, sends it as a Bearer token.
+ */
+export const apiFetch = (path: string, init: RequestInit = {}) => {
+  const headers = new Headers(init.headers);
+  const apiKey = import.meta.env.VITE_API_KEY;
+  if (apiKey) {
+    headers.set('Authorization', `Bearer ${apiKey}`);
+  }
+  return fetch(`${import.meta.env.VITE_API_BASE_URL}${path}`, {
+    ...init,
+    headers,
+  });
+};